@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go_final_project/internal/app"
+	"go_final_project/internal/config"
+	"go_final_project/internal/db"
+)
+
+// Выполняет служебную команду над базой из настроек: init, backup <файл>, restore <файл>, vacuum или check.
+// Команды работают и при запущенном сервере
+func runCommand(ctx context.Context, cfg *config.Handler, args []string) error {
+	command, args := args[0], args[1:]
+	database := db.New(cfg)
+
+	if command == "init" {
+		if len(args) > 0 {
+			return fmt.Errorf("init: unexpected arguments %v", args)
+		}
+		if err := database.Create(); err != nil {
+			return fmt.Errorf("init: %v", err)
+		}
+		// Open дополняет схему таблицами, которые появились после первой версии
+		if err := database.Open(); err != nil {
+			return fmt.Errorf("init: %v", err)
+		}
+		fmt.Printf("Database %s created\n", cfg.DBPath())
+		return database.Close()
+	}
+
+	switch command {
+	case "backup", "restore":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: %s <file>", command)
+		}
+	case "vacuum", "check":
+		if len(args) > 0 {
+			return fmt.Errorf("%s: unexpected arguments %v", command, args)
+		}
+	default:
+		return fmt.Errorf("unknown command %q, expected init, backup, restore, vacuum or check", command)
+	}
+
+	if !database.Exists() {
+		return fmt.Errorf("%s: database %s not found, run init first", command, cfg.DBPath())
+	}
+	if err := database.Open(); err != nil {
+		return fmt.Errorf("%s: %v", command, err)
+	}
+	defer database.Close()
+
+	switch command {
+	case "backup":
+		if err := database.Backup(ctx, args[0]); err != nil {
+			return fmt.Errorf("backup: %v", err)
+		}
+		fmt.Printf("Database %s saved to %s\n", cfg.DBPath(), args[0])
+	case "restore":
+		if err := database.Restore(ctx, args[0]); err != nil {
+			return fmt.Errorf("restore: %v", err)
+		}
+		fmt.Printf("Database %s restored from %s\n", cfg.DBPath(), args[0])
+	case "vacuum":
+		if err := database.Vacuum(ctx); err != nil {
+			return fmt.Errorf("vacuum: %v", err)
+		}
+		fmt.Printf("Database %s vacuumed\n", cfg.DBPath())
+	case "check":
+		return check(ctx, cfg, database)
+	}
+	return nil
+}
+
+// Проверяет целостность файла базы и данные каждой задачи. Найденные ошибки выводятся все, а команда завершается с ошибкой
+func check(ctx context.Context, cfg *config.Handler, database *db.DBStorage) error {
+	problems, err := database.IntegrityCheck(ctx)
+	if err != nil {
+		return fmt.Errorf("check: %v", err)
+	}
+	for _, problem := range problems {
+		fmt.Fprintf(os.Stderr, "integrity: %s\n", problem)
+	}
+
+	invalid, err := app.CreateApplication(database, cfg).CheckTasks(ctx)
+	if err != nil {
+		return fmt.Errorf("check: %v", err)
+	}
+	for _, task := range invalid {
+		fmt.Fprintf(os.Stderr, "task %s (%q): %v\n", task.Task.ID, task.Task.Title, task.Err)
+	}
+
+	if len(problems) > 0 || len(invalid) > 0 {
+		return fmt.Errorf("check: %d integrity problems, %d invalid tasks", len(problems), len(invalid))
+	}
+	fmt.Printf("Database %s is ok\n", cfg.DBPath())
+	return nil
+}
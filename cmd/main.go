@@ -1,39 +1,93 @@
 package main
 
 import (
+	"context"
 	"log"
-	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"go_final_project/internal/app"
+	"go_final_project/internal/authorization"
+	"go_final_project/internal/backup"
+	"go_final_project/internal/caldav"
 	"go_final_project/internal/config"
 	"go_final_project/internal/db"
 	"go_final_project/internal/rest"
+	"go_final_project/internal/server"
+	"go_final_project/internal/webhook"
 )
 
 func main() {
+	cfg, args, err := config.Load(os.Args[1:])
+	if err != nil {
+		log.Fatalf("main(): %v ", err)
+		return
+	}
+
+	// Служебные команды указываются после флагов: `go run ./cmd -dbpath todo.db backup todo.bak`
+	if len(args) > 0 {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		if err := runCommand(ctx, cfg, args); err != nil {
+			log.Fatalf("main(): %v ", err)
+		}
+		return
+	}
+
 	log.Println("Starting server")
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("main(): %v ", err)
+		return
+	}
 
-	cfg := config.New()
 	database := db.New(cfg)
 	if !database.Exists() {
 		if err := database.Create(); err != nil {
-			log.Fatal("main(): %w ", err)
+			log.Fatalf("main(): %v ", err)
 			return
 		}
 	}
 
 	if err := database.Open(); err != nil {
-		log.Fatal("main(): %w ", err)
+		log.Fatalf("main(): %v ", err)
 		return
 	}
 
-	application := app.CreateApplication(database)
-	mux := rest.NewMux(application, cfg)
+	application := app.CreateApplication(database, cfg)
+	auth := authorization.Create(database, cfg)
+	backups := backup.New(database, cfg)
+	webhooks := webhook.New(database, cfg)
+	mux := rest.NewMux(rest.Deps{
+		App:      application,
+		Auth:     auth,
+		Backups:  backups,
+		DAV:      caldav.New(application, database),
+		Webhooks: webhooks,
+	}, cfg)
 
-	log.Printf("Server is running on port: :%s\n", cfg.Port())
+	srv := server.New(cfg, mux.ServeMux())
+	srv.Closer(database)
 
-	err := http.ListenAndServe(":"+cfg.Port(), mux.ServeMux())
-	if err != nil {
-		log.Fatal("main(): %w ", err)
+	// SIGHUP и изменение файла настроек перечитывают настройки без перезапуска
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	srv.Worker(func(ctx context.Context) {
+		cfg.Watch(ctx, reload)
+	})
+
+	// Резервные копии сохраняются, только если задан каталог TODO_BACKUP_DIR
+	srv.Worker(backups.Run)
+	srv.Worker(webhooks.Run)
+
+	// Первый сигнал запускает корректную остановку, повторный прерывает процесс сразу
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	if err := srv.Run(ctx); err != nil {
+		log.Fatalf("main(): %v ", err)
 	}
 }
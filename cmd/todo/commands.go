@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go_final_project/internal/app"
+	"go_final_project/internal/config"
+	"go_final_project/internal/export"
+)
+
+// Команда add: создает задачу с заголовком из аргументов
+func add(ctx context.Context, opts options, tasks backend, args []string) error {
+	fs := flag.NewFlagSet("add", flag.ContinueOnError)
+	date := fs.String("date", "", "дата задачи, по умолчанию сегодня")
+	comment := fs.String("comment", "", "комментарий")
+	repeat := fs.String("repeat", "", "правило повторения, например `d 7`")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errors.New("add: title required")
+	}
+
+	task := app.Task{Title: strings.Join(fs.Args(), " "), Comment: *comment, Repeat: *repeat}
+	var err error
+	if task.Date, err = parseDate(opts.cfg, *date); err != nil {
+		return fmt.Errorf("add: %v", err)
+	}
+
+	task, err = tasks.AddTask(ctx, task)
+	if err != nil {
+		return fmt.Errorf("add: %w", err)
+	}
+	return printTasks(opts, []app.Task{task}, task)
+}
+
+// Команда list: ближайшие задачи
+func list(ctx context.Context, opts options, tasks backend, args []string) error {
+	if len(args) > 0 {
+		return errors.New("list: unexpected arguments, use search")
+	}
+	found, err := tasks.GetTaskList(ctx, "")
+	if err != nil {
+		return fmt.Errorf("list: %w", err)
+	}
+	return printTasks(opts, found, found)
+}
+
+// Команда search: задачи, в заголовке или комментарии которых есть строка, или задачи на дату
+func search(ctx context.Context, opts options, tasks backend, args []string) error {
+	if len(args) == 0 {
+		return errors.New("search: search string required")
+	}
+	query := strings.Join(args, " ")
+	if date, err := time.Parse(config.DBDateFormat, query); err == nil {
+		// Сервер ищет по дате в формате строки поиска
+		query = date.Format(opts.cfg.SearchDateFormat())
+	}
+
+	found, err := tasks.GetTaskList(ctx, query)
+	if err != nil {
+		return fmt.Errorf("search: %w", err)
+	}
+	return printTasks(opts, found, found)
+}
+
+// Команда done: выполняет задачу. Повторяющаяся задача переносится на следующую дату, остальные удаляются
+func done(ctx context.Context, opts options, tasks backend, args []string) error {
+	id, err := taskID("done", args)
+	if err != nil {
+		return err
+	}
+	if err := tasks.FinishTask(ctx, id); err != nil {
+		return fmt.Errorf("done: %w", err)
+	}
+
+	result := struct {
+		ID   string `json:"id"`
+		Date string `json:"date,omitempty"` // следующая дата повторяющейся задачи
+	}{ID: id}
+	task, err := tasks.GetTask(ctx, id)
+	switch {
+	case err == nil:
+		result.Date = task.Date
+	case !errors.Is(err, app.ErrNotFound):
+		return fmt.Errorf("done: %w", err)
+	}
+
+	if opts.json {
+		return printJSON(opts, result)
+	}
+	if len(result.Date) > 0 {
+		return printLine(opts, "Задача %s выполнена, следующая дата %s", id, formatDate(opts.cfg, result.Date))
+	}
+	return printLine(opts, "Задача %s выполнена и удалена", id)
+}
+
+// Команда rm: удаляет задачу
+func remove(ctx context.Context, opts options, tasks backend, args []string) error {
+	id, err := taskID("rm", args)
+	if err != nil {
+		return err
+	}
+	if err := tasks.RemoveTask(ctx, id); err != nil {
+		return fmt.Errorf("rm: %w", err)
+	}
+	if opts.json {
+		return printJSON(opts, map[string]string{"id": id})
+	}
+	return printLine(opts, "Задача %s удалена", id)
+}
+
+// Команда edit: изменяет только указанные флагами поля задачи
+func edit(ctx context.Context, opts options, tasks backend, args []string) error {
+	if len(args) == 0 {
+		return errors.New("edit: task id required")
+	}
+	id := args[0]
+
+	fs := flag.NewFlagSet("edit", flag.ContinueOnError)
+	fs.String("title", "", "новый заголовок")
+	fs.String("date", "", "новая дата")
+	fs.String("comment", "", "новый комментарий")
+	fs.String("repeat", "", "новое правило повторения, пустое отключает повторение")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("edit: unexpected arguments %v", fs.Args())
+	}
+
+	patch := make(map[string]any)
+	var err error
+	fs.Visit(func(f *flag.Flag) {
+		value := f.Value.String()
+		if f.Name == "date" {
+			if value, err = parseDate(opts.cfg, value); err != nil {
+				err = fmt.Errorf("edit: %v", err)
+			}
+		}
+		patch[f.Name] = value
+	})
+	if err != nil {
+		return err
+	}
+	if len(patch) == 0 {
+		return errors.New("edit: nothing to change, use -title, -date, -comment or -repeat")
+	}
+
+	task, err := tasks.PatchTask(ctx, id, patch)
+	if err != nil {
+		return fmt.Errorf("edit: %w", err)
+	}
+	return printTasks(opts, []app.Task{task}, task)
+}
+
+// Команда export: выгружает все задачи в stdout или в файл -o. Формат по умолчанию берется из расширения файла
+func exportTasks(ctx context.Context, opts options, tasks backend, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := fs.String("format", "", "формат: json, csv или ics, по умолчанию json")
+	component := fs.String("component", "", "для ics: vevent - события на весь день, vtodo - записи списка дел")
+	output := fs.String("o", "", "файл, в который сохранить выгрузку")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("export: unexpected arguments %v", fs.Args())
+	}
+	if len(*format) == 0 {
+		*format = strings.TrimPrefix(filepath.Ext(*output), ".")
+		if _, ok := export.ContentType(*format); !ok {
+			*format = export.FormatJSON
+		}
+	}
+	if _, ok := export.ContentType(*format); !ok {
+		return fmt.Errorf("export: unsupported format %q, expected json, csv or ics", *format)
+	}
+	if *component != "" && *component != "vevent" && *component != "vtodo" {
+		return fmt.Errorf("export: unsupported component %q, expected vevent or vtodo", *component)
+	}
+
+	if len(*output) == 0 {
+		if err := tasks.Export(ctx, *format, *component, opts.out); err != nil {
+			return fmt.Errorf("export: %w", err)
+		}
+		return nil
+	}
+
+	f, err := os.Create(*output)
+	if err != nil {
+		return fmt.Errorf("export: %v", err)
+	}
+	err = tasks.Export(ctx, *format, *component, f)
+	if closeErr := f.Close(); err == nil && closeErr != nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(*output)
+		return fmt.Errorf("export: %w", err)
+	}
+	return nil
+}
+
+// Команда import: создает задачи из файла, "-" читает файл из stdin. Выводит итог каждой записи
+func importTasks(ctx context.Context, opts options, tasks backend, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	format := fs.String("format", "", "формат: json, csv, ics, todoist или trello, по умолчанию определяется по содержимому")
+	dryRun := fs.Bool("dry-run", false, "только проверить файл, не создавая задачи")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("import: file required")
+	}
+
+	var data []byte
+	var err error
+	if fs.Arg(0) == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(fs.Arg(0))
+	}
+	if err != nil {
+		return fmt.Errorf("import: %v", err)
+	}
+
+	report, err := tasks.Import(ctx, data, *format, *dryRun)
+	if err != nil {
+		return fmt.Errorf("import: %w", err)
+	}
+	return printImport(opts, report)
+}
+
+// Команда next: вычисляет следующую дату по правилу повторения, база и сервер для этого не нужны
+func next(opts options, args []string) error {
+	fs := flag.NewFlagSet("next", flag.ContinueOnError)
+	now := fs.String("now", "", "дата, после которой искать следующую, по умолчанию сегодня")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		return errors.New("next: date and repeat rule required")
+	}
+
+	nowDate, err := parseDate(opts.cfg, *now)
+	if err != nil {
+		return fmt.Errorf("next: %v", err)
+	}
+	if len(nowDate) == 0 {
+		nowDate = time.Now().Format(config.DBDateFormat)
+	}
+	date, err := parseDate(opts.cfg, fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("next: %v", err)
+	}
+
+	result, err := app.CreateApplication(nil, opts.cfg).NextDate(nowDate, date, fs.Arg(1))
+	if err != nil {
+		return fmt.Errorf("next: %w", err)
+	}
+	if opts.json {
+		return printJSON(opts, map[string]string{"date": result})
+	}
+	return printLine(opts, "%s", formatDate(opts.cfg, result))
+}
+
+func taskID(command string, args []string) (string, error) {
+	if len(args) != 1 {
+		return "", fmt.Errorf("%s: task id required", command)
+	}
+	return args[0], nil
+}
+
+// Принимает дату в формате базы (20060102) или в формате строки поиска из настроек (02.01.2006)
+func parseDate(cfg *config.Handler, s string) (string, error) {
+	if len(s) == 0 {
+		return "", nil
+	}
+	for _, layout := range []string{config.DBDateFormat, cfg.SearchDateFormat()} {
+		if date, err := time.Parse(layout, s); err == nil {
+			return date.Format(config.DBDateFormat), nil
+		}
+	}
+	return "", fmt.Errorf("invalid date %q, use %s or %s", s, config.DBDateFormat, cfg.SearchDateFormat())
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go_final_project/internal/client"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Сервер и токен, сохраненные командой login
+type credentials struct {
+	Server string `json:"server"`
+	Token  string `json:"token"`
+}
+
+func credentialsPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("credentialsPath: %v", err)
+	}
+	return filepath.Join(dir, "todo", "credentials.json"), nil
+}
+
+func loadCredentials() (credentials, error) {
+	var creds credentials
+	path, err := credentialsPath()
+	if err != nil {
+		return creds, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return creds, nil
+	}
+	if err != nil {
+		return creds, fmt.Errorf("loadCredentials: %v", err)
+	}
+	if err := json.Unmarshal(data, &creds); err != nil {
+		return creds, fmt.Errorf("loadCredentials: %s: %v", path, err)
+	}
+	return creds, nil
+}
+
+// Сохраняет токен в файл, доступный только владельцу
+func saveCredentials(creds credentials) error {
+	path, err := credentialsPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("saveCredentials: %v", err)
+	}
+	data, err := json.Marshal(creds)
+	if err != nil {
+		return fmt.Errorf("saveCredentials: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("saveCredentials: %v", err)
+	}
+	return nil
+}
+
+// Обменивает сохраненный токен на новый, когда прошла половина его срока действия. Сервер выдает токены
+// на TODO_TOKEN_TTL, и без обмена утилита перестала бы работать через этот срок после login
+func refreshCredentials(ctx context.Context, opts options, creds credentials) (credentials, error) {
+	issued, expires, ok := tokenLifetime(creds.Token)
+	if !ok {
+		// API-ключ не истекает, и обменивать его не нужно
+		return creds, nil
+	}
+	now := time.Now()
+	if now.After(expires) {
+		return creds, errors.New("saved token has expired, run todo login")
+	}
+	if now.Before(issued.Add(expires.Sub(issued) / 2)) {
+		return creds, nil
+	}
+
+	token, err := client.New(creds.Server, creds.Token, httpClient(opts)).RefreshToken(ctx)
+	if err != nil {
+		return creds, fmt.Errorf("refreshCredentials: %w, run todo login", err)
+	}
+	creds.Token = token
+	return creds, saveCredentials(creds)
+}
+
+// Время выдачи и истечения токена. Подпись не проверяется: ее проверяет сервер, утилите нужны только сроки
+func tokenLifetime(token string) (time.Time, time.Time, bool) {
+	var claims jwt.RegisteredClaims
+	if _, _, err := jwt.NewParser().ParseUnverified(token, &claims); err != nil {
+		return time.Time{}, time.Time{}, false
+	}
+	if claims.IssuedAt == nil || claims.ExpiresAt == nil {
+		return time.Time{}, time.Time{}, false
+	}
+	return claims.IssuedAt.Time, claims.ExpiresAt.Time, true
+}
+
+// Команда login: входит на сервер по паролю и сохраняет токен для следующих команд
+func login(ctx context.Context, opts options, args []string) error {
+	fs := flag.NewFlagSet("login", flag.ContinueOnError)
+	password := fs.String("password", os.Getenv("TODO_PASSWORD"), "пароль, если не указан - читается из стандартного ввода")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if len(opts.server) == 0 {
+		return errors.New("login: server required, use -server or TODO_SERVER")
+	}
+
+	if len(*password) == 0 {
+		fmt.Fprint(os.Stderr, "Пароль: ")
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && len(line) == 0 {
+			return fmt.Errorf("login: %v", err)
+		}
+		*password = strings.TrimRight(line, "\r\n")
+	}
+
+	token, err := client.New(opts.server, "", httpClient(opts)).Signin(ctx, *password)
+	if err != nil {
+		return fmt.Errorf("login: %w", err)
+	}
+	return saveCredentials(credentials{Server: opts.server, Token: token})
+}
+
+// Команда logout: забывает сохраненный сервер и токен
+func logout() error {
+	path, err := credentialsPath()
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("logout: %v", err)
+	}
+	return nil
+}
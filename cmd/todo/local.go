@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+
+	"go_final_project/internal/app"
+	"go_final_project/internal/export"
+	"go_final_project/internal/ical"
+	"go_final_project/internal/importer"
+)
+
+// Задачи в локальной базе, с которыми команды работают через app.Application так же, как сервер
+type localTasks struct {
+	app   *app.Application
+	limit int64
+}
+
+func (t localTasks) AddTask(ctx context.Context, task app.Task) (app.Task, error) {
+	return t.app.AddTask(ctx, task)
+}
+
+func (t localTasks) GetTask(ctx context.Context, id string) (app.Task, error) {
+	return t.app.GetTask(ctx, id)
+}
+
+func (t localTasks) GetTaskList(ctx context.Context, search string) ([]app.Task, error) {
+	return t.app.GetTaskList(ctx, app.DefaultList, search, t.limit)
+}
+
+func (t localTasks) PatchTask(ctx context.Context, id string, patch map[string]any) (app.Task, error) {
+	data, err := json.Marshal(patch)
+	if err != nil {
+		return app.Task{}, err
+	}
+	return t.app.PatchTask(ctx, id, data, 0)
+}
+
+func (t localTasks) FinishTask(ctx context.Context, id string) error {
+	return t.app.FinishTask(ctx, id, 0)
+}
+
+func (t localTasks) RemoveTask(ctx context.Context, id string) error {
+	return t.app.RemoveTask(ctx, id, 0)
+}
+
+func (t localTasks) Export(ctx context.Context, format, component string, w io.Writer) error {
+	tasks, err := t.app.AllTasks(ctx, app.DefaultList)
+	if err != nil {
+		return err
+	}
+	if format == export.FormatICS && component == "vtodo" {
+		return export.WriteICS(w, ical.KindTodo, tasks)
+	}
+	return export.Write(w, format, tasks)
+}
+
+func (t localTasks) Import(ctx context.Context, data []byte, format string, dryRun bool) (importer.Report, error) {
+	return importer.Import(ctx, t.app, app.DefaultList, data, format, dryRun)
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"go_final_project/internal/app"
+	"go_final_project/internal/client"
+	"go_final_project/internal/config"
+	"go_final_project/internal/db"
+	"go_final_project/internal/importer"
+)
+
+const (
+	serverEnv = "TODO_SERVER"
+	tokenEnv  = "TODO_TOKEN"
+
+	requestTimeout = 30 * time.Second
+)
+
+const usage = `Использование: todo [флаги] <команда> [аргументы]
+
+Команды:
+  add [-date D] [-comment C] [-repeat R] <заголовок>  создать задачу
+  list                                                ближайшие задачи
+  search <строка или дата>                            найти задачи
+  done <id>                                           выполнить задачу
+  rm <id>                                             удалить задачу
+  edit <id> [-title T] [-date D] [-comment C] [-repeat R]  изменить указанные поля задачи
+  export [-format json|csv|ics] [-component vevent|vtodo] [-o файл]  выгрузить все задачи
+  import [-format F] [-dry-run] <файл>                 создать задачи из файла json, csv, ics, Todoist или Trello
+  next [-now D] <дата> <правило>                      следующая дата по правилу повторения
+  login [-password P]                                 войти на сервер -server и сохранить токен
+  logout                                              удалить сохраненный токен
+
+Флаги:
+`
+
+// Утилита командной строки для работы с задачами: напрямую с файлом базы или через api сервера
+func main() {
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "todo: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// Параметры, общие для всех команд
+type options struct {
+	dbPath   string
+	server   string
+	insecure bool
+	json     bool
+	out      io.Writer
+	cfg      *config.Handler
+}
+
+func run(args []string, out io.Writer) error {
+	opts := options{out: out}
+	fs := flag.NewFlagSet("todo", flag.ContinueOnError)
+	fs.StringVar(&opts.dbPath, "db", "", "работать напрямую с файлом базы (по умолчанию TODO_DBPATH, если не задан сервер)")
+	fs.StringVar(&opts.server, "server", os.Getenv(serverEnv), "адрес сервера, например https://localhost:7540")
+	fs.BoolVar(&opts.insecure, "insecure", false, "не проверять сертификат сервера")
+	fs.BoolVar(&opts.json, "json", false, "выводить результат в формате JSON")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), usage)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("command required")
+	}
+
+	var cfgArgs []string
+	if len(opts.dbPath) > 0 {
+		cfgArgs = []string{"-dbpath", opts.dbPath}
+	}
+	cfg, _, err := config.Load(cfgArgs)
+	if err != nil {
+		return err
+	}
+	opts.cfg = cfg
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	command, args := fs.Arg(0), fs.Args()[1:]
+	switch command {
+	case "login":
+		return login(ctx, opts, args)
+	case "logout":
+		return logout()
+	case "next":
+		return next(opts, args)
+	}
+
+	tasks, closeTasks, err := openBackend(ctx, opts)
+	if err != nil {
+		return err
+	}
+	defer closeTasks()
+
+	switch command {
+	case "add":
+		return add(ctx, opts, tasks, args)
+	case "list":
+		return list(ctx, opts, tasks, args)
+	case "search":
+		return search(ctx, opts, tasks, args)
+	case "done":
+		return done(ctx, opts, tasks, args)
+	case "rm":
+		return remove(ctx, opts, tasks, args)
+	case "edit":
+		return edit(ctx, opts, tasks, args)
+	case "export":
+		return exportTasks(ctx, opts, tasks, args)
+	case "import":
+		return importTasks(ctx, opts, tasks, args)
+	default:
+		return fmt.Errorf("unknown command %q, see todo -h", command)
+	}
+}
+
+// Задачи, с которыми работают команды: локальная база или api сервера
+type backend interface {
+	AddTask(ctx context.Context, task app.Task) (app.Task, error)
+	GetTask(ctx context.Context, id string) (app.Task, error)
+	GetTaskList(ctx context.Context, search string) ([]app.Task, error)
+	PatchTask(ctx context.Context, id string, patch map[string]any) (app.Task, error)
+	FinishTask(ctx context.Context, id string) error
+	RemoveTask(ctx context.Context, id string) error
+	Export(ctx context.Context, format, component string, w io.Writer) error
+	Import(ctx context.Context, data []byte, format string, dryRun bool) (importer.Report, error)
+}
+
+// Выбирает, с чем работать: флаг -db означает локальную базу, иначе используется сервер из -server,
+// TODO_SERVER или сохраненный командой login. Без сервера используется база из настроек
+func openBackend(ctx context.Context, opts options) (backend, func(), error) {
+	if len(opts.dbPath) == 0 {
+		creds, err := loadCredentials()
+		if err != nil {
+			return nil, nil, err
+		}
+		server := opts.server
+		if len(server) == 0 {
+			server = creds.Server
+		}
+		if len(server) > 0 {
+			token := os.Getenv(tokenEnv)
+			if len(token) == 0 && server == creds.Server {
+				if creds, err = refreshCredentials(ctx, opts, creds); err != nil {
+					return nil, nil, err
+				}
+				token = creds.Token
+			}
+			return client.New(server, token, httpClient(opts)), func() {}, nil
+		}
+	}
+
+	database := db.New(opts.cfg)
+	if !database.Exists() {
+		return nil, nil, fmt.Errorf("database %s not found, start the server once or run todo -db with an existing file", opts.cfg.DBPath())
+	}
+	if err := database.Open(); err != nil {
+		return nil, nil, err
+	}
+	tasks := localTasks{app: app.CreateApplication(database, opts.cfg), limit: opts.cfg.TaskListLimit()}
+	return tasks, func() { database.Close() }, nil
+}
+
+func httpClient(opts options) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if opts.insecure {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	return &http.Client{Transport: transport}
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go_final_project/internal/app"
+	"go_final_project/internal/authorization"
+	"go_final_project/internal/backup"
+	"go_final_project/internal/caldav"
+	"go_final_project/internal/client"
+	"go_final_project/internal/config"
+	"go_final_project/internal/db"
+	"go_final_project/internal/rest"
+	"go_final_project/internal/webhook"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Готовит окружение утилиты: файл с токеном во временном каталоге, без сервера и токена из переменных
+func setupEnv(t *testing.T) string {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("HOME", dir)
+	for _, name := range []string{serverEnv, tokenEnv, "TODO_CONFIG", "TODO_PASSWORD", "TODO_OIDC_ISSUER"} {
+		t.Setenv(name, "")
+	}
+	t.Setenv("TODO_DBPATH", filepath.Join(dir, "missing.db"))
+	return dir
+}
+
+func todo(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	var out bytes.Buffer
+	err := run(args, &out)
+	return out.String(), err
+}
+
+// Создает пустую базу и возвращает путь к ней
+func createDB(t *testing.T, dir string) string {
+	path := filepath.Join(dir, "scheduler.db")
+	cfg, _, err := config.Load([]string{"-dbpath", path})
+	require.NoError(t, err)
+	require.NoError(t, db.New(cfg).Create())
+	return path
+}
+
+// Запускает сервер с базой во временном каталоге так же, как cmd/main.go
+func startServer(t *testing.T) *httptest.Server {
+	t.Setenv("TODO_DBPATH", filepath.Join(t.TempDir(), "scheduler.db"))
+	t.Setenv("TODO_WEBDIR", "../../web")
+	cfg, _, err := config.Load(nil)
+	require.NoError(t, err)
+	database := db.New(cfg)
+	require.NoError(t, database.Create())
+	require.NoError(t, database.Open())
+	t.Cleanup(func() { database.Close() })
+
+	application := app.CreateApplication(database, cfg)
+	deps := rest.Deps{
+		App:      application,
+		Auth:     authorization.Create(database, cfg),
+		Backups:  backup.New(database, cfg),
+		DAV:      caldav.New(application, database),
+		Webhooks: webhook.New(database, cfg),
+	}
+	srv := httptest.NewServer(rest.NewMux(deps, cfg).ServeMux())
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestParseDate(t *testing.T) {
+	cfg := config.New()
+	for s, expected := range map[string]string{
+		"":           "",
+		"20240126":   "20240126",
+		"26.01.2024": "20240126",
+		"01.03.2024": "20240301",
+	} {
+		date, err := parseDate(cfg, s)
+		require.NoError(t, err, s)
+		assert.Equal(t, expected, date, s)
+	}
+	for _, s := range []string{"2024-01-26", "26.01", "32.01.2024", "завтра"} {
+		_, err := parseDate(cfg, s)
+		assert.ErrorContains(t, err, "invalid date", s)
+	}
+}
+
+func TestRunLocal(t *testing.T) {
+	dir := setupEnv(t)
+	path := createDB(t, dir)
+	future := time.Now().AddDate(0, 0, 10)
+
+	// Таблица с датой в формате строки поиска, с -json - задача целиком
+	out, err := todo(t, "-db", path, "add", "-date", future.Format("02.01.2006"), "-comment", "к 10:00", "-repeat", "d 7", "Сходить", "к", "врачу")
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	require.Len(t, lines, 2)
+	assert.Equal(t, []string{"ID", "ДАТА", "ЗАГОЛОВОК", "ПОВТОР", "КОММЕНТАРИЙ"}, strings.Fields(lines[0]))
+	assert.Contains(t, lines[1], future.Format("02.01.2006"))
+	assert.Contains(t, lines[1], "Сходить к врачу")
+	assert.Contains(t, lines[1], "к 10:00")
+
+	var task app.Task
+	out, err = todo(t, "-db", path, "-json", "add", "Купить", "хлеб")
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal([]byte(out), &task))
+	assert.Equal(t, "Купить хлеб", task.Title)
+	assert.Equal(t, time.Now().Format(config.DBDateFormat), task.Date)
+
+	var tasks []app.Task
+	out, err = todo(t, "-db", path, "-json", "list")
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal([]byte(out), &tasks))
+	require.Len(t, tasks, 2)
+	doctor := tasks[1]
+	assert.Equal(t, "Сходить к врачу", doctor.Title)
+
+	// Поиск по строке и по дате в любом из форматов
+	for _, query := range []string{"врач", future.Format(config.DBDateFormat), future.Format("02.01.2006")} {
+		out, err = todo(t, "-db", path, "-json", "search", query)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal([]byte(out), &tasks))
+		require.Len(t, tasks, 1, query)
+		assert.Equal(t, doctor.ID, tasks[0].ID, query)
+	}
+
+	// edit меняет только указанные флагами поля, пустое значение очищает поле
+	out, err = todo(t, "-db", path, "-json", "edit", doctor.ID, "-title", "Сходить к стоматологу", "-repeat", "")
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal([]byte(out), &task))
+	assert.Equal(t, app.Task{ID: doctor.ID, Date: doctor.Date, Title: "Сходить к стоматологу", Comment: "к 10:00"}, task)
+	out, err = todo(t, "-db", path, "-json", "edit", doctor.ID, "-date", future.AddDate(0, 0, 1).Format(config.DBDateFormat))
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal([]byte(out), &task))
+	assert.Equal(t, future.AddDate(0, 0, 1).Format(config.DBDateFormat), task.Date)
+	for args, message := range map[string]string{
+		doctor.ID:                   "nothing to change",
+		doctor.ID + " -date завтра": "invalid date",
+		doctor.ID + " -title":       "flag needs an argument",
+		doctor.ID + " -title X Y":   "unexpected arguments",
+		"999999 -title X":           "coudn't find task.id=999999",
+	} {
+		_, err = todo(t, append([]string{"-db", path, "edit"}, strings.Fields(args)...)...)
+		assert.ErrorContains(t, err, message, args)
+	}
+
+	// Выполнение повторяющейся задачи переносит ее, остальные удаляются
+	out, err = todo(t, "-db", path, "add", "-repeat", "d 2", "Полить цветы")
+	require.NoError(t, err)
+	out, err = todo(t, "-db", path, "-json", "search", "цветы")
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal([]byte(out), &tasks))
+	require.Len(t, tasks, 1)
+	date, err := time.Parse(config.DBDateFormat, tasks[0].Date)
+	require.NoError(t, err)
+	out, err = todo(t, "-db", path, "done", tasks[0].ID)
+	require.NoError(t, err)
+	assert.Contains(t, out, "следующая дата "+date.AddDate(0, 0, 2).Format("02.01.2006"))
+	out, err = todo(t, "-db", path, "-json", "done", doctor.ID)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"id":"`+doctor.ID+`"}`, out)
+	out, err = todo(t, "-db", path, "rm", tasks[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Задача "+tasks[0].ID+" удалена\n", out)
+	_, err = todo(t, "-db", path, "rm", tasks[0].ID)
+	assert.ErrorContains(t, err, "rm:")
+
+	// Выгрузка в stdout и в файл, формат которого определяется по расширению
+	out, err = todo(t, "-db", path, "export", "-format", "csv")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(out, "id,date,title,comment,repeat,list\n"), out)
+	assert.Contains(t, out, "Купить хлеб")
+	ics := filepath.Join(dir, "tasks.ics")
+	_, err = todo(t, "-db", path, "export", "-o", ics)
+	require.NoError(t, err)
+	data, err := os.ReadFile(ics)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(data), "BEGIN:VCALENDAR"))
+	_, err = todo(t, "-db", path, "export", "-format", "xml")
+	assert.ErrorContains(t, err, "unsupported format")
+
+	// Загрузка: повторы и ошибки выводятся построчно, в режиме проверки задачи не создаются
+	csv := filepath.Join(dir, "tasks.csv")
+	require.NoError(t, os.WriteFile(csv, []byte("title,date\nКупить хлеб,"+time.Now().Format(config.DBDateFormat)+"\nНовая,\n,20240101\n"), 0644))
+	out, err = todo(t, "-db", path, "import", "-dry-run", csv)
+	require.NoError(t, err)
+	assert.Contains(t, out, "уже есть задача")
+	assert.Contains(t, out, "ошибка: Error, Task.Title is empty")
+	assert.Contains(t, out, "Формат csv. Будет создано задач: 1, уже есть: 1, с ошибками: 1")
+	out, err = todo(t, "-db", path, "import", csv)
+	require.NoError(t, err)
+	assert.Contains(t, out, "Создано задач: 1")
+	out, err = todo(t, "-db", path, "-json", "list")
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal([]byte(out), &tasks))
+	assert.Len(t, tasks, 2)
+}
+
+func TestRunCommands(t *testing.T) {
+	setupEnv(t)
+
+	// next не обращается ни к базе, ни к серверу
+	out, err := todo(t, "next", "-now", "26.01.2024", "20240126", "d 5")
+	require.NoError(t, err)
+	assert.Equal(t, "31.01.2024\n", out)
+	out, err = todo(t, "-json", "next", "-now", "20240126", "20240126", "m 1")
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"date":"20240201"}`, out)
+	_, err = todo(t, "next", "20240126", "x 1")
+	assert.ErrorIs(t, err, app.ErrValidation)
+
+	out, err = todo(t, "-h")
+	assert.NoError(t, err)
+	assert.Empty(t, out, "справка выводится в stderr")
+	_, err = todo(t)
+	assert.ErrorContains(t, err, "command required")
+	_, err = todo(t, "-unknown", "list")
+	assert.Error(t, err)
+
+	// Без сервера используется база из настроек, которой нет
+	_, err = todo(t, "list")
+	assert.ErrorContains(t, err, "missing.db not found")
+	path := createDB(t, t.TempDir())
+	_, err = todo(t, "-db", path, "rename", "1")
+	assert.ErrorContains(t, err, `unknown command "rename"`)
+	_, err = todo(t, "-db", path, "list", "врач")
+	assert.ErrorContains(t, err, "use search")
+	_, err = todo(t, "-db", path, "done")
+	assert.ErrorContains(t, err, "task id required")
+	_, err = todo(t, "-db", path, "add")
+	assert.ErrorContains(t, err, "title required")
+}
+
+func TestRunServer(t *testing.T) {
+	dir := setupEnv(t)
+	t.Setenv("TODO_PASSWORD", "123321")
+	t.Setenv("TODO_TOKEN_TTL", "3s")
+	srv := startServer(t)
+	t.Setenv("TODO_PASSWORD", "")
+
+	_, err := todo(t, "login", "-password", "123321")
+	assert.ErrorContains(t, err, "server required")
+	_, err = todo(t, "-server", srv.URL, "login", "-password", "wrong")
+	assert.ErrorIs(t, err, app.ErrUnauthorized)
+
+	// После входа сервер и токен сохраняются в файл, доступный только владельцу
+	_, err = todo(t, "-server", srv.URL, "login", "-password", "123321")
+	require.NoError(t, err)
+	path := filepath.Join(dir, "todo", "credentials.json")
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	creds, err := loadCredentials()
+	require.NoError(t, err)
+	assert.Equal(t, srv.URL, creds.Server)
+	assert.NotEmpty(t, creds.Token)
+
+	// Следующие команды работают с сохраненным сервером
+	out, err := todo(t, "add", "Задача на сервере")
+	require.NoError(t, err)
+	assert.Contains(t, out, "Задача на сервере")
+
+	// Через половину срока действия токен обменивается на новый, старый больше не принимается
+	time.Sleep(1600 * time.Millisecond)
+	out, err = todo(t, "list")
+	require.NoError(t, err)
+	assert.Contains(t, out, "Задача на сервере")
+	refreshed, err := loadCredentials()
+	require.NoError(t, err)
+	assert.NotEqual(t, creds.Token, refreshed.Token)
+	_, err = client.New(srv.URL, creds.Token, nil).GetTaskList(context.Background(), "")
+	assert.ErrorIs(t, err, app.ErrUnauthorized)
+	_, err = client.New(srv.URL, refreshed.Token, nil).GetTaskList(context.Background(), "")
+	assert.NoError(t, err)
+
+	// Токен, срок которого истек, не обменивается
+	time.Sleep(3100 * time.Millisecond)
+	_, err = todo(t, "list")
+	assert.ErrorContains(t, err, "todo login")
+
+	// Токен из TODO_TOKEN не обменивается и не сохраняется
+	t.Setenv(tokenEnv, "todo_unknown")
+	_, err = todo(t, "list")
+	assert.ErrorIs(t, err, app.ErrUnauthorized)
+	t.Setenv(tokenEnv, "")
+
+	require.NoError(t, func() error { _, err := todo(t, "logout"); return err }())
+	_, err = os.Stat(path)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	_, err = todo(t, "logout")
+	assert.NoError(t, err)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"go_final_project/internal/app"
+	"go_final_project/internal/config"
+	"go_final_project/internal/importer"
+)
+
+// Выводит задачи таблицей, а с флагом -json - значение v в формате JSON
+func printTasks(opts options, tasks []app.Task, v any) error {
+	if opts.json {
+		return printJSON(opts, v)
+	}
+
+	w := tabwriter.NewWriter(opts.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tДАТА\tЗАГОЛОВОК\tПОВТОР\tКОММЕНТАРИЙ")
+	for _, task := range tasks {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", task.ID, formatDate(opts.cfg, task.Date), task.Title, task.Repeat, task.Comment)
+	}
+	return w.Flush()
+}
+
+// Выводит итог импорта: записи, которые не были созданы, и общее число созданных, совпавших и ошибочных
+func printImport(opts options, report importer.Report) error {
+	if opts.json {
+		return printJSON(opts, report)
+	}
+
+	w := tabwriter.NewWriter(opts.out, 0, 4, 2, ' ', 0)
+	for _, result := range report.Results {
+		switch {
+		case result.Error != nil:
+			fmt.Fprintf(w, "%d\t%s\tошибка: %s\n", result.Row, result.Title, result.Error.Error)
+		case result.Status == app.ImportDuplicate && len(result.ID) == 0:
+			fmt.Fprintf(w, "%d\t%s\tповторяется в файле\n", result.Row, result.Title)
+		case result.Status == app.ImportDuplicate:
+			fmt.Fprintf(w, "%d\t%s\tуже есть задача %s\n", result.Row, result.Title, result.ID)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	created := "Создано"
+	if report.DryRun {
+		created = "Будет создано"
+	}
+	return printLine(opts, "Формат %s. %s задач: %d, уже есть: %d, с ошибками: %d", report.Format, created, report.Created, report.Duplicates, report.Invalid)
+}
+
+func printJSON(opts options, v any) error {
+	encoder := json.NewEncoder(opts.out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+func printLine(opts options, format string, args ...any) error {
+	_, err := fmt.Fprintf(opts.out, format+"\n", args...)
+	return err
+}
+
+// Дата из базы в формате строки поиска, привычном пользователю
+func formatDate(cfg *config.Handler, date string) string {
+	t, err := time.Parse(config.DBDateFormat, date)
+	if err != nil {
+		return date
+	}
+	return t.Format(cfg.SearchDateFormat())
+}
@@ -3,11 +3,13 @@ module go_final_project
 go 1.22.2
 
 require (
+	github.com/BurntSushi/toml v1.4.0
 	github.com/golang-jwt/jwt/v5 v5.2.1
 	github.com/jmoiron/sqlx v1.4.0
 	github.com/mattn/go-sqlite3 v1.14.23
 	github.com/multiprocessio/go-sqlite3-stdlib v0.0.0-20220822170115-9f6825a1cd25
 	github.com/stretchr/testify v1.9.0
+	gopkg.in/yaml.v3 v3.0.1
 	modernc.org/libc v1.55.3
 )
 
@@ -19,5 +21,4 @@ require (
 	golang.org/x/exp v0.0.0-20231108232855-2478ac86f678 // indirect
 	golang.org/x/sys v0.22.0 // indirect
 	gonum.org/v1/gonum v0.11.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -1,7 +1,9 @@
 package app
 
 import (
+	"context"
 	"fmt"
+	"math"
 	"strconv"
 	"time"
 
@@ -10,17 +12,24 @@ import (
 
 type Application struct {
 	storage Storage
+	cfg     *config.Handler
 }
 
-func CreateApplication(storage Storage) *Application {
-	return &Application{storage: storage}
+func CreateApplication(storage Storage, cfg *config.Handler) *Application {
+	return &Application{storage: storage, cfg: cfg}
+}
+
+// Application, работающий в транзакции storage, которую Storage.WithTx передает в fn: так изменения задач
+// сохраняются вместе с данными других пакетов в той же транзакции
+func (app Application) InTx(storage Storage) *Application {
+	return &Application{storage: storage, cfg: app.cfg}
 }
 
 // Принимает текущее время now, предыдущую установленную дату задачи date, правило повторения repeat и возвращает новую дату
 func (app Application) NextDate(now, date, repeat string) (string, error) {
 	t, err := time.Parse(config.DBDateFormat, now)
 	if err != nil {
-		return "", fmt.Errorf("Application.NextDate: %w", err)
+		return "", fmt.Errorf("Application.NextDate: %w", ValidationError("now", "invalid now format: %v", err))
 	}
 
 	next, err := NextDate(t, date, repeat)
@@ -33,7 +42,10 @@ func (app Application) NextDate(now, date, repeat string) (string, error) {
 // Проверка полученной задачи на соответствие всем необходимым условиям
 func (app Application) CheckTask(task Task) (Task, error) {
 	if len(task.Title) == 0 {
-		return task, fmt.Errorf("Application.CheckTask: Error, Task.Title is empty ")
+		return task, fmt.Errorf("Application.CheckTask: %w", ValidationError("title", "Error, Task.Title is empty"))
+	}
+	if err := CheckList(task.List); err != nil {
+		return task, fmt.Errorf("Application.CheckTask: %w", err)
 	}
 
 	now := time.Now()
@@ -44,7 +56,7 @@ func (app Application) CheckTask(task Task) (Task, error) {
 
 	date, err := time.Parse(config.DBDateFormat, task.Date)
 	if err != nil {
-		return task, fmt.Errorf("Application.CheckTask: Task.Date has Invalid format ")
+		return task, fmt.Errorf("Application.CheckTask: %w", ValidationError("date", "Task.Date has Invalid format"))
 	}
 
 	var nextDate string
@@ -65,86 +77,159 @@ func (app Application) CheckTask(task Task) (Task, error) {
 	return task, nil
 }
 
-// Добавляет новую задачу и возвращает её id
-func (app Application) AddTask(task Task) (int64, error) {
+// Проверяет имя списка задач, в котором создается задача
+func CheckList(list string) error {
+	if list == AllLists {
+		return ValidationError("list", "list %q is reserved for all lists", AllLists)
+	}
+	if len(list) > maxListLen {
+		return ValidationError("list", "list name is longer than %d bytes", maxListLen)
+	}
+	return nil
+}
+
+// Добавляет новую задачу и возвращает её в том виде, в котором она сохранена, с id и версией
+func (app Application) AddTask(ctx context.Context, task Task) (Task, error) {
 	task, err := app.CheckTask(task)
 	if err != nil {
-		return -1, err
+		return Task{}, err
 	}
 
-	return app.storage.AddTask(task)
+	err = app.storage.WithTx(ctx, func(storage Storage) error {
+		id, err := storage.AddTask(ctx, task)
+		if err != nil {
+			return err
+		}
+		task.ID = strconv.FormatInt(id, 10)
+		task.Version = 1
+		return addEvent(ctx, storage, Event{Type: EventTaskCreated, Task: task})
+	})
+	if err != nil {
+		return Task{}, err
+	}
+	return task, nil
 }
 
 // Возвращает задачу по её id
-func (app Application) GetTask(id string) (Task, error) {
+func (app Application) GetTask(ctx context.Context, id string) (Task, error) {
 	if len(id) == 0 {
-		return Task{}, fmt.Errorf("Application.GetTask: id not setted")
+		return Task{}, fmt.Errorf("Application.GetTask: %w", ValidationError("id", "id not setted"))
 	}
 	_, err := strconv.Atoi(id)
 	if err != nil {
-		return Task{}, fmt.Errorf("Application.GetTask: invalid id : %v", err)
+		return Task{}, fmt.Errorf("Application.GetTask: %w", ValidationError("id", "invalid id : %v", err))
 	}
-	return app.storage.GetTaskByID(id)
+	return app.storage.GetTaskByID(ctx, id)
 }
 
-// Меняет содержимое задачи по id, указанному в переданной структуре
-func (app Application) UpdateTask(task Task) error {
+// Меняет содержимое задачи по id, указанному в переданной структуре.
+// Если task.Version не 0, задача меняется только если её версия с тех пор не изменилась.
+// Возвращает задачу в том виде, в котором она сохранена, с новой версией
+func (app Application) UpdateTask(ctx context.Context, task Task) (Task, error) {
 	_, err := strconv.Atoi(task.ID)
 	if err != nil {
-		return fmt.Errorf("Application.UpdateTask : invalid task.ID=%s ", task.ID)
+		return Task{}, fmt.Errorf("Application.UpdateTask : %w", ValidationError("id", "invalid task.ID=%s", task.ID))
 	}
 
 	task, err = app.CheckTask(task)
 	if err != nil {
-		return err
+		return Task{}, err
 	}
-	return app.storage.UpdateTask(task)
-}
-
-// Удаляет задачу по id
-func (app Application) RemoveTask(id string) error {
-	_, err := app.storage.GetTaskByID(id)
+	err = app.storage.WithTx(ctx, func(storage Storage) error {
+		// Список задачи не меняется: права на изменение проверены в ее текущем списке
+		stored, err := storage.GetTaskByID(ctx, task.ID)
+		if err != nil {
+			return err
+		}
+		task.List = stored.List
+		if err := storage.UpdateTask(ctx, task); err != nil {
+			return err
+		}
+		// Версия прочитана в этой же транзакции, и UpdateTask увеличил ее на единицу
+		task.Version = stored.Version + 1
+		return addEvent(ctx, storage, Event{Type: EventTaskUpdated, Task: task})
+	})
 	if err != nil {
-		return fmt.Errorf("Application.TaskDone : %v", err)
+		return Task{}, err
 	}
-
-	return app.storage.RemoveTask(id)
+	return task, nil
 }
 
-// Отмечает задачу по её id как завершенную (удаляет при отсутствии правила повторения или переносит при наличии такого правила
-func (app Application) FinishTask(id string) error {
-	task, err := app.storage.GetTaskByID(id)
-	if err != nil {
-		return fmt.Errorf("Application.FinishTask : %v", err)
+// Удаляет задачу по id. Если version не 0, задача удаляется только при совпадении версий
+func (app Application) RemoveTask(ctx context.Context, id string, version int64) error {
+	if _, err := strconv.Atoi(id); err != nil {
+		return fmt.Errorf("Application.RemoveTask : %w", ValidationError("id", "invalid id=%s", id))
 	}
 
-	if len(task.Repeat) == 0 {
-		app.storage.RemoveTask(id)
-		return nil
+	err := app.storage.WithTx(ctx, func(storage Storage) error {
+		task, err := storage.GetTaskByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		if version != 0 && version != task.Version {
+			return PreconditionError("task.id=%s has been modified", id)
+		}
+		if err := storage.RemoveTask(ctx, id, version); err != nil {
+			return err
+		}
+		return addEvent(ctx, storage, Event{Type: EventTaskDeleted, Task: task})
+	})
+	if err != nil {
+		return fmt.Errorf("Application.RemoveTask : %w", err)
 	}
+	return nil
+}
 
-	task.Date, err = NextDate(time.Now(), task.Date, task.Repeat)
-	if err != nil {
-		return fmt.Errorf("Application.FinishTask : %v", err)
+// Отмечает задачу по её id как завершенную (удаляет при отсутствии правила повторения или переносит при наличии такого правила.
+// Если version не 0, задача завершается только при совпадении версий
+func (app Application) FinishTask(ctx context.Context, id string, version int64) error {
+	if _, err := strconv.Atoi(id); err != nil {
+		return fmt.Errorf("Application.FinishTask : %w", ValidationError("id", "invalid id=%s", id))
 	}
 
-	err = app.storage.UpdateTask(task)
+	err := app.storage.WithTx(ctx, func(storage Storage) error {
+		task, err := storage.GetTaskByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		if version != 0 && version != task.Version {
+			return PreconditionError("task.id=%s has been modified", id)
+		}
+
+		event := Event{Type: EventTaskCompleted, Task: task}
+		if len(task.Repeat) == 0 {
+			if err := storage.RemoveTask(ctx, id, task.Version); err != nil {
+				return err
+			}
+			return addEvent(ctx, storage, event)
+		}
+
+		task.Date, err = NextDate(time.Now(), task.Date, task.Repeat)
+		if err != nil {
+			return err
+		}
+		if err := storage.UpdateTask(ctx, task); err != nil {
+			return err
+		}
+		event.NextDate = task.Date
+		return addEvent(ctx, storage, event)
+	})
 	if err != nil {
-		return fmt.Errorf("Application.FinishTask : %v", err)
+		return fmt.Errorf("Application.FinishTask : %w", err)
 	}
 	return nil
 }
 
-// Возвращает слайс задач максимальной длиной maxLen, удовлетворяющих по названию, комментарию или дате фильтру searchString.
-func (app Application) GetTaskList(searchString string, maxLen int64) ([]Task, error) {
-	date, err := time.Parse(config.WebDateFormat, searchString)
+// Возвращает слайс задач списка list максимальной длиной maxLen, удовлетворяющих по названию, комментарию или дате фильтру searchString.
+func (app Application) GetTaskList(ctx context.Context, list, searchString string, maxLen int64) ([]Task, error) {
+	date, err := time.Parse(app.cfg.SearchDateFormat(), searchString)
 	if err == nil {
 		searchString = date.Format(config.DBDateFormat)
 	}
 
-	tasks, err := app.storage.GetTaskList(searchString, maxLen)
+	tasks, err := app.storage.GetTaskList(ctx, list, searchString, maxLen)
 	if err != nil {
-		return nil, fmt.Errorf("Application.GetTaskList: %v", err)
+		return nil, fmt.Errorf("Application.GetTaskList: %w", err)
 	}
 
 	if len(tasks) == 0 {
@@ -152,3 +237,15 @@ func (app Application) GetTaskList(searchString string, maxLen int64) ([]Task, e
 	}
 	return tasks, nil
 }
+
+// Возвращает все задачи списка list, отсортированные по дате, без ограничения TaskListLimit: для выгрузки и проверки базы
+func (app Application) AllTasks(ctx context.Context, list string) ([]Task, error) {
+	tasks, err := app.storage.GetTaskList(ctx, list, "", math.MaxInt64)
+	if err != nil {
+		return nil, fmt.Errorf("Application.AllTasks: %w", err)
+	}
+	if len(tasks) == 0 {
+		return make([]Task, 0), nil
+	}
+	return tasks, nil
+}
@@ -0,0 +1,104 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Действия, которые можно выполнить в пакетном запросе
+const (
+	BatchCreate   = "create"
+	BatchUpdate   = "update"
+	BatchDelete   = "delete"
+	BatchComplete = "complete"
+)
+
+// Отменяет транзакцию пакета в режиме atomic, ошибка операции при этом уже записана в ее результат
+var errBatchAborted = errors.New("batch aborted")
+
+// Одна операция пакетного запроса. Version, если не 0, работает так же, как заголовок If-Match
+type BatchOp struct {
+	Op      string `json:"op"`
+	ID      string `json:"id"`
+	Task    Task   `json:"task"`
+	Version int64  `json:"version"`
+}
+
+// Результат операции пакетного запроса. Err равна nil, если операция выполнена
+type BatchResult struct {
+	Op  string
+	ID  string
+	Err error
+}
+
+// Выполняет операции ops в одной транзакции и возвращает результат каждой из них.
+// В режиме atomic первая неудачная операция отменяет весь пакет, иначе неудачные операции пропускаются,
+// а остальные сохраняются. Внутренняя ошибка хранилища всегда отменяет весь пакет.
+// Второе возвращаемое значение сообщает, сохранены ли изменения
+func (app Application) Batch(ctx context.Context, ops []BatchOp, atomic bool) ([]BatchResult, bool, error) {
+	if len(ops) == 0 {
+		return nil, false, fmt.Errorf("Application.Batch: %w", ValidationError("operations", "operations are empty"))
+	}
+	if len(ops) > app.cfg.BatchMaxOps() {
+		return nil, false, fmt.Errorf("Application.Batch: %w", ValidationError("operations", "batch can't contain more than %d operations", app.cfg.BatchMaxOps()))
+	}
+
+	results := make([]BatchResult, 0, len(ops))
+	err := app.storage.WithTx(ctx, func(storage Storage) error {
+		txApp := app.InTx(storage)
+		for _, op := range ops {
+			result := txApp.applyBatchOp(ctx, op)
+			results = append(results, result)
+			if result.Err == nil {
+				continue
+			}
+
+			if ErrorCode(result.Err) == CodeInternal {
+				return result.Err
+			}
+			if atomic {
+				return errBatchAborted
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, errBatchAborted) {
+		return results, false, nil
+	} else if err != nil {
+		return results, false, fmt.Errorf("Application.Batch: %w", err)
+	}
+	return results, true, nil
+}
+
+func (app Application) applyBatchOp(ctx context.Context, op BatchOp) BatchResult {
+	result := BatchResult{Op: op.Op, ID: op.ID}
+
+	switch op.Op {
+	case BatchCreate:
+		task, err := app.AddTask(ctx, op.Task)
+		if err == nil {
+			result.ID = task.ID
+		}
+		result.Err = err
+
+	case BatchUpdate:
+		task := op.Task
+		if len(op.ID) > 0 {
+			task.ID = op.ID
+		}
+		task.Version = op.Version
+		result.ID = task.ID
+		_, result.Err = app.UpdateTask(ctx, task)
+
+	case BatchDelete:
+		result.Err = app.RemoveTask(ctx, op.ID, op.Version)
+
+	case BatchComplete:
+		result.Err = app.FinishTask(ctx, op.ID, op.Version)
+
+	default:
+		result.Err = ValidationError("op", "op must be %s, %s, %s or %s", BatchCreate, BatchUpdate, BatchDelete, BatchComplete)
+	}
+	return result
+}
@@ -0,0 +1,37 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go_final_project/internal/config"
+)
+
+// Сохраненная задача, которая не прошла бы проверку при создании
+type InvalidTask struct {
+	Task Task
+	Err  error
+}
+
+// Проверяет все сохраненные задачи: дату, заголовок и правило повторения. Возвращает задачи с ошибками
+func (app Application) CheckTasks(ctx context.Context) ([]InvalidTask, error) {
+	tasks, err := app.AllTasks(ctx, AllLists)
+	if err != nil {
+		return nil, fmt.Errorf("Application.CheckTasks: %w", err)
+	}
+
+	var invalid []InvalidTask
+	for _, task := range tasks {
+		// CheckTask подставляет сегодняшнюю дату вместо пустой, а в базе дата должна быть записана
+		date, err := time.Parse(config.DBDateFormat, task.Date)
+		if err != nil || date.Format(config.DBDateFormat) != task.Date {
+			invalid = append(invalid, InvalidTask{Task: task, Err: ValidationError("date", "invalid date %q", task.Date)})
+			continue
+		}
+		if _, err := app.CheckTask(task); err != nil {
+			invalid = append(invalid, InvalidTask{Task: task, Err: err})
+		}
+	}
+	return invalid, nil
+}
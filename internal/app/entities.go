@@ -1,22 +1,62 @@
 package app
 
+import "context"
+
 type Storage interface {
-	AddTask(task Task) (int64, error)
-	GetTaskByID(id string) (Task, error)
-	GetTaskList(searchString string, maxLen int64) ([]Task, error)
-	UpdateTask(task Task) error
-	RemoveTask(id string) error
-	FindTask(title, date string) (string, error)
+	AddTask(ctx context.Context, task Task) (int64, error)
+	GetTaskByID(ctx context.Context, id string) (Task, error)
+	// Возвращает задачи списка list, AllLists - задачи всех списков
+	GetTaskList(ctx context.Context, list, searchString string, maxLen int64) ([]Task, error)
+	UpdateTask(ctx context.Context, task Task) error
+	RemoveTask(ctx context.Context, id string, version int64) error
+	FindTask(ctx context.Context, list, title, date string) (string, error)
+	// Ставит событие в очередь отправки вебхукам, подписанным на его тип
+	AddEvent(ctx context.Context, event Event) error
+	// Выполняет fn в одной транзакции: изменения сохраняются, только если fn не вернула ошибку
+	WithTx(ctx context.Context, fn func(Storage) error) error
 }
 
+// Списки задач, в которых пользователям назначаются роли
+const (
+	DefaultList = ""  // список задач, созданных без указания списка
+	AllLists    = "*" // все списки сразу: при выборке задач и при назначении роли
+
+	maxListLen = 64
+)
+
 type Task struct {
 	ID      string `json:"id"`
 	Date    string `json:"date"`
 	Title   string `json:"title"`
 	Comment string `json:"comment"`
 	Repeat  string `json:"repeat"`
+	List    string `json:"list,omitempty"` // задается при создании задачи и потом не меняется
+	Version int64  `json:"-"`              // увеличивается при каждом изменении, отдается клиентам в ETag
 }
 
 type TaskList struct {
 	List []Task `json:"tasks"`
 }
+
+// Именованный API-ключ для скриптов и интеграций. Сам ключ не хранится, хранится только его хэш
+type APIKey struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Scope   string `json:"scope"`
+	Created string `json:"created"`
+}
+
+// Локальный пользователь, сопоставленный с учетной записью OpenID Connect провайдера
+type User struct {
+	ID      string `json:"id"`
+	Issuer  string `json:"issuer"`
+	Subject string `json:"subject"`
+	Email   string `json:"email"`
+}
+
+// Назначенная пользователю роль в списке задач List, AllLists - во всех списках
+type RoleBinding struct {
+	Subject string `json:"subject"`
+	List    string `json:"list"`
+	Role    string `json:"role"`
+}
@@ -0,0 +1,99 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Машиночитаемый код ошибки, по которому api выбирает HTTP-статус ответа
+type Code string
+
+const (
+	CodeValidation   Code = "validation_error"
+	CodeNotFound     Code = "not_found"
+	CodeConflict     Code = "conflict"
+	CodeUnauthorized Code = "unauthorized"
+	CodePrecondition Code = "precondition_failed"
+	CodeTimeout      Code = "timeout"
+	CodeInternal     Code = "internal_error"
+)
+
+// Ошибка предметной области. Оборачивается через %w, поэтому код можно получить из любой цепочки ошибок
+type Error struct {
+	Code    Code
+	Message string
+	Fields  map[string]string // описание ошибок по полям задачи
+}
+
+// Ошибки для сравнения через errors.Is: совпадают с любой ошибкой того же кода
+var (
+	ErrValidation   = &Error{Code: CodeValidation, Message: "validation error"}
+	ErrNotFound     = &Error{Code: CodeNotFound, Message: "not found"}
+	ErrConflict     = &Error{Code: CodeConflict, Message: "conflict"}
+	ErrUnauthorized = &Error{Code: CodeUnauthorized, Message: "unauthorized"}
+	ErrPrecondition = &Error{Code: CodePrecondition, Message: "precondition failed"}
+)
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// Ошибка в значении поля field
+func ValidationError(field, format string, args ...any) *Error {
+	msg := fmt.Sprintf(format, args...)
+	return &Error{Code: CodeValidation, Message: msg, Fields: map[string]string{field: msg}}
+}
+
+func NotFoundError(format string, args ...any) *Error {
+	return &Error{Code: CodeNotFound, Message: fmt.Sprintf(format, args...)}
+}
+
+func ConflictError(format string, args ...any) *Error {
+	return &Error{Code: CodeConflict, Message: fmt.Sprintf(format, args...)}
+}
+
+// Задача изменилась с тех пор, как клиент ее получил
+func PreconditionError(format string, args ...any) *Error {
+	return &Error{Code: CodePrecondition, Message: fmt.Sprintf(format, args...)}
+}
+
+// Возвращает код ошибки из цепочки err, CodeTimeout для отмененных и не уложившихся во время запросов,
+// CodeInternal для прочих ошибок
+func ErrorCode(err error) Code {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return CodeTimeout
+	}
+	return CodeInternal
+}
+
+// Возвращает сообщение ошибки предметной области из цепочки err без префиксов вызывающих функций.
+// Подробности прочих ошибок не раскрываются клиентам
+func ErrorMessage(err error) string {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Message
+	}
+	if ErrorCode(err) == CodeTimeout {
+		return "request timed out"
+	}
+	return "internal server error"
+}
+
+// Возвращает описание ошибок по полям из цепочки err
+func ErrorFields(err error) map[string]string {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Fields
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package app
+
+import (
+	"context"
+	"time"
+)
+
+// События жизненного цикла задачи, о которых сообщают вебхуки
+const (
+	EventTaskCreated   = "task.created"
+	EventTaskUpdated   = "task.updated"
+	EventTaskCompleted = "task.completed"
+	EventTaskDeleted   = "task.deleted"
+)
+
+var Events = []string{EventTaskCreated, EventTaskUpdated, EventTaskCompleted, EventTaskDeleted}
+
+// Событие задачи. Task - задача после изменения, а для удаления и выполнения - задача до них.
+// NextDate заполняется, когда выполненная задача с правилом повторения переносится на новую дату
+type Event struct {
+	Type     string    `json:"event"`
+	Time     time.Time `json:"time"`
+	Task     Task      `json:"task"`
+	NextDate string    `json:"next_date,omitempty"`
+}
+
+// Сохраняет событие в той же транзакции, что и изменение задачи, поэтому событие не теряется при сбое
+// и не отправляется, если изменение отменено
+func addEvent(ctx context.Context, storage Storage, event Event) error {
+	event.Time = time.Now().UTC().Truncate(time.Second)
+	return storage.AddEvent(ctx, event)
+}
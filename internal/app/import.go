@@ -0,0 +1,114 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+)
+
+// Итог импорта одной записи
+const (
+	ImportCreated   = "created"   // задача создана, в режиме проверки - была бы создана
+	ImportDuplicate = "duplicate" // задача с таким заголовком и датой уже есть
+	ImportInvalid   = "invalid"   // запись не прошла проверку
+)
+
+// Задача из импортируемого файла. Row - номер записи в файле, Err - ошибка ее разбора
+type ImportRow struct {
+	Row  int
+	Task Task
+	Err  error
+}
+
+// Результат импорта записи. ID - созданная или уже существующая задача
+type ImportResult struct {
+	Row    int
+	Status string
+	ID     string
+	Err    error
+}
+
+// Создает задачи из rows в списке list в одной транзакции. Каждая задача проверяется так же, как при создании через api,
+// а задачи с тем же заголовком и датой, что у существующих или уже импортированных, пропускаются.
+// Ошибочные записи не мешают импорту остальных. С dryRun база не меняется, а результаты показывают, что было бы сделано:
+// проверка только читает задачи, поэтому выполняется без транзакции и не ждет записи других запросов
+func (app Application) ImportTasks(ctx context.Context, list string, rows []ImportRow, dryRun bool) ([]ImportResult, error) {
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("Application.ImportTasks: %w", ValidationError("file", "no tasks to import"))
+	}
+	if len(rows) > app.cfg.ImportMaxRows() {
+		return nil, fmt.Errorf("Application.ImportTasks: %w", ValidationError("file", "can't import more than %d tasks at once", app.cfg.ImportMaxRows()))
+	}
+
+	results := make([]ImportResult, 0, len(rows))
+	importRows := func(storage Storage) error {
+		txApp := app.InTx(storage)
+		seen := make(map[[2]string]bool) // заголовок и дата задач, которые были бы созданы в режиме проверки
+		for _, row := range rows {
+			// Список из файла не учитывается: права проверены только для list
+			row.Task.List = list
+			result, err := txApp.importRow(ctx, row, seen, dryRun)
+			if err != nil {
+				return err
+			}
+			results = append(results, result)
+		}
+		return nil
+	}
+	var err error
+	if dryRun {
+		err = importRows(app.storage)
+	} else {
+		err = app.storage.WithTx(ctx, importRows)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Application.ImportTasks: %w", err)
+	}
+	return results, nil
+}
+
+func (app Application) importRow(ctx context.Context, row ImportRow, seen map[[2]string]bool, dryRun bool) (ImportResult, error) {
+	result := ImportResult{Row: row.Row}
+	if row.Err != nil {
+		result.Status, result.Err = ImportInvalid, row.Err
+		return result, nil
+	}
+	task, err := app.CheckTask(row.Task)
+	if err != nil {
+		result.Status, result.Err = ImportInvalid, err
+		return result, nil
+	}
+
+	// Повторный импорт выгрузки находит задачи по записанной дате, а новые записи - по дате после проверки,
+	// которая переносит прошедшие даты
+	for _, date := range []string{row.Task.Date, task.Date} {
+		if len(date) == 0 {
+			continue
+		}
+		if seen[[2]string{task.Title, date}] {
+			result.Status = ImportDuplicate
+			return result, nil
+		}
+		id, err := app.storage.FindTask(ctx, task.List, task.Title, date)
+		if err != nil {
+			return result, err
+		}
+		if len(id) > 0 {
+			result.Status, result.ID = ImportDuplicate, id
+			return result, nil
+		}
+	}
+
+	seen[[2]string{task.Title, task.Date}] = true
+	result.Status = ImportCreated
+	if dryRun {
+		return result, nil
+	}
+	id, err := app.storage.AddTask(ctx, task)
+	if err != nil {
+		return result, err
+	}
+	result.ID = strconv.FormatInt(id, 10)
+	task.ID = result.ID
+	return result, addEvent(ctx, app.storage, Event{Type: EventTaskCreated, Task: task})
+}
@@ -16,12 +16,12 @@ import (
 func NextDate(now time.Time, date string, repeat string) (string, error) {
 	beginDate, err := time.Parse("20060102", date)
 	if err != nil {
-		return "", fmt.Errorf("nextDate: invalid date format: <%s>, %w", date, err)
+		return "", ValidationError("date", "nextDate: invalid date format: <%s>, %v", date, err)
 	}
 
 	repeatSlice := strings.Split(repeat, " ")
 	if len(repeatSlice) < 1 {
-		return "", fmt.Errorf("nextDate: invalid repeat format: <%s>, repeat is empty", repeat)
+		return "", ValidationError("repeat", "nextDate: invalid repeat format: <%s>, repeat is empty", repeat)
 	}
 
 	// Разбиваем на модификатор и значение
@@ -31,7 +31,7 @@ func NextDate(now time.Time, date string, repeat string) (string, error) {
 
 	case "y":
 		if len(repeatSlice) != 1 {
-			return "", fmt.Errorf("nextDate: invalid repeat format: [%s], a year cant have additional values", repeat)
+			return "", ValidationError("repeat", "nextDate: invalid repeat format: [%s], a year cant have additional values", repeat)
 		}
 
 		next := beginDate.AddDate(1, 0, 0)
@@ -42,16 +42,16 @@ func NextDate(now time.Time, date string, repeat string) (string, error) {
 
 	case "d":
 		if len(repeatSlice) != 2 {
-			return "", fmt.Errorf("nextDate: invalid repeat format: [%s], days must have only one additional value", repeat)
+			return "", ValidationError("repeat", "nextDate: invalid repeat format: [%s], days must have only one additional value", repeat)
 		}
 
 		days, err := strconv.ParseInt(repeatSlice[1], 10, 32)
 		if err != nil {
-			return "", fmt.Errorf("nextDate: invalid repeat format: [%s], %w", repeat, err)
+			return "", ValidationError("repeat", "nextDate: invalid repeat format: [%s], %v", repeat, err)
 		}
 
 		if days > 400 {
-			return "", fmt.Errorf("nextDate: invalid repeat format: [%s], days must be less than 400", repeat)
+			return "", ValidationError("repeat", "nextDate: invalid repeat format: [%s], days must be less than 400", repeat)
 		}
 
 		next := beginDate.AddDate(0, 0, int(days))
@@ -62,7 +62,7 @@ func NextDate(now time.Time, date string, repeat string) (string, error) {
 
 	case "w":
 		if len(repeatSlice) < 2 {
-			return "", fmt.Errorf("nextDate: invalid repeat format: [%s], a weekday must have one or more additional value", repeat)
+			return "", ValidationError("repeat", "nextDate: invalid repeat format: [%s], a weekday must have one or more additional value", repeat)
 		}
 		weekDaysStringList := strings.Split(repeatSlice[1], ",")
 
@@ -72,7 +72,7 @@ func NextDate(now time.Time, date string, repeat string) (string, error) {
 		for _, ds := range weekDaysStringList {
 			weekDay, err := strconv.ParseInt(ds, 10, 32)
 			if err != nil {
-				return "", fmt.Errorf("nextDate: invalid repeat format: [%s], %w", repeat, err)
+				return "", ValidationError("repeat", "nextDate: invalid repeat format: [%s], %v", repeat, err)
 			}
 
 			dt := now
@@ -81,7 +81,7 @@ func NextDate(now time.Time, date string, repeat string) (string, error) {
 			}
 			d, err := nextWeekDay(dt, int(weekDay))
 			if err != nil {
-				return "", fmt.Errorf("nextDate: invalid repeat format: [%s], %w", repeat, err)
+				return "", ValidationError("repeat", "nextDate: invalid repeat format: [%s], %v", repeat, err)
 			}
 
 			dif := d.Sub(now).Milliseconds()
@@ -95,7 +95,7 @@ func NextDate(now time.Time, date string, repeat string) (string, error) {
 
 	case "m":
 		if len(repeatSlice) < 2 {
-			return "", fmt.Errorf("nextDate: invalid repeat format: [%s], a monthday must have one or more additional value", repeat)
+			return "", ValidationError("repeat", "nextDate: invalid repeat format: [%s], a monthday must have one or more additional value", repeat)
 		}
 
 		dt := now
@@ -113,16 +113,16 @@ func NextDate(now time.Time, date string, repeat string) (string, error) {
 			for _, ds := range daysStringList {
 				day, err := strconv.ParseInt(ds, 10, 32)
 				if err != nil {
-					return "", fmt.Errorf("nextDate: invalid repeat format: [%s], %w", repeat, err)
+					return "", ValidationError("repeat", "nextDate: invalid repeat format: [%s], %v", repeat, err)
 				}
 
 				if day < -31 || day > 31 {
-					return "", fmt.Errorf("nextDate: invalid repeat format: [%s], monthDays must be between -31 and 31", repeat)
+					return "", ValidationError("repeat", "nextDate: invalid repeat format: [%s], monthDays must be between -31 and 31", repeat)
 				}
 
 				d, err := nextMonthDay(dt, int(day))
 				if err != nil {
-					return "", fmt.Errorf("nextDate: invalid repeat format: [%s], %w", repeat, err)
+					return "", ValidationError("repeat", "nextDate: invalid repeat format: [%s], %v", repeat, err)
 				}
 
 				dif := d.Sub(dt).Milliseconds()
@@ -140,16 +140,16 @@ func NextDate(now time.Time, date string, repeat string) (string, error) {
 			for _, ms := range monthStringList {
 				month, err := strconv.ParseInt(ms, 10, 32)
 				if err != nil {
-					return "", fmt.Errorf("nextDate: invalid repeat format: [%s], %w", repeat, err)
+					return "", ValidationError("repeat", "nextDate: invalid repeat format: [%s], %v", repeat, err)
 				}
 				for _, ds := range daysStringList {
 					day, err := strconv.ParseInt(ds, 10, 32)
 					if err != nil {
-						return "", fmt.Errorf("nextDate: invalid repeat format: [%s], %w", repeat, err)
+						return "", ValidationError("repeat", "nextDate: invalid repeat format: [%s], %v", repeat, err)
 					}
 					d, err := nextSpecifiedDay(dt, int(day), int(month))
 					if err != nil {
-						return "", fmt.Errorf("nextDate: invalid repeat format: [%s], %w", repeat, err)
+						return "", ValidationError("repeat", "nextDate: invalid repeat format: [%s], %v", repeat, err)
 					}
 					dif := d.Sub(dt).Milliseconds()
 					if dif < minDif {
@@ -161,7 +161,44 @@ func NextDate(now time.Time, date string, repeat string) (string, error) {
 			return closestDate.Format("20060102"), nil
 		}
 	}
-	return "", fmt.Errorf("nextDate: invalid repeat format: [%s], a modificator must be y,d,w, m", repeat)
+	return "", ValidationError("repeat", "nextDate: invalid repeat format: [%s], a modificator must be y,d,w, m", repeat)
+}
+
+// Возвращает даты задачи до until включительно: дату самой задачи и, при наличии правила повторения, следующие
+// за ней даты начиная с from, вычисленные так же, как при выполнении задачи. Даты возвращаются в формате 20060102,
+// не больше limit дат
+func Occurrences(task Task, from, until time.Time, limit int) ([]string, error) {
+	last := until.Format("20060102")
+	// NextDate возвращает дату не раньше now, поэтому просроченная задача сразу переходит к from
+	start := from.AddDate(0, 0, -1)
+	var dates []string
+	for date := task.Date; date <= last && len(dates) < limit; {
+		dates = append(dates, date)
+		if len(task.Repeat) == 0 {
+			break
+		}
+
+		current, err := time.Parse("20060102", date)
+		if err != nil {
+			return nil, ValidationError("date", "occurrences: invalid date format: <%s>, %v", date, err)
+		}
+		if current.Before(start) {
+			current = start
+		}
+		next, err := NextDate(current, date, task.Repeat)
+		if err == nil && next <= current.Format("20060102") {
+			// Для правила с месяцами NextDate может вернуть саму дату, тогда ищем со следующего дня
+			next, err = NextDate(current.AddDate(0, 0, 1), date, task.Repeat)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if next <= date {
+			break
+		}
+		date = next
+	}
+	return dates, nil
 }
 
 func monthLength(m time.Month) int {
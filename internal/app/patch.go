@@ -0,0 +1,100 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// Применяет к задаче id изменения в формате JSON Merge Patch (RFC 7396) и сохраняет результат.
+// Проверяется только итоговая задача, поэтому клиент может передать лишь изменившиеся поля.
+// Если version не 0, изменения применяются только к задаче этой версии
+func (app Application) PatchTask(ctx context.Context, id string, patch []byte, version int64) (Task, error) {
+	var patchValue any
+	if err := json.Unmarshal(patch, &patchValue); err != nil {
+		return Task{}, fmt.Errorf("Application.PatchTask: %w", ValidationError("patch", "invalid merge patch: %v", err))
+	}
+
+	var patched Task
+	err := app.storage.WithTx(ctx, func(storage Storage) error {
+		task, err := app.InTx(storage).GetTask(ctx, id)
+		if err != nil {
+			return err
+		}
+		if version != 0 && version != task.Version {
+			return PreconditionError("task.id=%s has been modified", id)
+		}
+
+		patched, err = app.applyPatch(task, patchValue)
+		if err != nil {
+			return err
+		}
+		if err := storage.UpdateTask(ctx, patched); err != nil {
+			return err
+		}
+		return addEvent(ctx, storage, Event{Type: EventTaskUpdated, Task: patched})
+	})
+	if err != nil {
+		return Task{}, fmt.Errorf("Application.PatchTask: %w", err)
+	}
+	patched.Version++
+	return patched, nil
+}
+
+// Возвращает задачу task с примененными изменениями patchValue, проверенную CheckTask
+func (app Application) applyPatch(task Task, patchValue any) (Task, error) {
+	original, err := json.Marshal(task)
+	if err != nil {
+		return Task{}, err
+	}
+	var target any
+	if err := json.Unmarshal(original, &target); err != nil {
+		return Task{}, err
+	}
+
+	merged, err := json.Marshal(mergePatch(target, patchValue))
+	if err != nil {
+		return Task{}, err
+	}
+
+	// Неизвестное поле, скорее всего, опечатка клиента: молча пропустить его значит потерять изменение
+	var patched Task
+	decoder := json.NewDecoder(bytes.NewReader(merged))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&patched); err != nil {
+		return Task{}, ValidationError("patch", "patched task is invalid: %v", err)
+	}
+	if len(patched.ID) > 0 && patched.ID != task.ID {
+		return Task{}, ValidationError("id", "task id can't be changed")
+	}
+	if patched.List != task.List {
+		return Task{}, ValidationError("list", "task list can't be changed")
+	}
+	patched.ID = task.ID
+	patched.Version = task.Version
+
+	return app.CheckTask(patched)
+}
+
+// Алгоритм MergePatch из RFC 7396: null удаляет поле, объекты сливаются рекурсивно, остальные значения заменяются
+func mergePatch(target, patch any) any {
+	patchObject, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+
+	targetObject, ok := target.(map[string]any)
+	if !ok {
+		targetObject = make(map[string]any)
+	}
+
+	for name, value := range patchObject {
+		if value == nil {
+			delete(targetObject, name)
+			continue
+		}
+		targetObject[name] = mergePatch(targetObject[name], value)
+	}
+	return targetObject
+}
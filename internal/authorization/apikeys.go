@@ -0,0 +1,108 @@
+package authorization
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"go_final_project/internal/app"
+)
+
+const (
+	ScopeRead      = "read"       // только чтение задач
+	ScopeReadWrite = "read-write" // чтение и изменение задач
+
+	apiKeyPrefix = "todo_"
+)
+
+type APIKey = app.APIKey
+
+type KeyStorage interface {
+	AddAPIKey(ctx context.Context, key APIKey, hash string) (int64, error)
+	GetAPIKeyByHash(ctx context.Context, hash string) (APIKey, error)
+	GetAPIKeyList(ctx context.Context) ([]APIKey, error)
+	RemoveAPIKey(ctx context.Context, id string) error
+}
+
+// Проверяет, разрешает ли область действия ключа запрос. read - запрос только читает данные
+func KeyAllows(key APIKey, read bool) bool {
+	switch key.Scope {
+	case ScopeReadWrite:
+		return true
+	case ScopeRead:
+		return read
+	}
+	return false
+}
+
+// Похожа ли строка на API-ключ (в отличие от JWT-токена)
+func IsAPIKey(s string) bool {
+	return strings.HasPrefix(s, apiKeyPrefix)
+}
+
+// Создает новый ключ и возвращает его описание вместе с самим ключом, который больше нигде не сохраняется
+func (auth *Handler) CreateAPIKey(ctx context.Context, name, scope string) (APIKey, string, error) {
+	if len(name) == 0 {
+		return APIKey{}, "", fmt.Errorf("authorization.Handler.CreateAPIKey: %w", app.ValidationError("name", "name is empty"))
+	}
+	if scope != ScopeRead && scope != ScopeReadWrite {
+		return APIKey{}, "", fmt.Errorf("authorization.Handler.CreateAPIKey: %w", app.ValidationError("scope", "scope must be %s or %s", ScopeRead, ScopeReadWrite))
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return APIKey{}, "", fmt.Errorf("authorization.Handler.CreateAPIKey: %v", err)
+	}
+	secret := apiKeyPrefix + hex.EncodeToString(b)
+
+	key := APIKey{
+		Name:    name,
+		Scope:   scope,
+		Created: time.Now().UTC().Format(time.RFC3339),
+	}
+	id, err := auth.keys.AddAPIKey(ctx, key, hashAPIKey(secret))
+	if err != nil {
+		return APIKey{}, "", fmt.Errorf("authorization.Handler.CreateAPIKey: %w", err)
+	}
+	key.ID = fmt.Sprint(id)
+	return key, secret, nil
+}
+
+// Возвращает описание ключа, если такой ключ существует
+func (auth *Handler) VerifyAPIKey(ctx context.Context, secret string) (APIKey, error) {
+	if !IsAPIKey(secret) {
+		return APIKey{}, fmt.Errorf("authorization.Handler.VerifyAPIKey: not an api key")
+	}
+	key, err := auth.keys.GetAPIKeyByHash(ctx, hashAPIKey(secret))
+	if err != nil {
+		return APIKey{}, fmt.Errorf("authorization.Handler.VerifyAPIKey: %v", err)
+	}
+	return key, nil
+}
+
+func (auth *Handler) APIKeyList(ctx context.Context) ([]APIKey, error) {
+	keys, err := auth.keys.GetAPIKeyList(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("authorization.Handler.APIKeyList: %v", err)
+	}
+	if len(keys) == 0 {
+		return make([]APIKey, 0), nil
+	}
+	return keys, nil
+}
+
+func (auth *Handler) RevokeAPIKey(ctx context.Context, id string) error {
+	if len(id) == 0 {
+		return fmt.Errorf("authorization.Handler.RevokeAPIKey: %w", app.ValidationError("id", "id not setted"))
+	}
+	return auth.keys.RemoveAPIKey(ctx, id)
+}
+
+func hashAPIKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -1,53 +1,214 @@
 package authorization
 
 import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
 	"fmt"
+	"log"
+	"time"
 
 	"go_final_project/internal/config"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// Идентификатор пользователя, авторизованного по общему паролю
+const PasswordSubject = "admin"
+
 // Структура для взаимодествия api, реализующая методы авторизации
 type Handler struct {
-	hashedPassword [32]byte
-	token          jwt.Token
-	cfg            config.Handler
+	secret  []byte // случайный секрет на случай, если он не задан в настройках
+	limiter *Limiter
+	tokens  TokenStorage
+	keys    KeyStorage
+	users   UserStorage
+	roles   RoleStorage
+	oidc    *OIDCProvider
+	cfg     *config.Handler
+}
+
+// Список отозванных токенов. Хранится в базе, чтобы отозванные токены не становились снова действительными после перезапуска
+type TokenStorage interface {
+	// Отзывает токен до времени expires, возвращает false, если токен уже отозван
+	RevokeToken(ctx context.Context, jti string, expires time.Time) (bool, error)
+	TokenRevoked(ctx context.Context, jti string) (bool, error)
+}
+
+type Storage interface {
+	TokenStorage
+	KeyStorage
+	UserStorage
+	RoleStorage
+}
+
+func Create(storage Storage, cfg *config.Handler) *Handler {
+	auth := &Handler{
+		limiter: NewLimiter(cfg),
+		tokens:  storage,
+		keys:    storage,
+		users:   storage,
+		roles:   storage,
+		oidc:    NewOIDCProvider(cfg),
+		cfg:     cfg,
+	}
+	if len(cfg.Secret()) == 0 {
+		// Секрет не задан - токены будут действительны только до перезапуска сервера
+		log.Println("authorization.Create: secret not setted, generating a random one")
+	}
+	auth.secret = make([]byte, 32)
+	if _, err := rand.Read(auth.secret); err != nil {
+		log.Fatalf("authorization.Create: %v", err)
+	}
+	return auth
 }
 
-func Create() *Handler {
-	return &Handler{}
+// Ключ подписи токенов выводится из секрета и пароля, поэтому после смены любого из них
+// в перечитанных настройках ранее выпущенные токены перестают действовать
+func (auth *Handler) signingKey() []byte {
+	secret := []byte(auth.cfg.Secret())
+	if len(secret) == 0 {
+		secret = auth.secret
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(auth.cfg.Password()))
+	return mac.Sum(nil)
 }
 
+// Сравнивает пароль за постоянное время, не зависящее ни от содержимого, ни от длины паролей
 func (auth *Handler) VerifyPassword(password string) bool {
-	return password == auth.cfg.Password()
+	if !auth.PasswordSetted() {
+		return false
+	}
+	got := sha256.Sum256([]byte(password))
+	want := sha256.Sum256([]byte(auth.cfg.Password()))
+	return subtle.ConstantTimeCompare(got[:], want[:]) == 1
+}
+
+func (auth *Handler) Limiter() *Limiter {
+	return auth.limiter
 }
 
 func (auth *Handler) PasswordSetted() bool {
 	return len(auth.cfg.Password()) > 0
 }
 
-func (auth *Handler) CreateToken() (string, error) {
-	if !auth.PasswordSetted() {
+// Требуется ли авторизация: задан пароль или настроен вход через OIDC
+func (auth *Handler) Enabled() bool {
+	return auth.PasswordSetted() || auth.oidc.Enabled()
+}
+
+func (auth *Handler) OIDC() *OIDCProvider {
+	return auth.oidc
+}
+
+// Завершает вход через OIDC: сопоставляет учетную запись провайдера с локальным пользователем и выпускает для него токен
+func (auth *Handler) SigninOIDC(ctx context.Context, browserState, state, code string) (string, error) {
+	issuer, subject, email, err := auth.oidc.Exchange(ctx, browserState, state, code)
+	if err != nil {
+		return "", fmt.Errorf("authorization.Handler.SigninOIDC: %v", err)
+	}
+
+	user, err := auth.users.FindOrCreateUser(ctx, issuer, subject, email)
+	if err != nil {
+		return "", fmt.Errorf("authorization.Handler.SigninOIDC: %v", err)
+	}
+	return auth.CreateToken(UserSubject(user.ID))
+}
+
+// Идентификатор локального пользователя в токене
+func UserSubject(userID string) string {
+	return "user:" + userID
+}
+
+// Выпускает новый токен для пользователя subject
+func (auth *Handler) CreateToken(subject string) (string, error) {
+	if !auth.Enabled() {
 		return "", fmt.Errorf("authorization.Handler.CreateToken: password not setted ")
 	}
 
-	token := jwt.New(jwt.SigningMethodHS256)
-	ss, err := token.SignedString([]byte(auth.cfg.Password()))
+	jti, err := randomString()
+	if err != nil {
+		return "", fmt.Errorf("authorization.Handler.CreateToken: %v", err)
+	}
+
+	now := time.Now()
+	claims := jwt.RegisteredClaims{
+		Subject:   subject,
+		ID:        jti,
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(auth.cfg.TokenTTL())),
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	ss, err := token.SignedString(auth.signingKey())
 	if err != nil {
 		return "", fmt.Errorf("authorization.Handler.CreateTocken: %v", err)
 	}
 	return ss, nil
 }
 
-func (auth *Handler) VerifyTocken(tokenString string) bool {
-	token, err := jwt.Parse(tokenString,
+// Проверяет подпись, срок действия и отзыв токена и возвращает его содержимое
+func (auth *Handler) ParseToken(ctx context.Context, tokenString string) (*jwt.RegisteredClaims, error) {
+	claims := &jwt.RegisteredClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims,
 		func(t *jwt.Token) (interface{}, error) {
-			return []byte([]byte(auth.cfg.Password())), nil
-		})
+			return auth.signingKey(), nil
+		},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("authorization.Handler.ParseToken: %v", err)
+	}
+	if !token.Valid || len(claims.ID) == 0 || len(claims.Subject) == 0 {
+		return nil, fmt.Errorf("authorization.Handler.ParseToken: invalid token")
+	}
+	revoked, err := auth.tokens.TokenRevoked(ctx, claims.ID)
+	if err != nil {
+		return nil, fmt.Errorf("authorization.Handler.ParseToken: %w", err)
+	}
+	if revoked {
+		return nil, fmt.Errorf("authorization.Handler.ParseToken: token revoked")
+	}
+	return claims, nil
+}
 
+// Выпускает новый токен взамен переданного, старый токен при этом отзывается.
+// Каждый токен можно обменять только один раз, в том числе при параллельных запросах
+func (auth *Handler) RefreshToken(ctx context.Context, tokenString string) (string, error) {
+	claims, err := auth.ParseToken(ctx, tokenString)
 	if err != nil {
-		return false
+		return "", fmt.Errorf("authorization.Handler.RefreshToken: %w", err)
+	}
+
+	revoked, err := auth.Revoke(ctx, claims)
+	if err != nil {
+		return "", fmt.Errorf("authorization.Handler.RefreshToken: %w", err)
+	}
+	if !revoked {
+		return "", fmt.Errorf("authorization.Handler.RefreshToken: token revoked")
+	}
+
+	newToken, err := auth.CreateToken(claims.Subject)
+	if err != nil {
+		return "", fmt.Errorf("authorization.Handler.RefreshToken: %w", err)
+	}
+	return newToken, nil
+}
+
+// Добавляет токен в список отозванных до истечения его срока действия. Возвращает false, если токен уже был отозван
+func (auth *Handler) Revoke(ctx context.Context, claims *jwt.RegisteredClaims) (bool, error) {
+	exp := time.Now().Add(auth.cfg.TokenTTL())
+	if claims.ExpiresAt != nil {
+		exp = claims.ExpiresAt.Time
+	}
+	revoked, err := auth.tokens.RevokeToken(ctx, claims.ID, exp)
+	if err != nil {
+		return false, fmt.Errorf("authorization.Handler.Revoke: %w", err)
 	}
-	return token.Valid
+	return revoked, nil
 }
@@ -0,0 +1,146 @@
+package authorization
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"go_final_project/internal/config"
+)
+
+// Предел задержки попыток входа при превышении общего лимита, чтобы ожидающие запросы не копились
+const maxGlobalDelay = 5 * time.Second
+
+// Состояние неудачных попыток входа с одного адреса
+type attempts struct {
+	failures     int
+	blockedUntil time.Time
+	last         time.Time
+}
+
+// Ограничитель попыток входа: экспоненциальная задержка и временная блокировка для каждого адреса.
+// Общий лимит неудачных попыток со всех адресов никого не блокирует, а только замедляет попытки входа,
+// чтобы атака с множества адресов не закрыла вход владельцу. Адреса, с которых недавно был успешный вход, не замедляются
+type Limiter struct {
+	cfg         *config.Handler
+	mu          sync.Mutex
+	clients     map[string]*attempts
+	trusted     map[string]time.Time // адреса успешного входа и его время
+	globalCount int
+	globalStart time.Time
+}
+
+func NewLimiter(cfg *config.Handler) *Limiter {
+	return &Limiter{cfg: cfg, clients: make(map[string]*attempts), trusted: make(map[string]time.Time)}
+}
+
+// Проверяет, можно ли принять попытку входа с адреса ip. Если нельзя - возвращает время до следующей попытки
+func (l *Limiter) Allow(ip string) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	client, ok := l.clients[ip]
+	if !ok {
+		return 0, true
+	}
+	if wait := client.blockedUntil.Sub(time.Now()); wait > 0 {
+		return wait, false
+	}
+	return 0, true
+}
+
+// Задержка попытки входа с адреса ip из-за общего лимита: SigninBackoffBase, удваивающаяся с каждым
+// превышением лимита в текущем окне, но не больше maxGlobalDelay. Пока лимит не превышен, задержки нет
+func (l *Limiter) Delay(ip string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	limit := l.cfg.SigninGlobalLimit()
+	if l.globalCount < limit || now.Sub(l.globalStart) > l.cfg.SigninGlobalWindow() {
+		return 0
+	}
+	if at, ok := l.trusted[ip]; ok && now.Sub(at) <= l.cfg.TokenTTL() {
+		return 0
+	}
+
+	delay := l.cfg.SigninBackoffBase()
+	for over := l.globalCount / limit; over > 1 && delay < maxGlobalDelay; over-- {
+		delay *= 2
+	}
+	return min(delay, maxGlobalDelay)
+}
+
+// Выдерживает задержку Delay перед проверкой пароля. Возвращает ошибку, если запрос отменен раньше
+func (l *Limiter) Wait(ctx context.Context, ip string) error {
+	delay := l.Delay(ip)
+	if delay == 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Учитывает неудачную попытку входа с адреса ip и пишет запись в журнал аудита
+func (l *Limiter) Failure(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.cleanup(now)
+
+	if now.Sub(l.globalStart) > l.cfg.SigninGlobalWindow() {
+		l.globalStart = now
+		l.globalCount = 0
+	}
+	l.globalCount++
+
+	client, ok := l.clients[ip]
+	if !ok {
+		client = &attempts{}
+		l.clients[ip] = client
+	}
+	client.failures++
+	client.last = now
+
+	switch {
+	case client.failures >= l.cfg.SigninLockoutAttempts():
+		client.blockedUntil = now.Add(l.cfg.SigninLockoutTime())
+	case client.failures >= l.cfg.SigninFreeAttempts():
+		backoff := l.cfg.SigninBackoffBase() << (client.failures - l.cfg.SigninFreeAttempts())
+		client.blockedUntil = now.Add(min(backoff, l.cfg.SigninLockoutTime()))
+	}
+
+	log.Printf("audit: signin failed ip=%s failures=%d blocked_until=%s global_failures=%d",
+		ip, client.failures, client.blockedUntil.Format(time.RFC3339), l.globalCount)
+}
+
+// Сбрасывает счетчик неудачных попыток адреса ip после успешного входа и освобождает адрес от общего лимита
+func (l *Limiter) Success(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.clients, ip)
+	l.trusted[ip] = time.Now()
+}
+
+// Удаляет адреса, с которых давно не было попыток входа, и устаревшие адреса успешного входа
+func (l *Limiter) cleanup(now time.Time) {
+	for ip, client := range l.clients {
+		if client.blockedUntil.Before(now) && now.Sub(client.last) > l.cfg.SigninLockoutTime() {
+			delete(l.clients, ip)
+		}
+	}
+	for ip, at := range l.trusted {
+		if now.Sub(at) > l.cfg.TokenTTL() {
+			delete(l.trusted, ip)
+		}
+	}
+}
@@ -0,0 +1,314 @@
+package authorization
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"go_final_project/internal/app"
+	"go_final_project/internal/config"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Время, в течение которого пользователь должен вернуться от провайдера
+const oidcStateTTL = 10 * time.Minute
+
+// Локальный пользователь, сопоставленный с учетной записью OIDC-провайдера
+type User = app.User
+
+type UserStorage interface {
+	FindOrCreateUser(ctx context.Context, issuer, subject, email string) (User, error)
+}
+
+// Параметры провайдера из `/.well-known/openid-configuration`
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type oidcClaims struct {
+	Nonce         string `json:"nonce"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	jwt.RegisteredClaims
+}
+
+// Клиент OpenID Connect, реализующий вход по authorization code flow
+type OIDCProvider struct {
+	cfg       *config.Handler
+	client    *http.Client
+	mu        sync.Mutex
+	discovery *oidcDiscovery
+	keys      map[string]*rsa.PublicKey
+	states    map[string]oidcState
+}
+
+// Ожидающий возврата от провайдера вход
+type oidcState struct {
+	nonce   string
+	expires time.Time
+}
+
+func NewOIDCProvider(cfg *config.Handler) *OIDCProvider {
+	return &OIDCProvider{
+		cfg:    cfg,
+		client: &http.Client{Timeout: 10 * time.Second},
+		states: make(map[string]oidcState),
+	}
+}
+
+func (p *OIDCProvider) Enabled() bool {
+	return len(p.cfg.OIDCIssuer()) > 0
+}
+
+// Время, в течение которого пользователь должен вернуться от провайдера
+func (p *OIDCProvider) StateTTL() time.Duration {
+	return oidcStateTTL
+}
+
+// Возвращает адрес страницы входа провайдера для нового входа и state, который нужно сохранить
+// в браузере пользователя и сверить при возврате от провайдера
+func (p *OIDCProvider) AuthURL(ctx context.Context) (authURL, state string, err error) {
+	d, err := p.discover(ctx)
+	if err != nil {
+		return "", "", fmt.Errorf("OIDCProvider.AuthURL: %v", err)
+	}
+
+	state, err = randomString()
+	if err != nil {
+		return "", "", fmt.Errorf("OIDCProvider.AuthURL: %v", err)
+	}
+	nonce, err := randomString()
+	if err != nil {
+		return "", "", fmt.Errorf("OIDCProvider.AuthURL: %v", err)
+	}
+
+	p.mu.Lock()
+	now := time.Now()
+	for s, st := range p.states {
+		if st.expires.Before(now) {
+			delete(p.states, s)
+		}
+	}
+	p.states[state] = oidcState{nonce: nonce, expires: now.Add(oidcStateTTL)}
+	p.mu.Unlock()
+
+	query := url.Values{
+		"response_type": {"code"},
+		"client_id":     {p.cfg.OIDCClientID()},
+		"redirect_uri":  {p.cfg.OIDCRedirectURL()},
+		"scope":         {"openid email profile"},
+		"state":         {state},
+		"nonce":         {nonce},
+	}
+	sep := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return d.AuthorizationEndpoint + sep + query.Encode(), state, nil
+}
+
+// Обменивает код авторизации на id_token, проверяет его и возвращает утверждения о пользователе.
+// browserState - state, сохраненный в браузере при начале входа: без него чужой код авторизации,
+// подсунутый по ссылке, выполнил бы вход под чужой учетной записью
+func (p *OIDCProvider) Exchange(ctx context.Context, browserState, state, code string) (issuer, subject, email string, err error) {
+	if len(state) == 0 || subtle.ConstantTimeCompare([]byte(browserState), []byte(state)) != 1 {
+		return "", "", "", fmt.Errorf("OIDCProvider.Exchange: state does not match the browser")
+	}
+
+	p.mu.Lock()
+	st, ok := p.states[state]
+	delete(p.states, state)
+	p.mu.Unlock()
+	if !ok || st.expires.Before(time.Now()) {
+		return "", "", "", fmt.Errorf("OIDCProvider.Exchange: unknown or expired state")
+	}
+	if len(code) == 0 {
+		return "", "", "", fmt.Errorf("OIDCProvider.Exchange: code is empty")
+	}
+
+	d, err := p.discover(ctx)
+	if err != nil {
+		return "", "", "", fmt.Errorf("OIDCProvider.Exchange: %v", err)
+	}
+
+	form := url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {code},
+		"redirect_uri": {p.cfg.OIDCRedirectURL()},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", "", "", fmt.Errorf("OIDCProvider.Exchange: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(p.cfg.OIDCClientID()), url.QueryEscape(p.cfg.OIDCClientSecret()))
+
+	var tokenResp struct {
+		IDToken string `json:"id_token"`
+		Error   string `json:"error"`
+	}
+	if err := p.getJSON(req, &tokenResp); err != nil {
+		return "", "", "", fmt.Errorf("OIDCProvider.Exchange: %v", err)
+	}
+	if len(tokenResp.IDToken) == 0 {
+		return "", "", "", fmt.Errorf("OIDCProvider.Exchange: no id_token in response: %s", tokenResp.Error)
+	}
+
+	claims := &oidcClaims{}
+	_, err = jwt.ParseWithClaims(tokenResp.IDToken, claims, p.keyFunc(ctx),
+		jwt.WithValidMethods([]string{"RS256"}),
+		jwt.WithIssuer(d.Issuer),
+		jwt.WithAudience(p.cfg.OIDCClientID()),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return "", "", "", fmt.Errorf("OIDCProvider.Exchange: %v", err)
+	}
+	if claims.Nonce != st.nonce {
+		return "", "", "", fmt.Errorf("OIDCProvider.Exchange: nonce mismatch")
+	}
+	if len(claims.Subject) == 0 {
+		return "", "", "", fmt.Errorf("OIDCProvider.Exchange: id_token has no subject")
+	}
+	if !p.allowed(claims.Subject, claims.Email, claims.EmailVerified) {
+		return "", "", "", fmt.Errorf("OIDCProvider.Exchange: %s (%s) is not allowed to sign in", claims.Subject, claims.Email)
+	}
+	return claims.Issuer, claims.Subject, claims.Email, nil
+}
+
+// Проверяет, что учетная запись провайдера есть в списке разрешенных. Адрес почты учитывается,
+// только если провайдер его подтвердил, `*` разрешает вход всем пользователям провайдера
+func (p *OIDCProvider) allowed(subject, email string, emailVerified bool) bool {
+	for _, entry := range p.cfg.OIDCAllowed() {
+		switch {
+		case entry == "*", entry == subject:
+			return true
+		case emailVerified && len(email) > 0 && strings.EqualFold(entry, email):
+			return true
+		}
+	}
+	return false
+}
+
+// Загружает и кэширует параметры провайдера
+func (p *OIDCProvider) discover(ctx context.Context) (*oidcDiscovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	issuer := strings.TrimSuffix(p.cfg.OIDCIssuer(), "/")
+	if p.discovery != nil && p.discovery.Issuer == issuer {
+		return p.discovery, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	d := &oidcDiscovery{}
+	if err := p.getJSON(req, d); err != nil {
+		return nil, err
+	}
+	if d.Issuer != issuer {
+		return nil, fmt.Errorf("issuer mismatch: %s != %s", d.Issuer, issuer)
+	}
+	p.discovery = d
+	p.keys = nil
+	return d, nil
+}
+
+// Выбирает ключ провайдера для проверки подписи id_token, при неизвестном kid перечитывает JWKS
+func (p *OIDCProvider) keyFunc(ctx context.Context) jwt.Keyfunc {
+	return func(t *jwt.Token) (interface{}, error) {
+		return p.key(ctx, t)
+	}
+}
+
+func (p *OIDCProvider) key(ctx context.Context, t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+
+	p.mu.Lock()
+	key, ok := p.keys[kid]
+	jwksURI := p.discovery.JWKSURI
+	p.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, jwksURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	var jwks struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := p.getJSON(req, &jwks); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range jwks.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid jwk %s: %v", k.Kid, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid jwk %s: %v", k.Kid, err)
+		}
+		keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+
+	p.mu.Lock()
+	p.keys = keys
+	p.mu.Unlock()
+
+	key, ok = keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %s", kid)
+	}
+	return key, nil
+}
+
+func (p *OIDCProvider) getJSON(req *http.Request, v any) error {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s %s: %s", req.Method, req.URL, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func randomString() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,143 @@
+package authorization
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"go_final_project/internal/app"
+)
+
+// Роль пользователя в списке задач
+type Role string
+
+const (
+	RoleViewer Role = "viewer" // просмотр задач
+	RoleEditor Role = "editor" // просмотр, создание, изменение и выполнение задач
+	RoleOwner  Role = "owner"  // все действия, включая удаление задач, а во всех списках - и управление доступом
+
+	// Роль пользователей, которым роль не назначена явно: без назначенной роли доступа к списку нет
+	DefaultRole Role = ""
+
+	// Список задач, роль в котором действует во всех списках
+	AllLists = app.AllLists
+)
+
+var roleLevels = map[Role]int{
+	RoleViewer: 1,
+	RoleEditor: 2,
+	RoleOwner:  3,
+}
+
+type RoleBinding = app.RoleBinding
+
+type RoleStorage interface {
+	// Возвращает роль пользователя в списке list, а если она не назначена - во всех списках.
+	// sql.ErrNoRows, если роль не назначена
+	GetRole(ctx context.Context, subject, list string) (string, error)
+	SetRole(ctx context.Context, binding RoleBinding) error
+	RemoveRole(ctx context.Context, subject, list string) error
+	GetRoleList(ctx context.Context) ([]RoleBinding, error)
+}
+
+func (r Role) Valid() bool {
+	_, ok := roleLevels[r]
+	return ok
+}
+
+// Разрешает ли роль всё, что разрешает роль other
+func (r Role) Includes(other Role) bool {
+	return roleLevels[r] >= roleLevels[other]
+}
+
+// Кто выполняет запрос
+type Identity struct {
+	Subject string
+	Role    Role   // роль в списке List
+	List    string // список задач, к которому относится запрос
+	// Роль пользователя зависит от списка и назначается в нем, у API-ключей и пароля сервиса одна роль во всех списках
+	Scoped bool
+}
+
+type identityKey struct{}
+
+func WithIdentity(ctx context.Context, identity Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+func IdentityFrom(ctx context.Context) (Identity, bool) {
+	identity, ok := ctx.Value(identityKey{}).(Identity)
+	return identity, ok
+}
+
+// Возвращает роль пользователя subject в списке list, AllLists - роль, действующую во всех списках.
+// Вошедший по общему паролю всегда владелец
+func (auth *Handler) RoleOf(ctx context.Context, subject, list string) (Role, error) {
+	if subject == PasswordSubject {
+		return RoleOwner, nil
+	}
+
+	role, err := auth.roles.GetRole(ctx, subject, list)
+	if errors.Is(err, sql.ErrNoRows) {
+		return DefaultRole, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("authorization.Handler.RoleOf: %v", err)
+	}
+	return Role(role), nil
+}
+
+// Роль identity в списке list
+func (auth *Handler) RoleIn(ctx context.Context, identity Identity, list string) (Role, error) {
+	if !identity.Scoped {
+		return identity.Role, nil
+	}
+	return auth.RoleOf(ctx, identity.Subject, list)
+}
+
+// Роль, соответствующая области действия API-ключа, во всех списках задач.
+// Ключ read-write может все, что и владелец, кроме управления доступом, куда ключи не допускаются
+func KeyRole(key APIKey) Role {
+	if key.Scope == ScopeReadWrite {
+		return RoleOwner
+	}
+	return RoleViewer
+}
+
+// Назначает пользователю subject роль в списке list, AllLists - во всех списках
+func (auth *Handler) SetRole(ctx context.Context, subject, list string, role Role) error {
+	if len(subject) == 0 {
+		return fmt.Errorf("authorization.Handler.SetRole: %w", app.ValidationError("subject", "subject is empty"))
+	}
+	if subject == PasswordSubject {
+		return fmt.Errorf("authorization.Handler.SetRole: %w", app.ValidationError("subject", "role of %s can't be changed", PasswordSubject))
+	}
+	if list != AllLists {
+		if err := app.CheckList(list); err != nil {
+			return fmt.Errorf("authorization.Handler.SetRole: %w", err)
+		}
+	}
+	if !role.Valid() {
+		return fmt.Errorf("authorization.Handler.SetRole: %w", app.ValidationError("role", "role must be %s, %s or %s", RoleViewer, RoleEditor, RoleOwner))
+	}
+	return auth.roles.SetRole(ctx, RoleBinding{Subject: subject, List: list, Role: string(role)})
+}
+
+func (auth *Handler) RemoveRole(ctx context.Context, subject, list string) error {
+	if len(subject) == 0 {
+		return fmt.Errorf("authorization.Handler.RemoveRole: %w", app.ValidationError("subject", "subject is empty"))
+	}
+	return auth.roles.RemoveRole(ctx, subject, list)
+}
+
+func (auth *Handler) RoleList(ctx context.Context) ([]RoleBinding, error) {
+	bindings, err := auth.roles.GetRoleList(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("authorization.Handler.RoleList: %v", err)
+	}
+	if len(bindings) == 0 {
+		return make([]RoleBinding, 0), nil
+	}
+	return bindings, nil
+}
@@ -0,0 +1,248 @@
+package backup
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go_final_project/internal/config"
+)
+
+const (
+	nameTimeFormat = "20060102-150405" // время в имени копии, копии по имени сортируются по времени
+	extension      = ".db"
+	gzipExtension  = ".gz"
+)
+
+// Хранилище, с которого снимаются копии
+type Storage interface {
+	// Сохраняет согласованную копию базы в файл path, не останавливая работу с базой
+	Backup(ctx context.Context, path string) error
+}
+
+// Состояние автоматических резервных копий. Время указывается в формате RFC 3339
+type Status struct {
+	Enabled    bool   `json:"enabled"`
+	Dir        string `json:"dir,omitempty"`
+	LastBackup string `json:"last_backup,omitempty"`
+	LastFile   string `json:"last_file,omitempty"`
+	LastError  string `json:"last_error,omitempty"`
+	NextBackup string `json:"next_backup,omitempty"`
+}
+
+// Периодически сохраняет резервные копии базы в каталог из настроек и удаляет старые копии.
+// Каталог, интервал, число копий и сжатие перечитываются из настроек перед каждой копией
+type Scheduler struct {
+	storage Storage
+	cfg     *config.Handler
+
+	mu          sync.Mutex
+	lastAttempt time.Time // время последней попытки, успешной или нет
+	lastBackup  time.Time
+	lastFile    string
+	lastErr     error
+}
+
+func New(storage Storage, cfg *config.Handler) *Scheduler {
+	return &Scheduler{storage: storage, cfg: cfg}
+}
+
+// Сохраняет копии до отмены ctx. Первая копия сохраняется сразу, если в каталоге нет копии моложе интервала
+func (s *Scheduler) Run(ctx context.Context) {
+	for {
+		// Пока копии отключены, настройки проверяются так же часто, как файл настроек
+		wait := s.cfg.ConfigPollInterval()
+		if len(s.cfg.BackupDir()) > 0 {
+			next := s.next()
+			if !time.Now().Before(next) {
+				if _, err := s.Backup(ctx); err != nil && ctx.Err() == nil {
+					log.Printf("Scheduler.Run: %v", err)
+				}
+				continue
+			}
+			wait = min(wait, time.Until(next))
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// Сохраняет копию базы, при необходимости сжимает ее и удаляет копии сверх BackupKeep. Возвращает путь к копии
+func (s *Scheduler) Backup(ctx context.Context) (string, error) {
+	path, err := s.backup(ctx)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastAttempt = time.Now()
+	s.lastErr = err
+	if err != nil {
+		return "", fmt.Errorf("Scheduler.Backup: %w", err)
+	}
+	s.lastBackup = s.lastAttempt
+	s.lastFile = path
+	return path, nil
+}
+
+func (s *Scheduler) backup(ctx context.Context) (string, error) {
+	dir := s.cfg.BackupDir()
+	if len(dir) == 0 {
+		return "", fmt.Errorf("backup directory is not set")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(dir, s.prefix()+time.Now().Format(nameTimeFormat)+extension)
+	if err := s.storage.Backup(ctx, path); err != nil {
+		return "", err
+	}
+	if s.cfg.BackupGzip() {
+		compressed, err := compress(path)
+		os.Remove(path)
+		if err != nil {
+			return "", err
+		}
+		path = compressed
+	}
+
+	if err := s.prune(dir); err != nil {
+		log.Printf("Scheduler.Backup: removing old backups: %v", err)
+	}
+	return path, nil
+}
+
+// Текущее состояние копий для api
+func (s *Scheduler) Status() Status {
+	next := s.next()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := Status{Dir: s.cfg.BackupDir(), LastFile: s.lastFile}
+	status.Enabled = len(status.Dir) > 0
+	if !s.lastBackup.IsZero() {
+		status.LastBackup = s.lastBackup.Format(time.RFC3339)
+	}
+	if s.lastErr != nil {
+		status.LastError = s.lastErr.Error()
+	}
+	if status.Enabled {
+		status.NextBackup = next.Format(time.RFC3339)
+	}
+	return status
+}
+
+// Время следующей копии. После запуска сервера отсчитывается от последней копии в каталоге,
+// поэтому частые перезапуски не создают лишних копий
+func (s *Scheduler) next() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.lastAttempt.IsZero() {
+		if files, err := s.backups(s.cfg.BackupDir()); err == nil && len(files) > 0 {
+			s.lastFile = files[len(files)-1]
+			if info, err := os.Stat(s.lastFile); err == nil {
+				s.lastAttempt = info.ModTime()
+				s.lastBackup = s.lastAttempt
+			}
+		}
+	}
+	if s.lastAttempt.IsZero() {
+		return time.Now()
+	}
+	return s.lastAttempt.Add(s.cfg.BackupInterval())
+}
+
+// Удаляет копии сверх BackupKeep, начиная с самых старых
+func (s *Scheduler) prune(dir string) error {
+	files, err := s.backups(dir)
+	if err != nil {
+		return err
+	}
+	var errs []string
+	for len(files) > s.cfg.BackupKeep() {
+		if err := os.Remove(files[0]); err != nil {
+			errs = append(errs, err.Error())
+		}
+		files = files[1:]
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Копии этой базы в каталоге dir от старых к новым
+func (s *Scheduler) backups(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := s.prefix()
+	var files []string
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), gzipExtension)
+		stamp, ok := strings.CutPrefix(name, prefix)
+		if !ok || entry.IsDir() || !strings.HasSuffix(stamp, extension) {
+			continue
+		}
+		if _, err := time.Parse(nameTimeFormat, strings.TrimSuffix(stamp, extension)); err != nil {
+			continue
+		}
+		files = append(files, filepath.Join(dir, entry.Name()))
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// Начало имени копий: имя файла базы без расширения, например `scheduler-`
+func (s *Scheduler) prefix() string {
+	base := filepath.Base(s.cfg.DBPath())
+	return strings.TrimSuffix(base, filepath.Ext(base)) + "-"
+}
+
+// Сжимает файл path в path.gz и возвращает путь к сжатому файлу
+func compress(path string) (string, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	compressed := path + gzipExtension
+	tmp := compressed + ".tmp"
+	dst, err := os.Create(tmp)
+	if err != nil {
+		return "", err
+	}
+	zw := gzip.NewWriter(dst)
+	_, err = io.Copy(zw, src)
+	if closeErr := zw.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, compressed)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	return compressed, nil
+}
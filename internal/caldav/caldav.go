@@ -0,0 +1,412 @@
+package caldav
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go_final_project/internal/app"
+	"go_final_project/internal/export"
+	"go_final_project/internal/httputil"
+	"go_final_project/internal/ical"
+)
+
+// Адрес сервера CalDAV, под которым его регистрирует api
+const Prefix = "/dav/"
+
+const (
+	collection  = "tasks/"            // единственный календарь, путь относительно корня
+	maxBodySize = 1 << 20             // максимальный размер запроса клиента
+	extension   = ".ics"              // расширение имен записей, которые назначает сервер
+	uidSuffix   = "@go_final_project" // окончание UID, совпадающее с UID выгрузки задач
+)
+
+// Имена записей, которые сервер назначает задачам без записи в Storage, клиенты занимать не могут
+var taskName = regexp.MustCompile(`^[0-9]+\.ics$`)
+
+// Запись календаря, созданная клиентом: клиент сам выбирает имя файла и UID и ожидает найти запись под ними же.
+// Задачи без такой записи доступны под именем `<id>.ics` с UID выгрузки
+type Object struct {
+	TaskID string
+	Name   string
+	UID    string
+}
+
+// Хранилище имен и UID записей, созданных клиентами. Запись удаляется вместе с задачей.
+// Хранилище транзакции, которое WithTx передает в fn, тоже должно быть Storage
+type Storage interface {
+	GetDAVObjects(ctx context.Context) ([]Object, error)
+	// Возвращает записи с именем name, задачей taskID или UID uid
+	FindDAVObjects(ctx context.Context, name, taskID, uid string) ([]Object, error)
+	AddDAVObject(ctx context.Context, object Object) error
+	WithTx(ctx context.Context, fn func(app.Storage) error) error
+}
+
+// Сервер CalDAV (RFC 4791) с одним календарем задач VTODO: Prefix - принципал и домашний каталог
+// календарей, Prefix+`tasks/` - календарь, Prefix+`tasks/<имя>` - записи. Задачи читаются и меняются
+// через Application, поэтому проверяются и повторяются так же, как в api. Права проверяются до Handler
+type Handler struct {
+	app     *app.Application
+	storage Storage
+}
+
+func New(application *app.Application, storage Storage) *Handler {
+	return &Handler{app: application, storage: storage}
+}
+
+func (h *Handler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	path, ok := strings.CutPrefix(req.URL.Path, Prefix)
+	if !ok {
+		http.NotFound(resp, req)
+		return
+	}
+	if req.Body != nil {
+		req.Body = http.MaxBytesReader(resp, req.Body, maxBodySize)
+	}
+
+	var err error
+	switch req.Method {
+	case http.MethodOptions:
+		resp.Header().Set("DAV", "1, 3, calendar-access")
+		resp.Header().Set("Allow", "OPTIONS, GET, HEAD, PUT, DELETE, PROPFIND, REPORT")
+		resp.WriteHeader(http.StatusOK)
+	case "PROPFIND":
+		err = h.propfind(resp, req, path)
+	case "REPORT":
+		err = h.report(resp, req, path)
+	case http.MethodGet, http.MethodHead:
+		err = h.get(resp, req, path)
+	case http.MethodPut:
+		err = h.put(resp, req, path)
+	case http.MethodDelete:
+		err = h.delete(resp, req, path)
+	default:
+		resp.Header().Set("Allow", "OPTIONS, GET, HEAD, PUT, DELETE, PROPFIND, REPORT")
+		http.Error(resp, "method not allowed", http.StatusMethodNotAllowed)
+	}
+	if err != nil {
+		writeError(resp, err)
+	}
+}
+
+// Задача календаря вместе с ее именем и UID
+type object struct {
+	task app.Task
+	name string
+	uid  string
+}
+
+// ETag записи. Версия задачи меняется при каждом изменении, в том числе при выполнении
+func (o object) etag() string {
+	return httputil.ETag(o.task.Version)
+}
+
+// Версия записи для операции по заголовку `If-Match`: 0 - любая, -1 - запись изменена или ее нет
+func (o object) ifMatch(req *http.Request) int64 {
+	version, _ := httputil.IfMatchVersion(req, func() (int64, error) {
+		return o.task.Version, nil
+	})
+	return version
+}
+
+// Все записи календаря в порядке дат задач. Календарь показывает только список задач по умолчанию
+func (h *Handler) objects(ctx context.Context) ([]object, error) {
+	tasks, err := h.app.AllTasks(ctx, app.DefaultList)
+	if err != nil {
+		return nil, err
+	}
+	stored, err := h.storage.GetDAVObjects(ctx)
+	if err != nil {
+		return nil, err
+	}
+	byTask := make(map[string]Object, len(stored))
+	for _, o := range stored {
+		byTask[o.TaskID] = o
+	}
+
+	objects := make([]object, 0, len(tasks))
+	for _, task := range tasks {
+		o := object{task: task, name: task.ID + extension, uid: "task-" + task.ID + uidSuffix}
+		if stored, ok := byTask[task.ID]; ok {
+			o.name, o.uid = stored.Name, stored.UID
+		}
+		objects = append(objects, o)
+	}
+	return objects, nil
+}
+
+// Находит запись по имени, не читая остальные задачи. Второе значение false, если записи нет
+func (h *Handler) object(ctx context.Context, name string) (object, bool, error) {
+	var taskID string
+	if taskName.MatchString(name) {
+		taskID = strings.TrimSuffix(name, extension)
+	}
+	stored, err := h.storage.FindDAVObjects(ctx, name, taskID, "")
+	if err != nil {
+		return object{}, false, err
+	}
+
+	o := object{name: name, uid: "task-" + taskID + uidSuffix}
+	id := taskID
+	for _, s := range stored {
+		if s.Name == name {
+			id, o.uid = s.TaskID, s.UID
+		} else if s.TaskID == taskID {
+			// У задачи есть имя, выбранное клиентом, под именем `<id>.ics` ее нет
+			return object{}, false, nil
+		}
+	}
+	if len(id) == 0 {
+		return object{}, false, nil
+	}
+
+	o.task, err = h.app.GetTask(ctx, id)
+	if errors.Is(err, app.ErrNotFound) || err == nil && (o.task.ID != id || o.task.List != app.DefaultList) {
+		return object{}, false, nil
+	} else if err != nil {
+		return object{}, false, err
+	}
+	return o, true, nil
+}
+
+// Находит запись по UID. Второе значение false, если записи нет
+func (h *Handler) objectByUID(ctx context.Context, uid string) (object, bool, error) {
+	stored, err := h.storage.FindDAVObjects(ctx, "", "", uid)
+	if err != nil {
+		return object{}, false, err
+	}
+	for _, s := range stored {
+		if s.UID == uid {
+			return h.object(ctx, s.Name)
+		}
+	}
+	// UID, назначенный сервером, принадлежит записи `<id>.ics`, если у задачи нет имени, выбранного клиентом
+	id, ok := strings.CutSuffix(uid, uidSuffix)
+	if ok {
+		id, ok = strings.CutPrefix(id, "task-")
+	}
+	if !ok || !taskName.MatchString(id+extension) {
+		return object{}, false, nil
+	}
+	o, ok, err := h.object(ctx, id+extension)
+	if err != nil || !ok || o.uid != uid {
+		return object{}, false, err
+	}
+	return o, true, nil
+}
+
+// CTag календаря (расширение calendarserver.org): меняется при добавлении, изменении и удалении любой задачи
+func ctag(objects []object) string {
+	lines := make([]string, 0, len(objects))
+	for _, o := range objects {
+		lines = append(lines, o.task.ID+":"+strconv.FormatInt(o.task.Version, 10)+":"+o.name)
+	}
+	sort.Strings(lines)
+	sum := sha256.Sum256([]byte(strings.Join(lines, "\n")))
+	return hex.EncodeToString(sum[:16])
+}
+
+// Календарь с одной задачей VTODO
+func (o object) calendarData() (string, error) {
+	var data strings.Builder
+	item := export.TaskItem(o.task)
+	item.UID = o.uid
+	cal := ical.NewWriter(&data, ical.KindTodo, "")
+	if err := cal.Write(item); err != nil {
+		return "", err
+	}
+	if err := cal.Close(); err != nil {
+		return "", err
+	}
+	return data.String(), nil
+}
+
+// Разбирает путь запроса: корень, календарь или запись календаря с именем name
+func parsePath(path string) (root, calendar bool, name string) {
+	switch path {
+	case "":
+		return true, false, ""
+	case collection, strings.TrimSuffix(collection, "/"):
+		return false, true, ""
+	}
+	name, ok := strings.CutPrefix(path, collection)
+	if !ok || strings.Contains(name, "/") {
+		return false, false, ""
+	}
+	return false, false, name
+}
+
+func (h *Handler) get(resp http.ResponseWriter, req *http.Request, path string) error {
+	_, _, name := parsePath(path)
+	if len(name) == 0 {
+		return app.NotFoundError("%s is not a calendar object", req.URL.Path)
+	}
+	o, ok, err := h.object(req.Context(), name)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return app.NotFoundError("%s not found", req.URL.Path)
+	}
+	data, err := o.calendarData()
+	if err != nil {
+		return err
+	}
+
+	resp.Header().Set("Content-Type", "text/calendar; charset=utf-8; component=VTODO")
+	resp.Header().Set("ETag", o.etag())
+	if req.Method == http.MethodHead {
+		return nil
+	}
+	if _, err := io.WriteString(resp, data); err != nil {
+		log.Printf("caldav.Handler.get: %v", err)
+	}
+	return nil
+}
+
+// Создает или меняет задачу по записи VTODO. Запись со STATUS:COMPLETED выполняет задачу так же, как `/api/task/done`:
+// повторяющаяся задача переносится на следующую дату, а остальные удаляются
+func (h *Handler) put(resp http.ResponseWriter, req *http.Request, path string) error {
+	_, _, name := parsePath(path)
+	if len(name) == 0 {
+		return app.NotFoundError("%s is not a calendar object", req.URL.Path)
+	}
+	data, err := io.ReadAll(req.Body)
+	if err != nil {
+		return err
+	}
+	item, err := parseTodo(data)
+	if err != nil {
+		return err
+	}
+	task, err := itemTask(item)
+	if err != nil {
+		return err
+	}
+
+	ctx := req.Context()
+	existing, ok, err := h.object(ctx, name)
+	if err != nil {
+		return err
+	}
+	other, found, err := h.objectByUID(ctx, item.UID)
+	if err != nil {
+		return err
+	}
+	if found && other.name != name {
+		return app.ConflictError("UID %s is used by %s", item.UID, other.name)
+	}
+
+	if !ok {
+		if version := (object{}).ifMatch(req); version != 0 {
+			return app.PreconditionError("%s not found", req.URL.Path)
+		}
+		if item.Status == "COMPLETED" || item.Status == "CANCELLED" {
+			// Выполненную задачу незачем сохранять, при следующей синхронизации клиент увидит, что ее нет
+			resp.WriteHeader(http.StatusCreated)
+			return nil
+		}
+		if taskName.MatchString(name) {
+			return forbiddenError{fmt.Sprintf("name %s is reserved for tasks created by the server", name)}
+		}
+		// Задачу без имени клиент не найдет, поэтому она создается вместе с записью в одной транзакции
+		err = h.storage.WithTx(ctx, func(storage app.Storage) error {
+			tx, ok := storage.(Storage)
+			if !ok {
+				return errors.New("transaction storage can't keep calendar objects")
+			}
+			task, err := h.app.InTx(storage).AddTask(ctx, task)
+			if err != nil {
+				return err
+			}
+			return tx.AddDAVObject(ctx, Object{TaskID: task.ID, Name: name, UID: item.UID})
+		})
+		if err != nil {
+			return err
+		}
+		resp.WriteHeader(http.StatusCreated)
+		return nil
+	}
+
+	if req.Header.Get("If-None-Match") == "*" {
+		return app.PreconditionError("%s already exists", req.URL.Path)
+	}
+	version := existing.ifMatch(req)
+	if version < 0 {
+		return app.PreconditionError("%s has been modified", req.URL.Path)
+	}
+	if item.Status == "COMPLETED" || item.Status == "CANCELLED" {
+		err = h.app.FinishTask(ctx, existing.task.ID, version)
+	} else {
+		task.ID, task.Version = existing.task.ID, version
+		_, err = h.app.UpdateTask(ctx, task)
+	}
+	if err != nil {
+		return err
+	}
+	// ETag не возвращается: сервер мог изменить запись, например перенести дату, и клиент должен ее перечитать
+	resp.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (h *Handler) delete(resp http.ResponseWriter, req *http.Request, path string) error {
+	_, _, name := parsePath(path)
+	if len(name) == 0 {
+		return forbiddenError{"only calendar objects can be deleted"}
+	}
+	o, ok, err := h.object(req.Context(), name)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return app.NotFoundError("%s not found", req.URL.Path)
+	}
+	version := o.ifMatch(req)
+	if version < 0 {
+		return app.PreconditionError("%s has been modified", req.URL.Path)
+	}
+	if err := h.app.RemoveTask(req.Context(), o.task.ID, version); err != nil {
+		return err
+	}
+	resp.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// Запрет действия, которое CalDAV не разрешает независимо от прав пользователя
+type forbiddenError struct {
+	message string
+}
+
+func (e forbiddenError) Error() string {
+	return e.message
+}
+
+// Отвечает ошибкой в виде текста: клиенты CalDAV показывают его пользователю как есть
+func writeError(resp http.ResponseWriter, err error) {
+	var forbidden forbiddenError
+	if errors.As(err, &forbidden) {
+		http.Error(resp, forbidden.message, http.StatusForbidden)
+		return
+	}
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(resp, "request is too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	status, ok := httputil.ErrorStatus(app.ErrorCode(err))
+	if !ok {
+		log.Printf("internal error: %v", err)
+		http.Error(resp, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	http.Error(resp, app.ErrorMessage(err), status)
+}
@@ -0,0 +1,347 @@
+package caldav
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go_final_project/internal/app"
+)
+
+// Пространства имен свойств WebDAV
+const (
+	nsDAV    = "DAV:"
+	nsCalDAV = "urn:ietf:params:xml:ns:caldav"
+	nsCS     = "http://calendarserver.org/ns/"
+)
+
+// Префиксы, с которыми свойства записываются в ответ
+var prefixes = map[string]string{nsDAV: "d", nsCalDAV: "c", nsCS: "cs"}
+
+var (
+	propCalendarData = xml.Name{Space: nsCalDAV, Local: "calendar-data"}
+
+	reportQuery    = xml.Name{Space: nsCalDAV, Local: "calendar-query"}
+	reportMultiget = xml.Name{Space: nsCalDAV, Local: "calendar-multiget"}
+)
+
+// Ответ multistatus об одном ресурсе: свойства в виде готового XML или status, если ресурса нет
+type response struct {
+	href   string
+	props  map[xml.Name]string
+	status int
+}
+
+// Имена запрошенных свойств из элемента `<prop>`
+type propNames []xml.Name
+
+func (p *propNames) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	*p = propNames{}
+	for {
+		token, err := d.Token()
+		if err != nil {
+			return err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			*p = append(*p, t.Name)
+			if err := d.Skip(); err != nil {
+				return err
+			}
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+type propfindRequest struct {
+	Prop *propNames `xml:"DAV: prop"`
+}
+
+type compFilter struct {
+	Name    string       `xml:"name,attr"`
+	Filters []compFilter `xml:"urn:ietf:params:xml:ns:caldav comp-filter"`
+}
+
+type reportRequest struct {
+	XMLName xml.Name
+	Prop    *propNames `xml:"DAV: prop"`
+	Hrefs   []string   `xml:"DAV: href"`
+	Filter  *struct {
+		CompFilter compFilter `xml:"urn:ietf:params:xml:ns:caldav comp-filter"`
+	} `xml:"urn:ietf:params:xml:ns:caldav filter"`
+}
+
+// Подходят ли задачи VTODO под фильтр calendar-query. Фильтры по свойствам и времени внутри VTODO не применяются:
+// клиент получает все задачи, что RFC 4791 допускает для фильтров, которые сервер не поддерживает
+func (f compFilter) matchesTodo() bool {
+	if f.Name != "VCALENDAR" {
+		return false
+	}
+	if len(f.Filters) == 0 {
+		return true
+	}
+	for _, filter := range f.Filters {
+		if filter.Name == "VTODO" {
+			return true
+		}
+	}
+	return false
+}
+
+// Читает тело запроса в формате XML. Пустое тело допустимо и оставляет v без изменений
+func decodeBody(body io.Reader, v any) error {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil
+	}
+	if err := xml.Unmarshal(data, v); err != nil {
+		return app.ValidationError("body", "invalid XML: %v", err)
+	}
+	return nil
+}
+
+// Отвечает на PROPFIND. Запрос без списка свойств (allprop) получает все свойства, кроме содержимого записей.
+// Глубина 0 - только сам ресурс, любая другая - ресурс и его прямые потомки
+func (h *Handler) propfind(resp http.ResponseWriter, req *http.Request, path string) error {
+	var body propfindRequest
+	if err := decodeBody(req.Body, &body); err != nil {
+		return err
+	}
+	children := req.Header.Get("Depth") != "0"
+
+	var responses []response
+	switch root, calendar, name := parsePath(path); {
+	case root:
+		responses = append(responses, h.rootResponse())
+		if children {
+			objects, err := h.objects(req.Context())
+			if err != nil {
+				return err
+			}
+			responses = append(responses, h.calendarResponse(objects))
+		}
+	case calendar:
+		objects, err := h.objects(req.Context())
+		if err != nil {
+			return err
+		}
+		responses = append(responses, h.calendarResponse(objects))
+		if children {
+			for _, o := range objects {
+				r, err := h.objectResponse(o)
+				if err != nil {
+					return err
+				}
+				responses = append(responses, r)
+			}
+		}
+	case len(name) > 0:
+		o, ok, err := h.object(req.Context(), name)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return app.NotFoundError("%s not found", req.URL.Path)
+		}
+		r, err := h.objectResponse(o)
+		if err != nil {
+			return err
+		}
+		responses = append(responses, r)
+	default:
+		return app.NotFoundError("%s not found", req.URL.Path)
+	}
+
+	var requested []xml.Name
+	if body.Prop != nil {
+		requested = *body.Prop
+	}
+	writeMultistatus(resp, responses, requested, body.Prop == nil)
+	return nil
+}
+
+// Отвечает на REPORT calendar-query (все задачи календаря) и calendar-multiget (записи по списку адресов)
+func (h *Handler) report(resp http.ResponseWriter, req *http.Request, path string) error {
+	if _, calendar, _ := parsePath(path); !calendar {
+		return forbiddenError{"reports are supported only for the calendar collection"}
+	}
+	var body reportRequest
+	if err := decodeBody(req.Body, &body); err != nil {
+		return err
+	}
+	objects, err := h.objects(req.Context())
+	if err != nil {
+		return err
+	}
+
+	var responses []response
+	switch body.XMLName {
+	case reportQuery:
+		if body.Filter != nil && !body.Filter.CompFilter.matchesTodo() {
+			break
+		}
+		for _, o := range objects {
+			r, err := h.objectResponse(o)
+			if err != nil {
+				return err
+			}
+			responses = append(responses, r)
+		}
+	case reportMultiget:
+		byName := make(map[string]object, len(objects))
+		for _, o := range objects {
+			byName[o.name] = o
+		}
+		for _, href := range body.Hrefs {
+			href = strings.TrimSpace(href)
+			name := ""
+			if decoded, err := url.PathUnescape(href); err == nil {
+				// Клиенты присылают и абсолютные адреса, и пути
+				if u, err := url.Parse(decoded); err == nil {
+					decoded = u.Path
+				}
+				_, _, name = parsePath(strings.TrimPrefix(decoded, Prefix))
+			}
+			o, ok := byName[name]
+			if !ok {
+				responses = append(responses, response{href: href, status: http.StatusNotFound})
+				continue
+			}
+			r, err := h.objectResponse(o)
+			if err != nil {
+				return err
+			}
+			responses = append(responses, r)
+		}
+	default:
+		return forbiddenError{"unsupported report " + body.XMLName.Local}
+	}
+
+	var requested []xml.Name
+	if body.Prop != nil {
+		requested = *body.Prop
+	}
+	writeMultistatus(resp, responses, requested, body.Prop == nil)
+	return nil
+}
+
+// Корень: принципал пользователя и домашний каталог его календарей
+func (h *Handler) rootResponse() response {
+	home := "<d:href>" + escapeXML(Prefix) + "</d:href>"
+	return response{href: Prefix, props: map[xml.Name]string{
+		{Space: nsDAV, Local: "resourcetype"}:           "<d:collection/><d:principal/>",
+		{Space: nsDAV, Local: "displayname"}:            "Планировщик задач",
+		{Space: nsDAV, Local: "current-user-principal"}: home,
+		{Space: nsDAV, Local: "principal-URL"}:          home,
+		{Space: nsCalDAV, Local: "calendar-home-set"}:   home,
+	}}
+}
+
+func (h *Handler) calendarResponse(objects []object) response {
+	tag := ctag(objects)
+	return response{href: Prefix + collection, props: map[xml.Name]string{
+		{Space: nsDAV, Local: "resourcetype"}:                        "<d:collection/><c:calendar/>",
+		{Space: nsDAV, Local: "displayname"}:                         "Задачи",
+		{Space: nsDAV, Local: "current-user-principal"}:              "<d:href>" + escapeXML(Prefix) + "</d:href>",
+		{Space: nsDAV, Local: "getetag"}:                             escapeXML(`"` + tag + `"`),
+		{Space: nsCS, Local: "getctag"}:                              tag,
+		{Space: nsCalDAV, Local: "supported-calendar-component-set"}: `<c:comp name="VTODO"/>`,
+		{Space: nsDAV, Local: "supported-report-set"}: "<d:supported-report><d:report><c:calendar-query/></d:report></d:supported-report>" +
+			"<d:supported-report><d:report><c:calendar-multiget/></d:report></d:supported-report>",
+	}}
+}
+
+func (h *Handler) objectResponse(o object) (response, error) {
+	data, err := o.calendarData()
+	if err != nil {
+		return response{}, err
+	}
+	return response{href: Prefix + collection + url.PathEscape(o.name), props: map[xml.Name]string{
+		{Space: nsDAV, Local: "resourcetype"}:   "",
+		{Space: nsDAV, Local: "getetag"}:        escapeXML(o.etag()),
+		{Space: nsDAV, Local: "getcontenttype"}: "text/calendar; charset=utf-8; component=VTODO",
+		propCalendarData:                        escapeXML(data),
+	}}, nil
+}
+
+// Записывает ответ 207 Multi-Status. Запрошенные свойства, которых у ресурса нет, перечисляются со статусом 404.
+// Если all, записываются все свойства, кроме содержимого записей
+func writeMultistatus(resp http.ResponseWriter, responses []response, requested []xml.Name, all bool) {
+	var out strings.Builder
+	out.WriteString(`<?xml version="1.0" encoding="utf-8"?>` + "\n")
+	out.WriteString(`<d:multistatus xmlns:d="DAV:" xmlns:c="` + nsCalDAV + `" xmlns:cs="` + nsCS + `">`)
+	for _, r := range responses {
+		out.WriteString("<d:response><d:href>" + escapeXML(r.href) + "</d:href>")
+		if r.status != 0 {
+			out.WriteString("<d:status>" + statusLine(r.status) + "</d:status></d:response>")
+			continue
+		}
+
+		names := requested
+		if all {
+			names = nil
+			for name := range r.props {
+				if name != propCalendarData {
+					names = append(names, name)
+				}
+			}
+			sort.Slice(names, func(i, j int) bool { return names[i].Local < names[j].Local })
+		}
+		var found, missing strings.Builder
+		for _, name := range names {
+			if value, ok := r.props[name]; ok {
+				found.WriteString(element(name, value))
+			} else {
+				missing.WriteString(element(name, ""))
+			}
+		}
+		if found.Len() > 0 {
+			out.WriteString("<d:propstat><d:prop>" + found.String() + "</d:prop><d:status>" + statusLine(http.StatusOK) + "</d:status></d:propstat>")
+		}
+		if missing.Len() > 0 {
+			out.WriteString("<d:propstat><d:prop>" + missing.String() + "</d:prop><d:status>" + statusLine(http.StatusNotFound) + "</d:status></d:propstat>")
+		}
+		out.WriteString("</d:response>")
+	}
+	out.WriteString("</d:multistatus>\n")
+
+	resp.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	resp.WriteHeader(http.StatusMultiStatus)
+	if _, err := io.WriteString(resp, out.String()); err != nil {
+		log.Printf("caldav.writeMultistatus: %v", err)
+	}
+}
+
+// Элемент свойства с готовым содержимым value. Свойства из незнакомых пространств имен записываются со своим xmlns
+func element(name xml.Name, value string) string {
+	tag, attr := name.Local, ""
+	if prefix, ok := prefixes[name.Space]; ok {
+		tag = prefix + ":" + name.Local
+	} else {
+		attr = ` xmlns="` + escapeXML(name.Space) + `"`
+	}
+	if len(value) == 0 {
+		return "<" + tag + attr + "/>"
+	}
+	return "<" + tag + attr + ">" + value + "</" + tag + ">"
+}
+
+func statusLine(status int) string {
+	return "HTTP/1.1 " + strconv.Itoa(status) + " " + http.StatusText(status)
+}
+
+func escapeXML(s string) string {
+	var out strings.Builder
+	xml.EscapeText(&out, []byte(s)) // strings.Builder не возвращает ошибок записи
+	return out.String()
+}
@@ -0,0 +1,52 @@
+package caldav
+
+import (
+	"time"
+
+	"go_final_project/internal/app"
+	"go_final_project/internal/config"
+	"go_final_project/internal/ical"
+)
+
+// Разбирает календарь из запроса PUT: в нем должна быть ровно одна задача VTODO с UID
+func parseTodo(data []byte) (ical.Item, error) {
+	items, err := ical.Parse(data)
+	if err != nil {
+		return ical.Item{}, app.ValidationError("calendar", "%v", err)
+	}
+	if len(items) != 1 {
+		return ical.Item{}, app.ValidationError("calendar", "calendar object must contain exactly one component, got %d", len(items))
+	}
+	item := items[0]
+	if item.Kind != ical.KindTodo {
+		return ical.Item{}, forbiddenError{"only VTODO components are supported"}
+	}
+	if len(item.UID) == 0 {
+		return ical.Item{}, app.ValidationError("uid", "VTODO has no UID")
+	}
+	return item, nil
+}
+
+// Задача из записи VTODO. Клиенты сохраняют незнакомое им свойство X-TODO-REPEAT, даже если пользователь изменил
+// повторение, поэтому правило из X-TODO-REPEAT берется, только если RRULE с ним совпадает
+func itemTask(item ical.Item) (app.Task, error) {
+	task := app.Task{Title: item.Summary, Comment: item.Description, Date: item.Date}
+	if len(task.Date) == 0 {
+		task.Date = time.Now().Format(config.DBDateFormat)
+	}
+
+	if len(item.Repeat) > 0 {
+		if rrule, err := ical.RRule(item.Repeat); err != nil || rrule == item.RRule {
+			task.Repeat = item.Repeat
+			return task, nil
+		}
+	}
+	if len(item.RRule) > 0 {
+		repeat, err := ical.Repeat(item.RRule, task.Date)
+		if err != nil {
+			return task, app.ValidationError("repeat", "%v", err)
+		}
+		task.Repeat = repeat
+	}
+	return task, nil
+}
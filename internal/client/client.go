@@ -0,0 +1,218 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"go_final_project/internal/app"
+	"go_final_project/internal/importer"
+)
+
+// Клиент api сервиса. Ошибки api возвращаются как *app.Error с кодом из ответа,
+// поэтому их можно разбирать так же, как ошибки app.Application
+type Client struct {
+	baseURL string
+	token   string
+	http    *http.Client
+}
+
+// Создает клиента сервера baseURL. token - токен после входа или API-ключ, пустой для сервера без авторизации
+func New(baseURL, token string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{baseURL: strings.TrimSuffix(baseURL, "/"), token: token, http: httpClient}
+}
+
+// Входит по паролю и возвращает токен
+func (c *Client) Signin(ctx context.Context, password string) (string, error) {
+	var resp struct {
+		Token string `json:"token"`
+	}
+	err := c.do(ctx, http.MethodPost, "/api/signin", "", map[string]string{"password": password}, &resp)
+	if err != nil {
+		return "", fmt.Errorf("Client.Signin: %w", err)
+	}
+	return resp.Token, nil
+}
+
+// Обменивает токен клиента на новый с полным сроком действия. Старый токен после обмена недействителен
+func (c *Client) RefreshToken(ctx context.Context) (string, error) {
+	var resp struct {
+		Token string `json:"token"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/api/token/refresh", "", nil, &resp); err != nil {
+		return "", fmt.Errorf("Client.RefreshToken: %w", err)
+	}
+	c.token = resp.Token
+	return resp.Token, nil
+}
+
+func (c *Client) AddTask(ctx context.Context, task app.Task) (app.Task, error) {
+	var created app.Task
+	if err := c.do(ctx, http.MethodPost, "/api/v1/tasks", "", task, &created); err != nil {
+		return app.Task{}, fmt.Errorf("Client.AddTask: %w", err)
+	}
+	return created, nil
+}
+
+func (c *Client) GetTask(ctx context.Context, id string) (app.Task, error) {
+	var task app.Task
+	if err := c.do(ctx, http.MethodGet, "/api/v1/tasks/"+url.PathEscape(id), "", nil, &task); err != nil {
+		return app.Task{}, fmt.Errorf("Client.GetTask: %w", err)
+	}
+	return task, nil
+}
+
+// Возвращает ближайшие задачи, а с непустым search - найденные по строке или дате
+func (c *Client) GetTaskList(ctx context.Context, search string) ([]app.Task, error) {
+	path := "/api/v1/tasks"
+	if len(search) > 0 {
+		path += "?search=" + url.QueryEscape(search)
+	}
+	var list app.TaskList
+	if err := c.do(ctx, http.MethodGet, path, "", nil, &list); err != nil {
+		return nil, fmt.Errorf("Client.GetTaskList: %w", err)
+	}
+	return list.List, nil
+}
+
+// Изменяет только поля задачи из patch и возвращает измененную задачу
+func (c *Client) PatchTask(ctx context.Context, id string, patch map[string]any) (app.Task, error) {
+	var task app.Task
+	err := c.do(ctx, http.MethodPatch, "/api/v1/tasks/"+url.PathEscape(id), "application/merge-patch+json", patch, &task)
+	if err != nil {
+		return app.Task{}, fmt.Errorf("Client.PatchTask: %w", err)
+	}
+	return task, nil
+}
+
+func (c *Client) FinishTask(ctx context.Context, id string) error {
+	if err := c.do(ctx, http.MethodPost, "/api/v1/tasks/"+url.PathEscape(id)+"/complete", "", nil, nil); err != nil {
+		return fmt.Errorf("Client.FinishTask: %w", err)
+	}
+	return nil
+}
+
+func (c *Client) RemoveTask(ctx context.Context, id string) error {
+	if err := c.do(ctx, http.MethodDelete, "/api/v1/tasks/"+url.PathEscape(id), "", nil, nil); err != nil {
+		return fmt.Errorf("Client.RemoveTask: %w", err)
+	}
+	return nil
+}
+
+// Выгружает все задачи в формате format (json, csv или ics) в w. component для ics - vevent или vtodo, пустой - по умолчанию
+func (c *Client) Export(ctx context.Context, format, component string, w io.Writer) error {
+	query := url.Values{"format": {format}}
+	if len(component) > 0 {
+		query.Set("component", component)
+	}
+	resp, err := c.send(ctx, http.MethodGet, "/api/export?"+query.Encode(), "", nil)
+	if err != nil {
+		return fmt.Errorf("Client.Export: %w", err)
+	}
+	defer resp.Body.Close()
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return fmt.Errorf("Client.Export: %v", err)
+	}
+	return nil
+}
+
+// Импортирует задачи из файла data формата format (пустой определяется сервером). С dryRun задачи не создаются
+func (c *Client) Import(ctx context.Context, data []byte, format string, dryRun bool) (importer.Report, error) {
+	query := url.Values{}
+	if len(format) > 0 {
+		query.Set("format", format)
+	}
+	if dryRun {
+		query.Set("dry_run", "true")
+	}
+	resp, err := c.send(ctx, http.MethodPost, "/api/import?"+query.Encode(), "application/octet-stream", bytes.NewReader(data))
+	if err != nil {
+		return importer.Report{}, fmt.Errorf("Client.Import: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var report importer.Report
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		return importer.Report{}, fmt.Errorf("Client.Import: %v", err)
+	}
+	return report, nil
+}
+
+// Выполняет запрос к api: body передается в формате JSON, ответ разбирается в result
+func (c *Client) do(ctx context.Context, method, path, contentType string, body, result any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+		if len(contentType) == 0 {
+			contentType = "application/json"
+		}
+	}
+
+	resp, err := c.send(ctx, method, path, contentType, reader)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if result == nil || len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, result)
+}
+
+// Отправляет запрос к api и возвращает успешный ответ, тело которого нужно закрыть. Ответ с ошибкой разбирается в *app.Error
+func (c *Client) send(ctx context.Context, method, path, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if len(contentType) > 0 {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if len(c.token) > 0 {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		return nil, responseError(resp.StatusCode, data)
+	}
+	return resp, nil
+}
+
+// Разбирает тело ответа с ошибкой api
+func responseError(status int, data []byte) error {
+	var body struct {
+		Error  string            `json:"error"`
+		Code   app.Code          `json:"code"`
+		Fields map[string]string `json:"fields"`
+	}
+	if err := json.Unmarshal(data, &body); err != nil || len(body.Code) == 0 {
+		return fmt.Errorf("unexpected response %d %s", status, http.StatusText(status))
+	}
+	return &app.Error{Code: body.Code, Message: body.Error, Fields: body.Fields}
+}
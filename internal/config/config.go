@@ -1,45 +1,280 @@
 package config
 
 import (
-	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
-// Структура для взаимодествия api, реализующая методы получения базовых настроек
+// Структура для взаимодествия api, реализующая методы получения базовых настроек.
+// Значение настройки берется из флагов командной строки, затем из переменных окружения,
+// затем из файла настроек, а если нигде не задано - из значений по умолчанию.
+// Настройки хранятся в неизменяемом снимке, который Reload атомарно заменяет новым
 type Handler struct {
+	path    string            // путь к файлу настроек, пустой - настройки без файла
+	flags   map[string]string // значения флагов командной строки по именам переменных окружения
+	current atomic.Pointer[snapshot]
+	mu      sync.Mutex // не дает перечитывать настройки одновременно
 }
 
+// Настройки только из переменных окружения и значений по умолчанию
 func New() *Handler {
-	return &Handler{}
+	h := &Handler{}
+	h.store(newSnapshot(nil, nil))
+	return h
 }
 
-func (h Handler) DBPath() string {
-	dbPath, ok := os.LookupEnv(dbPathEnv)
-	if !ok {
-		dbPath = defaultDBPath
-	}
-	return dbPath
+func (h *Handler) DBPath() string {
+	return h.value(dbPathEnv)
 }
 
-func (h Handler) Port() string {
-	webDirPath, ok := os.LookupEnv(portEnv)
-	if !ok {
-		webDirPath = defaultPort
-	}
-	return webDirPath
+func (h *Handler) Port() string {
+	return h.value(portEnv)
+}
+
+func (h *Handler) WebDirPath() string {
+	return h.value(webDirEnv)
+}
+
+func (h *Handler) Password() string {
+	return h.value(passwordEnv)
+}
+
+// Секрет для подписи JWT-токенов. Пустая строка означает, что секрет будет сгенерирован при запуске
+func (h *Handler) Secret() string {
+	return h.value(secretEnv)
+}
+
+// Время жизни выдаваемых JWT-токенов
+func (h *Handler) TokenTTL() time.Duration {
+	return h.duration(tokenTTLEnv)
+}
+
+// Максимальное время чтения запроса вместе с телом
+func (h *Handler) ReadTimeout() time.Duration {
+	return h.duration(readTimeoutEnv)
+}
+
+// Максимальное время от конца чтения заголовков запроса до конца записи ответа
+func (h *Handler) WriteTimeout() time.Duration {
+	return h.duration(writeTimeoutEnv)
+}
+
+// Сколько простаивающее keep-alive соединение ждет следующего запроса
+func (h *Handler) IdleTimeout() time.Duration {
+	return h.duration(idleTimeoutEnv)
+}
+
+// За какое время при остановке сервер должен завершить начатые запросы, фоновые задачи и закрыть базу
+func (h *Handler) ShutdownTimeout() time.Duration {
+	return h.duration(shutdownTimeoutEnv)
+}
+
+// Путь к файлу сертификата для TLS. Вместе с TLSKey включает HTTPS
+func (h *Handler) TLSCert() string {
+	return h.value(tlsCertEnv)
+}
+
+// Путь к файлу закрытого ключа сертификата из TLSCert
+func (h *Handler) TLSKey() string {
+	return h.value(tlsKeyEnv)
+}
+
+// Режим разработки: если сертификат не указан, HTTPS работает с самоподписанным сертификатом,
+// который создается при первом запуске и сохраняется рядом с базой
+func (h *Handler) TLSDev() bool {
+	return h.bool(tlsDevEnv)
 }
 
-func (h Handler) WebDirPath() string {
-	webDirPath, ok := os.LookupEnv(webDirEnv)
-	if !ok {
-		webDirPath = defaultWebDir
+// Работает ли сервер по HTTPS
+func (h *Handler) TLSEnabled() bool {
+	return (len(h.TLSCert()) > 0 && len(h.TLSKey()) > 0) || h.TLSDev()
+}
+
+// Каталог, в котором хранится самоподписанный сертификат режима разработки
+func (h *Handler) TLSCacheDir() string {
+	return filepath.Dir(h.DBPath())
+}
+
+// Адрес OpenID Connect провайдера. Пустая строка означает, что вход через OIDC отключен
+func (h *Handler) OIDCIssuer() string {
+	return h.value(oidcIssuerEnv)
+}
+
+func (h *Handler) OIDCClientID() string {
+	return h.value(oidcClientIDEnv)
+}
+
+func (h *Handler) OIDCClientSecret() string {
+	return h.value(oidcClientSecretEnv)
+}
+
+// Адрес, на который провайдер возвращает пользователя после входа, должен вести на `/api/oidc/callback`
+func (h *Handler) OIDCRedirectURL() string {
+	return h.value(oidcRedirectURLEnv)
+}
+
+// Пользователи провайдера, которым разрешен вход: subject или адреса почты, `*` - все.
+// Пустой список запрещает вход через OIDC всем
+func (h *Handler) OIDCAllowed() []string {
+	var allowed []string
+	for _, entry := range strings.Split(h.value(oidcAllowedEnv), ",") {
+		if entry = strings.TrimSpace(entry); len(entry) > 0 {
+			allowed = append(allowed, entry)
+		}
 	}
-	return webDirPath
+	return allowed
+}
+
+// Максимальное время обработки запроса к api
+func (h *Handler) RequestTimeout() time.Duration {
+	return h.duration(requestTimeoutEnv)
+}
+
+// Максимальное время выгрузки и загрузки задач и запроса CalDAV: они обрабатывают все задачи сразу
+// и не укладываются в RequestTimeout на больших списках
+func (h *Handler) TransferTimeout() time.Duration {
+	return h.duration(transferTimeoutEnv)
+}
+
+// Сколько запрос ждет, пока другая транзакция освободит базу
+func (h *Handler) DBBusyTimeout() time.Duration {
+	return h.duration(dbBusyTimeoutEnv)
+}
+
+// Каталог автоматических резервных копий базы, пустой отключает их
+func (h *Handler) BackupDir() string {
+	return h.value(backupDirEnv)
+}
+
+// Как часто сохраняется резервная копия базы
+func (h *Handler) BackupInterval() time.Duration {
+	return h.duration(backupIntervalEnv)
+}
+
+// Сколько последних резервных копий хранится, более старые удаляются
+func (h *Handler) BackupKeep() int {
+	return h.int(backupKeepEnv)
+}
+
+// Сжимаются ли резервные копии gzip
+func (h *Handler) BackupGzip() bool {
+	return h.bool(backupGzipEnv)
+}
+
+// Сколько ждать ответа получателя вебхука
+func (h *Handler) WebhookTimeout() time.Duration {
+	return h.duration(webhookTimeoutEnv)
+}
+
+// Сколько раз пытаться доставить событие, прежде чем отметить доставку неудачной
+func (h *Handler) WebhookMaxAttempts() int {
+	return h.int(webhookMaxAttemptsEnv)
+}
+
+// Пауза перед первой повторной доставкой события, перед каждой следующей она удваивается
+func (h *Handler) WebhookRetryDelay() time.Duration {
+	return h.duration(webhookRetryDelayEnv)
 }
 
-func (h Handler) Password() string {
-	password, ok := os.LookupEnv(passwordEnv)
-	if !ok {
-		password = defaultPassword
+// Имена, адреса и подсети (CIDR) получателей вебхуков, которым разрешена отправка в локальную сеть и на сам сервер
+func (h *Handler) WebhookAllowedHosts() []string {
+	var allowed []string
+	for _, entry := range strings.Split(h.value(webhookAllowedEnv), ",") {
+		if entry = strings.TrimSpace(entry); len(entry) > 0 {
+			allowed = append(allowed, entry)
+		}
 	}
-	return password
+	return allowed
+}
+
+// Максимальное число задач в одном импортируемом файле
+func (h *Handler) ImportMaxRows() int {
+	return h.int(importMaxRowsEnv)
+}
+
+// Максимальный размер импортируемого файла в байтах
+func (h *Handler) ImportMaxBytes() int64 {
+	return int64(h.int(importMaxBytesEnv))
+}
+
+// На сколько дней вперед календарь для подписки показывает даты задач
+func (h *Handler) CalendarDays() int {
+	return h.int(calendarDaysEnv)
+}
+
+// Максимальное число задач, возвращаемых списком
+func (h *Handler) TaskListLimit() int64 {
+	return int64(h.int(listLimitEnv))
+}
+
+// Максимальное число операций в одном пакетном запросе
+func (h *Handler) BatchMaxOps() int {
+	return h.int(batchMaxOpsEnv)
+}
+
+// Формат, в котором в строке поиска указывается дата для поиска задач на этот день
+func (h *Handler) SearchDateFormat() string {
+	return h.value(searchDateFormatEnv)
+}
+
+// Число неудачных попыток входа с одного адреса до начала задержек
+func (h *Handler) SigninFreeAttempts() int {
+	return h.int(signinFreeAttemptsEnv)
+}
+
+// Начальная задержка после неудачной попытки входа, удваивается с каждой следующей
+func (h *Handler) SigninBackoffBase() time.Duration {
+	return h.duration(signinBackoffBaseEnv)
+}
+
+// Число неудачных попыток, после которого адрес блокируется
+func (h *Handler) SigninLockoutAttempts() int {
+	return h.int(signinLockoutAttemptsEnv)
+}
+
+// Время блокировки адреса
+func (h *Handler) SigninLockoutTime() time.Duration {
+	return h.duration(signinLockoutTimeEnv)
+}
+
+// Число неудачных попыток входа со всех адресов за SigninGlobalWindow, после которого попытки входа замедляются
+func (h *Handler) SigninGlobalLimit() int {
+	return h.int(signinGlobalLimitEnv)
+}
+
+// Окно, за которое считается общий лимит неудачных попыток входа
+func (h *Handler) SigninGlobalWindow() time.Duration {
+	return h.duration(signinGlobalWindowEnv)
+}
+
+// Как часто проверяется, не изменился ли файл настроек
+func (h *Handler) ConfigPollInterval() time.Duration {
+	return h.duration(configPollIntervalEnv)
+}
+
+func (h *Handler) store(s snapshot) {
+	h.current.Store(&s)
+}
+
+func (h *Handler) snapshot() snapshot {
+	return *h.current.Load()
+}
+
+func (h *Handler) value(env string) string {
+	return h.snapshot().value(env)
+}
+
+func (h *Handler) duration(env string) time.Duration {
+	return h.snapshot().duration(env)
+}
+
+func (h *Handler) int(env string) int {
+	return h.snapshot().int(env)
+}
+
+func (h *Handler) bool(env string) bool {
+	return h.snapshot().bool(env)
 }
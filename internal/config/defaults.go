@@ -1,17 +1,152 @@
 package config
 
 const (
+	configEnv             = "TODO_CONFIG"
+	configPollIntervalEnv = "TODO_CONFIG_POLL_INTERVAL"
+
 	dbPathEnv   = "TODO_DBPATH"
 	webDirEnv   = "TODO_WEBDIR"
 	portEnv     = "TODO_PORT"
 	passwordEnv = "TODO_PASSWORD"
+	secretEnv   = "TODO_SECRET"
+	tokenTTLEnv = "TODO_TOKEN_TTL"
+
+	oidcIssuerEnv       = "TODO_OIDC_ISSUER"
+	oidcClientIDEnv     = "TODO_OIDC_CLIENT_ID"
+	oidcClientSecretEnv = "TODO_OIDC_CLIENT_SECRET"
+	oidcRedirectURLEnv  = "TODO_OIDC_REDIRECT_URL"
+	oidcAllowedEnv      = "TODO_OIDC_ALLOWED"
+
+	readTimeoutEnv     = "TODO_READ_TIMEOUT"
+	writeTimeoutEnv    = "TODO_WRITE_TIMEOUT"
+	idleTimeoutEnv     = "TODO_IDLE_TIMEOUT"
+	shutdownTimeoutEnv = "TODO_SHUTDOWN_TIMEOUT"
+	requestTimeoutEnv  = "TODO_REQUEST_TIMEOUT"
+	transferTimeoutEnv = "TODO_TRANSFER_TIMEOUT"
+	dbBusyTimeoutEnv   = "TODO_DB_BUSY_TIMEOUT"
+
+	tlsCertEnv = "TODO_TLS_CERT"
+	tlsKeyEnv  = "TODO_TLS_KEY"
+	tlsDevEnv  = "TODO_TLS_DEV"
+
+	backupDirEnv      = "TODO_BACKUP_DIR"
+	backupIntervalEnv = "TODO_BACKUP_INTERVAL"
+	backupKeepEnv     = "TODO_BACKUP_KEEP"
+	backupGzipEnv     = "TODO_BACKUP_GZIP"
+
+	webhookTimeoutEnv     = "TODO_WEBHOOK_TIMEOUT"
+	webhookMaxAttemptsEnv = "TODO_WEBHOOK_MAX_ATTEMPTS"
+	webhookRetryDelayEnv  = "TODO_WEBHOOK_RETRY_DELAY"
+	webhookAllowedEnv     = "TODO_WEBHOOK_ALLOWED_HOSTS"
+
+	importMaxRowsEnv  = "TODO_IMPORT_MAX_ROWS"
+	importMaxBytesEnv = "TODO_IMPORT_MAX_BYTES"
+	calendarDaysEnv   = "TODO_CALENDAR_DAYS"
+
+	listLimitEnv        = "TODO_LIST_LIMIT"
+	batchMaxOpsEnv      = "TODO_BATCH_MAX_OPS"
+	searchDateFormatEnv = "TODO_SEARCH_DATE_FORMAT"
+
+	signinFreeAttemptsEnv    = "TODO_SIGNIN_FREE_ATTEMPTS"
+	signinBackoffBaseEnv     = "TODO_SIGNIN_BACKOFF_BASE"
+	signinLockoutAttemptsEnv = "TODO_SIGNIN_LOCKOUT_ATTEMPTS"
+	signinLockoutTimeEnv     = "TODO_SIGNIN_LOCKOUT_TIME"
+	signinGlobalLimitEnv     = "TODO_SIGNIN_GLOBAL_LIMIT"
+	signinGlobalWindowEnv    = "TODO_SIGNIN_GLOBAL_WINDOW"
+
+	defaultConfigPollInterval = "2s"
 
 	defaultDBPath   = "./scheduler.db"
 	defaultWebDir   = "web"
 	defaultPort     = "7540"
 	defaultPassword = ""
+	defaultSecret   = ""
+	defaultTokenTTL = "8h"
+
+	defaultReadTimeout     = "15s"
+	defaultWriteTimeout    = "30s" // больше RequestTimeout, чтобы ответ о превышении времени успел дойти до клиента
+	defaultIdleTimeout     = "60s"
+	defaultShutdownTimeout = "15s"
+	defaultRequestTimeout  = "10s"
+	defaultTransferTimeout = "5m"
+	defaultDBBusyTimeout   = "5s"
+
+	defaultBackupInterval = "24h"
+	defaultBackupKeep     = "7"
+
+	defaultWebhookTimeout     = "10s"
+	defaultWebhookMaxAttempts = "8"
+	defaultWebhookRetryDelay  = "30s"
 
-	TaskReturnLimit = 50
-	DBDateFormat    = "20060102"
-	WebDateFormat   = "02.01.2006"
+	defaultImportMaxRows  = "5000"
+	defaultImportMaxBytes = "16777216"
+	defaultCalendarDays   = "90"
+
+	defaultListLimit        = "50"
+	defaultBatchMaxOps      = "100"
+	defaultSearchDateFormat = "02.01.2006"
+
+	defaultSigninFreeAttempts    = "3"
+	defaultSigninBackoffBase     = "1s"
+	defaultSigninLockoutAttempts = "10"
+	defaultSigninLockoutTime     = "15m"
+	defaultSigninGlobalLimit     = "100"
+	defaultSigninGlobalWindow    = "1m"
+
+	DBDateFormat = "20060102" // формат дат в базе и в api, не настраивается, так как в нем хранятся задачи
 )
+
+// Все настройки сервиса. Ключ в файле настроек и имя флага получаются из имени переменной окружения
+var settings = []setting{
+	{configPollIntervalEnv, defaultConfigPollInterval, kindDuration, 0, "как часто проверять изменения файла настроек"},
+
+	{dbPathEnv, defaultDBPath, kindString, attrRestart, "путь к файлу базы"},
+	{webDirEnv, defaultWebDir, kindString, attrRestart, "каталог с файлами фронтенда"},
+	{portEnv, defaultPort, kindPort, attrRestart, "порт сервера"},
+	{passwordEnv, defaultPassword, kindString, attrSecret, "пароль для входа, пустой отключает авторизацию"},
+	{secretEnv, defaultSecret, kindString, attrSecret, "секрет для подписи токенов, пустой генерируется при запуске"},
+	{tokenTTLEnv, defaultTokenTTL, kindDuration, 0, "время жизни токенов"},
+
+	{oidcIssuerEnv, "", kindString, 0, "адрес OpenID Connect провайдера"},
+	{oidcClientIDEnv, "", kindString, 0, "идентификатор клиента у OpenID Connect провайдера"},
+	{oidcClientSecretEnv, "", kindString, attrSecret, "секрет клиента у OpenID Connect провайдера"},
+	{oidcRedirectURLEnv, "", kindString, 0, "адрес возврата после входа через OpenID Connect"},
+	{oidcAllowedEnv, "", kindString, 0, "через запятую subject или подтвержденные адреса почты пользователей провайдера, которым разрешен вход, * - всем"},
+
+	{readTimeoutEnv, defaultReadTimeout, kindDuration, attrRestart, "максимальное время чтения запроса"},
+	{writeTimeoutEnv, defaultWriteTimeout, kindDuration, attrRestart, "максимальное время записи ответа"},
+	{idleTimeoutEnv, defaultIdleTimeout, kindDuration, attrRestart, "время простоя keep-alive соединения"},
+	{shutdownTimeoutEnv, defaultShutdownTimeout, kindDuration, 0, "максимальное время остановки сервера"},
+	{requestTimeoutEnv, defaultRequestTimeout, kindDuration, 0, "максимальное время обработки запроса к api"},
+	{transferTimeoutEnv, defaultTransferTimeout, kindDuration, 0, "максимальное время выгрузки и загрузки задач и запроса CalDAV"},
+	{dbBusyTimeoutEnv, defaultDBBusyTimeout, kindDuration, attrRestart, "сколько запрос ждет, пока другая транзакция освободит базу"},
+
+	{tlsCertEnv, "", kindString, attrRestart, "путь к сертификату для HTTPS"},
+	{tlsKeyEnv, "", kindString, attrRestart, "путь к ключу сертификата для HTTPS"},
+	{tlsDevEnv, "false", kindBool, attrRestart, "HTTPS с самоподписанным сертификатом"},
+
+	{backupDirEnv, "", kindString, 0, "каталог для автоматических резервных копий базы, пустой отключает их"},
+	{backupIntervalEnv, defaultBackupInterval, kindDuration, 0, "как часто сохранять резервную копию базы"},
+	{backupKeepEnv, defaultBackupKeep, kindInt, 0, "сколько последних резервных копий хранить"},
+	{backupGzipEnv, "false", kindBool, 0, "сжимать резервные копии gzip"},
+
+	{webhookTimeoutEnv, defaultWebhookTimeout, kindDuration, 0, "сколько ждать ответа получателя вебхука"},
+	{webhookMaxAttemptsEnv, defaultWebhookMaxAttempts, kindInt, 0, "сколько раз пытаться доставить событие вебхуку"},
+	{webhookRetryDelayEnv, defaultWebhookRetryDelay, kindDuration, 0, "пауза перед повторной доставкой, удваивается с каждой попыткой"},
+	{webhookAllowedEnv, "", kindString, 0, "через запятую имена, адреса и подсети получателей вебхуков в локальной сети, которым разрешена отправка"},
+
+	{importMaxRowsEnv, defaultImportMaxRows, kindInt, 0, "максимальное число задач в одном импортируемом файле"},
+	{importMaxBytesEnv, defaultImportMaxBytes, kindInt, 0, "максимальный размер импортируемого файла в байтах"},
+	{calendarDaysEnv, defaultCalendarDays, kindInt, 0, "на сколько дней вперед календарь для подписки показывает задачи"},
+
+	{listLimitEnv, defaultListLimit, kindInt, 0, "максимальное число задач в списке"},
+	{batchMaxOpsEnv, defaultBatchMaxOps, kindInt, 0, "максимальное число операций в одном пакетном запросе"},
+	{searchDateFormatEnv, defaultSearchDateFormat, kindDateFormat, 0, "формат даты в строке поиска"},
+
+	{signinFreeAttemptsEnv, defaultSigninFreeAttempts, kindInt, 0, "число неудачных попыток входа до начала задержек"},
+	{signinBackoffBaseEnv, defaultSigninBackoffBase, kindDuration, 0, "начальная задержка после неудачной попытки входа"},
+	{signinLockoutAttemptsEnv, defaultSigninLockoutAttempts, kindInt, 0, "число неудачных попыток, после которого адрес блокируется"},
+	{signinLockoutTimeEnv, defaultSigninLockoutTime, kindDuration, 0, "время блокировки адреса"},
+	{signinGlobalLimitEnv, defaultSigninGlobalLimit, kindInt, 0, "число неудачных попыток входа со всех адресов за окно, после которого вход замедляется"},
+	{signinGlobalWindowEnv, defaultSigninGlobalWindow, kindDuration, 0, "окно общего лимита неудачных попыток входа"},
+}
@@ -0,0 +1,223 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Тип значения настройки, по которому оно проверяется при запуске
+type kind int
+
+const (
+	kindString kind = iota
+	kindInt
+	kindBool
+	kindDuration
+	kindPort
+	kindDateFormat
+)
+
+// Особенности настройки
+type attr int
+
+const (
+	attrSecret  attr = 1 << iota // значение не пишется в журнал
+	attrRestart                  // новое значение применяется только после перезапуска сервера
+)
+
+type setting struct {
+	env   string
+	value string // значение по умолчанию
+	kind  kind
+	attr  attr
+	usage string
+}
+
+// Ключ настройки в файле: имя переменной без префикса TODO_ в нижнем регистре, например `read_timeout`
+func (s setting) key() string {
+	return strings.ToLower(strings.TrimPrefix(s.env, "TODO_"))
+}
+
+// Имя флага командной строки: ключ из файла, в котором подчеркивания заменены дефисами, например `-read-timeout`
+func (s setting) flag() string {
+	return strings.ReplaceAll(s.key(), "_", "-")
+}
+
+func findSetting(env string) (setting, bool) {
+	for _, s := range settings {
+		if s.env == env {
+			return s, true
+		}
+	}
+	return setting{}, false
+}
+
+// Загружает настройки из файла, переменных окружения и флагов командной строки args.
+// Флаги важнее переменных окружения, переменные важнее файла, а файл - значений по умолчанию.
+// Путь к файлу задается флагом -config или переменной TODO_CONFIG. Аргументы после флагов возвращаются вторым значением
+func Load(args []string) (*Handler, []string, error) {
+	h := &Handler{flags: make(map[string]string)}
+
+	fs := flag.NewFlagSet("todo", flag.ContinueOnError)
+	configPath := fs.String("config", os.Getenv(configEnv), "путь к файлу настроек в формате YAML или TOML")
+	flagEnvs := make(map[string]string, len(settings))
+	for _, s := range settings {
+		flagEnvs[s.flag()] = s.env
+		if s.kind == kindBool {
+			value, _ := strconv.ParseBool(s.value)
+			fs.Bool(s.flag(), value, s.usage)
+		} else {
+			fs.String(s.flag(), s.value, s.usage)
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, fmt.Errorf("config.Load: %w", err)
+	}
+	fs.Visit(func(f *flag.Flag) {
+		if env, ok := flagEnvs[f.Name]; ok {
+			h.flags[env] = f.Value.String()
+		}
+	})
+
+	h.path = *configPath
+	var file map[string]string
+	if len(h.path) > 0 {
+		var err error
+		file, err = readFile(h.path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("config.Load: %v", err)
+		}
+	}
+	h.store(newSnapshot(file, h.flags))
+	return h, fs.Args(), nil
+}
+
+// Читает файл настроек в формате TOML, если у него расширение `.toml`, иначе в формате YAML.
+// Вложенные разделы соединяются с ключами через подчеркивание, поэтому `oidc: {issuer: ...}`
+// и раздел `[oidc]` с ключом `issuer` равнозначны `oidc_issuer: ...`
+func readFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("readFile: %v", err)
+	}
+	var raw map[string]any
+	if strings.EqualFold(filepath.Ext(path), ".toml") {
+		err = toml.Unmarshal(data, &raw)
+	} else {
+		err = yaml.Unmarshal(data, &raw)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("readFile: %s: %v", path, err)
+	}
+
+	values := make(map[string]string)
+	if err := flatten("", raw, values); err != nil {
+		return nil, fmt.Errorf("readFile: %s: %v", path, err)
+	}
+	return values, nil
+}
+
+func flatten(prefix string, raw map[string]any, values map[string]string) error {
+	for key, value := range raw {
+		key = prefix + strings.ToLower(key)
+		switch value := value.(type) {
+		case nil:
+		case map[string]any:
+			if err := flatten(key+"_", value, values); err != nil {
+				return err
+			}
+		case []any:
+			return fmt.Errorf("%s: lists are not supported", key)
+		default:
+			env := "TODO_" + strings.ToUpper(key)
+			if _, ok := findSetting(env); !ok {
+				return fmt.Errorf("unknown setting %s", key)
+			}
+			values[env] = fmt.Sprint(value)
+		}
+	}
+	return nil
+}
+
+// Проверяет все настройки: значения должны разбираться, порт - лежать в допустимом диапазоне,
+// каталог базы - быть доступным для записи, а каталог фронтенда - существовать
+func (h *Handler) Validate() error {
+	if err := h.snapshot().validate(); err != nil {
+		return fmt.Errorf("Handler.Validate: %w", err)
+	}
+	return nil
+}
+
+func (snap snapshot) validate() error {
+	var errs []error
+	for _, s := range settings {
+		if err := s.check(snap.value(s.env)); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", s.key(), err))
+		}
+	}
+
+	if err := checkWritableDir(filepath.Dir(snap.value(dbPathEnv))); err != nil {
+		errs = append(errs, fmt.Errorf("%s: %v", "dbpath", err))
+	}
+	webDir := snap.value(webDirEnv)
+	if info, err := os.Stat(webDir); err != nil {
+		errs = append(errs, fmt.Errorf("%s: %v", "webdir", err))
+	} else if !info.IsDir() {
+		errs = append(errs, fmt.Errorf("%s: %s is not a directory", "webdir", webDir))
+	}
+	if (len(snap.value(tlsCertEnv)) > 0) != (len(snap.value(tlsKeyEnv)) > 0) {
+		errs = append(errs, errors.New("tls_cert and tls_key must be set together"))
+	}
+	return errors.Join(errs...)
+}
+
+func (s setting) check(value string) error {
+	switch s.kind {
+	case kindInt:
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("%q is not a positive integer", value)
+		}
+	case kindBool:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("%q is not a boolean", value)
+		}
+	case kindDuration:
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("%q is not a positive duration", value)
+		}
+	case kindPort:
+		port, err := strconv.Atoi(value)
+		if err != nil || port < 1 || port > 65535 {
+			return fmt.Errorf("%q is not a port number between 1 and 65535", value)
+		}
+	case kindDateFormat:
+		// Формат должен однозначно задавать день: дата, записанная в нем, читается обратно без потерь
+		date := time.Date(2006, time.November, 23, 0, 0, 0, 0, time.UTC)
+		parsed, err := time.Parse(value, date.Format(value))
+		if err != nil || !parsed.Equal(date) {
+			return fmt.Errorf("%q is not a date format", value)
+		}
+	}
+	return nil
+}
+
+// Проверяет, что в каталоге dir можно создать файл
+func checkWritableDir(dir string) error {
+	f, err := os.CreateTemp(dir, ".todo-check-*")
+	if err != nil {
+		return fmt.Errorf("directory %s is not writable: %v", dir, err)
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
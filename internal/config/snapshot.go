@@ -0,0 +1,159 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Значения всех настроек по именам переменных окружения. Снимок не меняется после создания,
+// при перечитывании настроек Handler заменяет его целиком
+type snapshot map[string]string
+
+// Собирает снимок: флаги важнее переменных окружения, переменные - файла, а файл - значений по умолчанию
+func newSnapshot(file, flags map[string]string) snapshot {
+	snap := make(snapshot, len(settings))
+	for _, s := range settings {
+		value, ok := flags[s.env]
+		if !ok {
+			value, ok = os.LookupEnv(s.env)
+		}
+		if !ok {
+			value, ok = file[s.env]
+		}
+		if !ok {
+			value = s.value
+		}
+		snap[s.env] = value
+	}
+	return snap
+}
+
+func (snap snapshot) value(env string) string {
+	return snap[env]
+}
+
+// Значение настройки как длительность; если оно не разбирается, возвращается значение по умолчанию.
+// Ошибочные значения сообщает Validate при запуске
+func (snap snapshot) duration(env string) time.Duration {
+	d, err := time.ParseDuration(snap.value(env))
+	if err != nil || d <= 0 {
+		s, _ := findSetting(env)
+		d, _ = time.ParseDuration(s.value)
+	}
+	return d
+}
+
+func (snap snapshot) int(env string) int {
+	n, err := strconv.Atoi(snap.value(env))
+	if err != nil || n <= 0 {
+		s, _ := findSetting(env)
+		n, _ = strconv.Atoi(s.value)
+	}
+	return n
+}
+
+func (snap snapshot) bool(env string) bool {
+	b, _ := strconv.ParseBool(snap.value(env))
+	return b
+}
+
+// Перечитывает файл настроек и переменные окружения и атомарно заменяет снимок настроек.
+// Если новые настройки не проходят проверку, остаются прежние. Изменения пишутся в журнал
+func (h *Handler) Reload() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var file map[string]string
+	if len(h.path) > 0 {
+		var err error
+		file, err = readFile(h.path)
+		if err != nil {
+			return fmt.Errorf("Handler.Reload: %v", err)
+		}
+	}
+	next := newSnapshot(file, h.flags)
+	if err := next.validate(); err != nil {
+		return fmt.Errorf("Handler.Reload: %w", err)
+	}
+
+	prev := h.snapshot()
+	h.store(next)
+
+	changes := diff(prev, next)
+	if len(changes) == 0 {
+		log.Println("Config reloaded: nothing changed")
+	}
+	for _, change := range changes {
+		log.Printf("Config reloaded: %s", change)
+	}
+	return nil
+}
+
+// Описывает изменившиеся настройки, не раскрывая секретов
+func diff(prev, next snapshot) []string {
+	var changes []string
+	for _, s := range settings {
+		was, now := prev.value(s.env), next.value(s.env)
+		if was == now {
+			continue
+		}
+		change := fmt.Sprintf("%s: %q -> %q", s.key(), was, now)
+		if s.attr&attrSecret != 0 {
+			change = fmt.Sprintf("%s: changed", s.key())
+		}
+		if s.attr&attrRestart != 0 {
+			change += " (takes effect after restart)"
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// Перечитывает настройки при каждом сигнале из signals и при изменении файла настроек, пока не отменен ctx
+func (h *Handler) Watch(ctx context.Context, signals <-chan os.Signal) {
+	stamp := fileStamp(h.path)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sig := <-signals:
+			log.Printf("Reloading config on %v", sig)
+			stamp = fileStamp(h.path)
+		case <-time.After(h.ConfigPollInterval()):
+			if len(h.path) == 0 {
+				continue
+			}
+			next := fileStamp(h.path)
+			if next == stamp {
+				continue
+			}
+			stamp = next
+			log.Printf("Reloading config: %s changed", h.path)
+		}
+
+		if err := h.Reload(); err != nil {
+			log.Printf("Handler.Watch: %v", err)
+		}
+	}
+}
+
+// Время изменения и размер файла, по которым Watch замечает его изменение
+type stamp struct {
+	modTime time.Time
+	size    int64
+}
+
+func fileStamp(path string) stamp {
+	if len(path) == 0 {
+		return stamp{}
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return stamp{}
+	}
+	return stamp{modTime: info.ModTime(), size: info.Size()}
+}
@@ -1,88 +1,129 @@
 package db
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"strings"
 
 	"go_final_project/internal/app"
 )
 
-func (storage *DBStorage) AddTask(task app.Task) (int64, error) {
-	res, err := storage.db.Exec(
+// Добавляет задачу версии 1
+func (storage *DBStorage) AddTask(ctx context.Context, task app.Task) (int64, error) {
+	res, err := storage.conn.ExecContext(ctx,
 		`
 		INSERT
 			INTO scheduler
-			(date, title, comment, repeat)
-			VALUES (:date, :title, :comment, :repeat)
+			(date, title, comment, repeat, list)
+			VALUES (:date, :title, :comment, :repeat, :list)
 		`,
 		sql.Named("date", task.Date),
 		sql.Named("title", task.Title),
 		sql.Named("comment", task.Comment),
-		sql.Named("repeat", task.Repeat))
+		sql.Named("repeat", task.Repeat),
+		sql.Named("list", task.List))
 
-	if num, _ := res.RowsAffected(); num != 1 {
-		return 0, fmt.Errorf("DBStorage.AddTask: task already exists")
+	if err != nil {
+		return 0, dbError(ctx, "DBStorage.AddTask", err)
 	}
 
-	if err != nil {
-		return 0, fmt.Errorf("DBStorage.AddTask: %v", err)
+	if num, _ := res.RowsAffected(); num != 1 {
+		return 0, fmt.Errorf("DBStorage.AddTask: %w", app.ConflictError("task already exists"))
 	}
 
 	id, err := res.LastInsertId()
 	if err != nil {
-		return id, fmt.Errorf("DBStorage.AddTask: %v", err)
+		return id, dbError(ctx, "DBStorage.AddTask", err)
 	}
 	return id, nil
 }
 
-func (storage *DBStorage) UpdateTask(task app.Task) error {
-	res, err := storage.db.Exec(
+// Обновляет задачу и увеличивает ее версию. Если task.Version не 0, задача обновляется только при совпадении версий
+func (storage *DBStorage) UpdateTask(ctx context.Context, task app.Task) error {
+	res, err := storage.conn.ExecContext(ctx,
 		`
 		UPDATE scheduler
-			SET date = :date, title = :title, comment = :comment, repeat = :repeat
-			WHERE id = :id
+			SET date = :date, title = :title, comment = :comment, repeat = :repeat, version = version + 1
+			WHERE id = :id AND (:version = 0 OR version = :version)
 		`,
 		sql.Named("date", task.Date),
 		sql.Named("title", task.Title),
 		sql.Named("comment", task.Comment),
 		sql.Named("repeat", task.Repeat),
-		sql.Named("id", task.ID))
+		sql.Named("id", task.ID),
+		sql.Named("version", task.Version))
+
+	if err != nil {
+		return dbError(ctx, "DBStorage.UpdateTask", err)
+	}
 
 	r, err := res.RowsAffected()
+	if err != nil {
+		return dbError(ctx, "DBStorage.UpdateTask", err)
+	}
 	if r == 0 {
-		return fmt.Errorf("DBStorage.UpdateTask: coudn't find task.id=%s", task.ID)
+		return fmt.Errorf("DBStorage.UpdateTask: %w", storage.missingTaskError(ctx, task.ID))
 	} else if r > 1 {
-		panic("DBStorage.UpdateTask number of rowsAffected > 1 !!!")
+		return fmt.Errorf("DBStorage.UpdateTask: %d rows affected by update of task.id=%s", r, task.ID)
 	}
+	return nil
+}
+
+// Удаляет задачу. Если version не 0, задача удаляется только при совпадении версий
+func (storage *DBStorage) RemoveTask(ctx context.Context, id string, version int64) error {
+	return storage.withTx(ctx, func(tx *DBStorage) error {
+		return tx.removeTask(ctx, id, version)
+	})
+}
+
+func (storage *DBStorage) removeTask(ctx context.Context, id string, version int64) error {
+	res, err := storage.conn.ExecContext(ctx,
+		`
+		DELETE
+			FROM scheduler
+			WHERE id = :id AND (:version = 0 OR version = :version)
+		`,
+		sql.Named("id", id),
+		sql.Named("version", version))
 
 	if err != nil {
-		return fmt.Errorf("DBStorage.UpdateTask: %v", err)
+		return dbError(ctx, "DBStorage.RemoveTask", err)
 	}
 
-	return nil
-}
+	if r, _ := res.RowsAffected(); r == 0 && version != 0 {
+		return fmt.Errorf("DBStorage.RemoveTask: %w", storage.missingTaskError(ctx, id))
+	}
 
-func (storage *DBStorage) RemoveTask(id string) error {
-	_, err := storage.db.Exec(
+	_, err = storage.conn.ExecContext(ctx,
 		`
 		DELETE
-			FROM scheduler
+			FROM dav_objects
 			WHERE id = :id
 		`,
 		sql.Named("id", id))
-
 	if err != nil {
-		return fmt.Errorf("DBStorage.RemoveTask: %v", err)
+		return dbError(ctx, "DBStorage.RemoveTask", err)
 	}
 
 	return nil
 }
 
-func (storage *DBStorage) GetTaskByID(id string) (app.Task, error) {
-	row := storage.db.QueryRow(
+// Объясняет, почему условное изменение задачи id не затронуло ни одной строки
+func (storage *DBStorage) missingTaskError(ctx context.Context, id string) error {
+	if _, err := storage.GetTaskByID(ctx, id); errors.Is(err, app.ErrNotFound) {
+		return app.NotFoundError("coudn't find task.id=%s", id)
+	} else if err != nil {
+		return err
+	}
+	return app.PreconditionError("task.id=%s has been modified", id)
+}
+
+func (storage *DBStorage) GetTaskByID(ctx context.Context, id string) (app.Task, error) {
+	row := storage.conn.QueryRowContext(ctx,
 		`
-		SELECT id, date, title, comment, repeat
+		SELECT id, date, title, comment, repeat, list, version
 			FROM scheduler
 			WHERE id = :id
 		`,
@@ -90,14 +131,17 @@ func (storage *DBStorage) GetTaskByID(id string) (app.Task, error) {
 
 	var task app.Task
 
-	err := row.Scan(&task.ID, &task.Date, &task.Title, &task.Comment, &task.Repeat)
-	if err != nil {
-		return app.Task{}, fmt.Errorf("DBStorage.GetTask: %v", err)
+	err := row.Scan(&task.ID, &task.Date, &task.Title, &task.Comment, &task.Repeat, &task.List, &task.Version)
+	if err == sql.ErrNoRows {
+		return app.Task{}, fmt.Errorf("DBStorage.GetTask: %w", app.NotFoundError("coudn't find task.id=%s", id))
+	} else if err != nil {
+		return app.Task{}, dbError(ctx, "DBStorage.GetTask", err)
 	}
 	return task, nil
 }
 
-func (storage *DBStorage) GetTaskList(searchString string, maxLen int64) ([]app.Task, error) {
+// Возвращает задачи списка list, app.AllLists - задачи всех списков
+func (storage *DBStorage) GetTaskList(ctx context.Context, list, searchString string, maxLen int64) ([]app.Task, error) {
 	var tasks []app.Task
 	dateString := searchString
 	caseInsensitiveRegExpr := ""
@@ -105,70 +149,69 @@ func (storage *DBStorage) GetTaskList(searchString string, maxLen int64) ([]app.
 		caseInsensitiveRegExpr += "[" + strings.ToUpper(string(c)) + strings.ToLower(string(c)) + "]"
 	}
 
-	rows, err := storage.db.Query(
+	rows, err := storage.conn.QueryContext(ctx,
 		`
-		SELECT id, date, title, comment, repeat
+		SELECT id, date, title, comment, repeat, list, version
 			FROM scheduler
 			WHERE
-				title REGEXP :search OR
+				(:list = :all OR list = :list) AND
+				(title REGEXP :search OR
 				comment REGEXP :search OR
-				date = :date
+				date = :date)
 			ORDER BY date
 			LIMIT :limit
 		`,
+		sql.Named("list", list),
+		sql.Named("all", app.AllLists),
 		sql.Named("search", caseInsensitiveRegExpr),
 		sql.Named("date", dateString),
 		sql.Named("limit", maxLen))
 
-	defer rows.Close()
-
 	if err != nil {
-		return []app.Task{}, fmt.Errorf("DBStorage.AddTask: %v", err)
+		return []app.Task{}, dbError(ctx, "DBStorage.GetTaskList", err)
 	}
+	defer rows.Close()
 
 	for rows.Next() {
 		task := app.Task{}
 
-		err := rows.Scan(&task.ID, &task.Date, &task.Title, &task.Comment, &task.Repeat)
+		err := rows.Scan(&task.ID, &task.Date, &task.Title, &task.Comment, &task.Repeat, &task.List, &task.Version)
 		if err != nil {
-			return []app.Task{}, fmt.Errorf("DBStorage.AddTask: %v", err)
+			return []app.Task{}, dbError(ctx, "DBStorage.AddTask", err)
 		}
 		tasks = append(tasks, task)
 	}
 
 	if err := rows.Err(); err != nil {
-		return []app.Task{}, fmt.Errorf("DBStorage.AddTask: %v", err)
+		return []app.Task{}, dbError(ctx, "DBStorage.AddTask", err)
 	}
 
 	return tasks, nil
 }
 
-func (storage *DBStorage) FindTask(title, date string) (string, error) {
+// Возвращает id задачи списка list с заголовком title и датой date, пустую строку, если такой задачи нет
+func (storage *DBStorage) FindTask(ctx context.Context, list, title, date string) (string, error) {
 	var task app.Task
 
-	db, err := sql.Open("sqlite3_ext", storage.cfg.DBPath())
-	if err != nil {
-		return "", fmt.Errorf("DBStorage.GetTasks: %v", err)
-	}
-	defer db.Close()
-
-	row := db.QueryRow(
+	row := storage.conn.QueryRowContext(ctx,
 		`
 		SELECT id, date, title, comment, repeat
 			FROM scheduler
 			WHERE
+				list = :list AND
 				title = :title AND
 				date = :date
 		`,
+		sql.Named("list", list),
 		sql.Named("title", title),
 		sql.Named("date", date),
 	)
-	err = row.Scan(&task.ID, &task.Date, &task.Title, &task.Comment, &task.Repeat)
+	err := row.Scan(&task.ID, &task.Date, &task.Title, &task.Comment, &task.Repeat)
 
 	if err == sql.ErrNoRows {
 		return "", nil
 	} else if err != nil {
-		return "", fmt.Errorf("DBStorage.AddTask: %v", err)
+		return "", dbError(ctx, "DBStorage.FindTask", err)
 	}
 	return task.ID, nil
 }
@@ -0,0 +1,201 @@
+package db
+
+import (
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+const (
+	backupStepPages = 256                   // страниц, копируемых за один шаг резервного копирования
+	backupStepPause = 10 * time.Millisecond // пауза между шагами, чтобы не задерживать запись в базу
+	gzipExtension   = ".gz"                 // расширение сжатых копий, которые сохраняет сервер с TODO_BACKUP_GZIP
+)
+
+// Сохраняет копию базы в файл path с помощью online backup API SQLite, поэтому копию
+// можно снимать, не останавливая сервер. Копия пишется во временный файл и заменяет path только целиком
+func (storage *DBStorage) Backup(ctx context.Context, path string) error {
+	tmp := path + ".tmp"
+	os.Remove(tmp)
+
+	dest, err := sql.Open("sqlite3", tmp)
+	if err != nil {
+		return fmt.Errorf("DBStorage.Backup: %v", err)
+	}
+	err = copyDatabase(ctx, dest, storage.db)
+	if closeErr := dest.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return dbError(ctx, "DBStorage.Backup", err)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("DBStorage.Backup: %v", err)
+	}
+	return nil
+}
+
+// Заменяет содержимое базы копией из файла path. Копия `.gz` сначала распаковывается во временный файл.
+// Копия предварительно проверяется, а после восстановления схема дополняется до текущей версии
+func (storage *DBStorage) Restore(ctx context.Context, path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("DBStorage.Restore: %v", err)
+	}
+	file := path
+	if strings.HasSuffix(path, gzipExtension) {
+		var err error
+		if file, err = gunzip(path); err != nil {
+			return fmt.Errorf("DBStorage.Restore: %s: %v", path, err)
+		}
+		defer os.Remove(file)
+	}
+	src, err := sql.Open("sqlite3", "file:"+file+"?mode=ro")
+	if err != nil {
+		return fmt.Errorf("DBStorage.Restore: %v", err)
+	}
+	defer src.Close()
+
+	problems, err := integrityCheck(ctx, src)
+	if err != nil {
+		return dbError(ctx, "DBStorage.Restore", err)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("DBStorage.Restore: %s is damaged: %s", path, problems[0])
+	}
+	var tables int
+	err = src.QueryRowContext(ctx, `SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = 'scheduler'`).Scan(&tables)
+	if err != nil {
+		return dbError(ctx, "DBStorage.Restore", err)
+	}
+	if tables == 0 {
+		return fmt.Errorf("DBStorage.Restore: %s is not a scheduler database", path)
+	}
+
+	if err := copyDatabase(ctx, storage.db, src); err != nil {
+		return dbError(ctx, "DBStorage.Restore", err)
+	}
+	if err := storage.migrate(); err != nil {
+		return fmt.Errorf("DBStorage.Restore: %v", err)
+	}
+	return nil
+}
+
+// Распаковывает сжатую копию во временный файл и возвращает его имя
+func gunzip(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return "", err
+	}
+	defer zr.Close()
+
+	tmp, err := os.CreateTemp("", "scheduler-restore-*.db")
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(tmp, zr)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return tmp.Name(), nil
+}
+
+// Пересобирает файл базы, освобождая место после удаленных задач
+func (storage *DBStorage) Vacuum(ctx context.Context) error {
+	if _, err := storage.db.ExecContext(ctx, `VACUUM`); err != nil {
+		return dbError(ctx, "DBStorage.Vacuum", err)
+	}
+	return nil
+}
+
+// Проверяет целостность файла базы. Возвращает найденные повреждения, пустой список означает, что база в порядке
+func (storage *DBStorage) IntegrityCheck(ctx context.Context) ([]string, error) {
+	problems, err := integrityCheck(ctx, storage.db)
+	if err != nil {
+		return nil, dbError(ctx, "DBStorage.IntegrityCheck", err)
+	}
+	return problems, nil
+}
+
+func integrityCheck(ctx context.Context, db *sql.DB) ([]string, error) {
+	rows, err := db.QueryContext(ctx, `PRAGMA integrity_check`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var problems []string
+	for rows.Next() {
+		var result string
+		if err := rows.Scan(&result); err != nil {
+			return nil, err
+		}
+		if result != "ok" {
+			problems = append(problems, result)
+		}
+	}
+	return problems, rows.Err()
+}
+
+// Копирует базу src в dest по частям. Если src изменяется во время копирования, SQLite начинает копирование заново,
+// а занятая база не считается ошибкой: следующий шаг повторяется после паузы
+func copyDatabase(ctx context.Context, dest, src *sql.DB) error {
+	destConn, err := dest.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer destConn.Close()
+	srcConn, err := src.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer srcConn.Close()
+
+	return destConn.Raw(func(destRaw any) error {
+		return srcConn.Raw(func(srcRaw any) error {
+			destSQLite, ok := destRaw.(*sqlite3.SQLiteConn)
+			if !ok {
+				return errors.New("destination is not a sqlite3 connection")
+			}
+			srcSQLite, ok := srcRaw.(*sqlite3.SQLiteConn)
+			if !ok {
+				return errors.New("source is not a sqlite3 connection")
+			}
+
+			backup, err := destSQLite.Backup("main", srcSQLite, "main")
+			if err != nil {
+				return err
+			}
+			for {
+				done, err := backup.Step(backupStepPages)
+				if err != nil || done {
+					return errors.Join(err, backup.Finish())
+				}
+				select {
+				case <-ctx.Done():
+					return errors.Join(ctx.Err(), backup.Finish())
+				case <-time.After(backupStepPause):
+				}
+			}
+		})
+	})
+}
@@ -0,0 +1,89 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"go_final_project/internal/app"
+	"go_final_project/internal/caldav"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+func (storage *DBStorage) GetDAVObjects(ctx context.Context) ([]caldav.Object, error) {
+	rows, err := storage.conn.QueryContext(ctx,
+		`
+		SELECT id, name, uid
+			FROM dav_objects
+		`)
+	if err != nil {
+		return nil, dbError(ctx, "DBStorage.GetDAVObjects", err)
+	}
+	defer rows.Close()
+
+	var objects []caldav.Object
+	for rows.Next() {
+		var object caldav.Object
+		if err := rows.Scan(&object.TaskID, &object.Name, &object.UID); err != nil {
+			return nil, dbError(ctx, "DBStorage.GetDAVObjects", err)
+		}
+		objects = append(objects, object)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, dbError(ctx, "DBStorage.GetDAVObjects", err)
+	}
+	return objects, nil
+}
+
+// Возвращает записи с именем name, задачей taskID или UID uid
+func (storage *DBStorage) FindDAVObjects(ctx context.Context, name, taskID, uid string) ([]caldav.Object, error) {
+	rows, err := storage.conn.QueryContext(ctx,
+		`
+		SELECT id, name, uid
+			FROM dav_objects
+			WHERE name = :name OR id = :id OR uid = :uid
+		`,
+		sql.Named("name", name),
+		sql.Named("id", taskID),
+		sql.Named("uid", uid))
+	if err != nil {
+		return nil, dbError(ctx, "DBStorage.FindDAVObjects", err)
+	}
+	defer rows.Close()
+
+	var objects []caldav.Object
+	for rows.Next() {
+		var object caldav.Object
+		if err := rows.Scan(&object.TaskID, &object.Name, &object.UID); err != nil {
+			return nil, dbError(ctx, "DBStorage.FindDAVObjects", err)
+		}
+		objects = append(objects, object)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, dbError(ctx, "DBStorage.FindDAVObjects", err)
+	}
+	return objects, nil
+}
+
+func (storage *DBStorage) AddDAVObject(ctx context.Context, object caldav.Object) error {
+	_, err := storage.conn.ExecContext(ctx,
+		`
+		INSERT
+			INTO dav_objects
+			(id, name, uid)
+			VALUES (:id, :name, :uid)
+		`,
+		sql.Named("id", object.TaskID),
+		sql.Named("name", object.Name),
+		sql.Named("uid", object.UID))
+
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.Code == sqlite3.ErrConstraint {
+		return fmt.Errorf("DBStorage.AddDAVObject: %w", app.ConflictError("calendar object %s already exists", object.Name))
+	} else if err != nil {
+		return dbError(ctx, "DBStorage.AddDAVObject", err)
+	}
+	return nil
+}
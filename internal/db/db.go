@@ -1,7 +1,9 @@
 package db
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"os"
 
@@ -13,8 +15,29 @@ import (
 var sqlite3_ext_registred bool
 
 type DBStorage struct {
-	db  *sql.DB
-	cfg *config.Handler
+	db   *sql.DB
+	conn queryer // через него выполняются запросы: сама база или открытая транзакция
+	cfg  *config.Handler
+	inTx bool
+}
+
+// Общие методы *sql.DB и *sql.Conn
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// Оборачивает ошибку запроса к базе. Если запрос прерван из-за отмены или истечения контекста,
+// причина остается в цепочке ошибок, чтобы api ответил на него как на превышение времени, а не как на внутреннюю ошибку
+func dbError(ctx context.Context, op string, err error) error {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return fmt.Errorf("%s: %v: %w", op, err, ctxErr)
+	}
+	return fmt.Errorf("%s: %v", op, err)
 }
 
 func New(cfg *config.Handler) *DBStorage {
@@ -70,13 +93,152 @@ func (storage *DBStorage) Exists() bool {
 
 func (storage *DBStorage) Open() error {
 	var err error
-	storage.db, err = sql.Open("sqlite3_ext", storage.cfg.DBPath())
+	// Пока одна транзакция пишет, остальные соединения ждут ее завершения вместо немедленной ошибки SQLITE_BUSY
+	storage.db, err = sql.Open("sqlite3_ext", fmt.Sprintf("%s?_busy_timeout=%d", storage.cfg.DBPath(), storage.cfg.DBBusyTimeout().Milliseconds()))
+	if err != nil {
+		return fmt.Errorf("DBStorage.Open: %v", err)
+	}
+	storage.conn = storage.db
+
+	err = storage.migrate()
 	if err != nil {
 		return fmt.Errorf("DBStorage.Open: %v", err)
 	}
 	return nil
 }
 
+// Дополняет схему базы, созданной предыдущими версиями сервиса
+func (storage *DBStorage) migrate() error {
+	// Задачи без списка относятся к списку по умолчанию
+	err := storage.addColumn("scheduler", "list", `VARCHAR(64) NOT NULL DEFAULT ""`)
+	if err != nil {
+		return err
+	}
+
+	_, err = storage.db.Exec(`CREATE INDEX IF NOT EXISTS list_index ON scheduler (list, date)`)
+	if err != nil {
+		return err
+	}
+
+	_, err = storage.db.Exec(`CREATE TABLE IF NOT EXISTS api_keys (
+		id 		INTEGER 		PRIMARY KEY AUTOINCREMENT,
+		name 	VARCHAR(128) 	NOT NULL 	UNIQUE,
+		hash 	CHAR(64) 		NOT NULL 	UNIQUE,
+		scope 	VARCHAR(16) 	NOT NULL,
+		created VARCHAR(32) 	NOT NULL
+		)`)
+	if err != nil {
+		return err
+	}
+
+	_, err = storage.db.Exec(`CREATE TABLE IF NOT EXISTS users (
+		id 		INTEGER 		PRIMARY KEY AUTOINCREMENT,
+		issuer 	VARCHAR(256) 	NOT NULL,
+		subject VARCHAR(256) 	NOT NULL,
+		email 	VARCHAR(256) 	NOT NULL 	DEFAULT "",
+		UNIQUE (issuer, subject)
+		)`)
+	if err != nil {
+		return err
+	}
+
+	// Версия задачи увеличивается при каждом изменении и отдается клиентам в ETag
+	err = storage.addColumn("scheduler", "version", `INTEGER NOT NULL DEFAULT 1`)
+	if err != nil {
+		return err
+	}
+
+	// Отозванные токены хранятся до истечения их срока действия, expires - время Unix
+	_, err = storage.db.Exec(`CREATE TABLE IF NOT EXISTS revoked_tokens (
+		jti 	VARCHAR(64) 	PRIMARY KEY,
+		expires INTEGER 		NOT NULL
+		)`)
+	if err != nil {
+		return err
+	}
+
+	// Роли пользователей в списках задач, list = "*" - роль во всех списках
+	_, err = storage.db.Exec(`CREATE TABLE IF NOT EXISTS role_bindings (
+		subject VARCHAR(256) 	NOT NULL,
+		list 	VARCHAR(64) 	NOT NULL,
+		role 	VARCHAR(16) 	NOT NULL,
+		PRIMARY KEY (subject, list)
+		)`)
+	if err != nil {
+		return err
+	}
+
+	_, err = storage.db.Exec(`CREATE TABLE IF NOT EXISTS webhooks (
+		id 		INTEGER 		PRIMARY KEY AUTOINCREMENT,
+		url 	TEXT 			NOT NULL,
+		secret 	CHAR(64) 		NOT NULL,
+		events 	VARCHAR(256) 	NOT NULL 	DEFAULT "",
+		created VARCHAR(32) 	NOT NULL
+		)`)
+	if err != nil {
+		return err
+	}
+
+	// Очередь событий для вебхуков и журнал их доставки: строка на каждое событие и получателя
+	_, err = storage.db.Exec(`CREATE TABLE IF NOT EXISTS webhook_outbox (
+		id 				INTEGER 		PRIMARY KEY AUTOINCREMENT,
+		webhook_id 		INTEGER 		NOT NULL,
+		event 			VARCHAR(32) 	NOT NULL,
+		payload 		TEXT 			NOT NULL,
+		status 			VARCHAR(16) 	NOT NULL,
+		attempts 		INTEGER 		NOT NULL 	DEFAULT 0,
+		next_attempt 	INTEGER 		NOT NULL 	DEFAULT 0,
+		last_status 	INTEGER 		NOT NULL 	DEFAULT 0,
+		last_error 		TEXT 			NOT NULL 	DEFAULT "",
+		created 		VARCHAR(32) 	NOT NULL,
+		delivered 		VARCHAR(32) 	NOT NULL 	DEFAULT ""
+		)`)
+	if err != nil {
+		return err
+	}
+
+	_, err = storage.db.Exec(`CREATE INDEX IF NOT EXISTS webhook_outbox_due ON webhook_outbox (status, next_attempt)`)
+	if err != nil {
+		return err
+	}
+
+	_, err = storage.db.Exec(`CREATE TABLE IF NOT EXISTS dav_objects (
+		id 		INTEGER 		PRIMARY KEY,
+		name 	VARCHAR(256) 	NOT NULL 	UNIQUE,
+		uid 	VARCHAR(256) 	NOT NULL 	UNIQUE
+		)`)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Добавляет в таблицу table столбец column, если его еще нет
+func (storage *DBStorage) addColumn(table, column, definition string) error {
+	rows, err := storage.db.Query(`SELECT name FROM pragma_table_info(?)`, table)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	_, err = storage.db.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, table, column, definition))
+	return err
+}
+
 func (storage *DBStorage) Close() error {
 	return storage.db.Close()
 }
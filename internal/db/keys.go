@@ -0,0 +1,107 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"go_final_project/internal/app"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+func (storage *DBStorage) AddAPIKey(ctx context.Context, key app.APIKey, hash string) (int64, error) {
+	res, err := storage.conn.ExecContext(ctx,
+		`
+		INSERT
+			INTO api_keys
+			(name, hash, scope, created)
+			VALUES (:name, :hash, :scope, :created)
+		`,
+		sql.Named("name", key.Name),
+		sql.Named("hash", hash),
+		sql.Named("scope", key.Scope),
+		sql.Named("created", key.Created))
+
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.Code == sqlite3.ErrConstraint {
+		return 0, fmt.Errorf("DBStorage.AddAPIKey: %w", app.ConflictError("key %s already exists", key.Name))
+	} else if err != nil {
+		return 0, dbError(ctx, "DBStorage.AddAPIKey", err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return id, dbError(ctx, "DBStorage.AddAPIKey", err)
+	}
+	return id, nil
+}
+
+func (storage *DBStorage) GetAPIKeyByHash(ctx context.Context, hash string) (app.APIKey, error) {
+	row := storage.conn.QueryRowContext(ctx,
+		`
+		SELECT id, name, scope, created
+			FROM api_keys
+			WHERE hash = :hash
+		`,
+		sql.Named("hash", hash))
+
+	var key app.APIKey
+
+	err := row.Scan(&key.ID, &key.Name, &key.Scope, &key.Created)
+	if err != nil {
+		return app.APIKey{}, dbError(ctx, "DBStorage.GetAPIKeyByHash", err)
+	}
+	return key, nil
+}
+
+func (storage *DBStorage) GetAPIKeyList(ctx context.Context) ([]app.APIKey, error) {
+	var keys []app.APIKey
+
+	rows, err := storage.conn.QueryContext(ctx,
+		`
+		SELECT id, name, scope, created
+			FROM api_keys
+			ORDER BY id
+		`)
+	if err != nil {
+		return nil, dbError(ctx, "DBStorage.GetAPIKeyList", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		key := app.APIKey{}
+
+		err := rows.Scan(&key.ID, &key.Name, &key.Scope, &key.Created)
+		if err != nil {
+			return nil, dbError(ctx, "DBStorage.GetAPIKeyList", err)
+		}
+		keys = append(keys, key)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, dbError(ctx, "DBStorage.GetAPIKeyList", err)
+	}
+
+	return keys, nil
+}
+
+func (storage *DBStorage) RemoveAPIKey(ctx context.Context, id string) error {
+	res, err := storage.conn.ExecContext(ctx,
+		`
+		DELETE
+			FROM api_keys
+			WHERE id = :id
+		`,
+		sql.Named("id", id))
+
+	if err != nil {
+		return dbError(ctx, "DBStorage.RemoveAPIKey", err)
+	}
+
+	if num, _ := res.RowsAffected(); num == 0 {
+		return fmt.Errorf("DBStorage.RemoveAPIKey: %w", app.NotFoundError("coudn't find key.id=%s", id))
+	}
+	return nil
+}
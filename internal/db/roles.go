@@ -0,0 +1,99 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"go_final_project/internal/app"
+)
+
+// Возвращает роль пользователя в списке list: назначенную в самом списке, а если ее нет - во всех списках.
+// sql.ErrNoRows, если роль не назначена
+func (storage *DBStorage) GetRole(ctx context.Context, subject, list string) (string, error) {
+	row := storage.conn.QueryRowContext(ctx,
+		`
+		SELECT role
+			FROM role_bindings
+			WHERE subject = :subject AND list IN (:list, :all)
+			ORDER BY list = :all
+			LIMIT 1
+		`,
+		sql.Named("subject", subject),
+		sql.Named("list", list),
+		sql.Named("all", app.AllLists))
+
+	var role string
+
+	err := row.Scan(&role)
+	if err != nil {
+		return "", fmt.Errorf("DBStorage.GetRole: %w", err)
+	}
+	return role, nil
+}
+
+func (storage *DBStorage) SetRole(ctx context.Context, binding app.RoleBinding) error {
+	_, err := storage.conn.ExecContext(ctx,
+		`
+		INSERT
+			INTO role_bindings
+			(subject, list, role)
+			VALUES (:subject, :list, :role)
+			ON CONFLICT (subject, list) DO UPDATE SET role = :role
+		`,
+		sql.Named("subject", binding.Subject),
+		sql.Named("list", binding.List),
+		sql.Named("role", binding.Role))
+
+	if err != nil {
+		return dbError(ctx, "DBStorage.SetRole", err)
+	}
+	return nil
+}
+
+func (storage *DBStorage) RemoveRole(ctx context.Context, subject, list string) error {
+	_, err := storage.conn.ExecContext(ctx,
+		`
+		DELETE
+			FROM role_bindings
+			WHERE subject = :subject AND list = :list
+		`,
+		sql.Named("subject", subject),
+		sql.Named("list", list))
+
+	if err != nil {
+		return dbError(ctx, "DBStorage.RemoveRole", err)
+	}
+	return nil
+}
+
+func (storage *DBStorage) GetRoleList(ctx context.Context) ([]app.RoleBinding, error) {
+	var bindings []app.RoleBinding
+
+	rows, err := storage.conn.QueryContext(ctx,
+		`
+		SELECT subject, list, role
+			FROM role_bindings
+			ORDER BY subject, list
+		`)
+	if err != nil {
+		return nil, dbError(ctx, "DBStorage.GetRoleList", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		binding := app.RoleBinding{}
+
+		err := rows.Scan(&binding.Subject, &binding.List, &binding.Role)
+		if err != nil {
+			return nil, dbError(ctx, "DBStorage.GetRoleList", err)
+		}
+		bindings = append(bindings, binding)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, dbError(ctx, "DBStorage.GetRoleList", err)
+	}
+
+	return bindings, nil
+}
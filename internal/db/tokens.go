@@ -0,0 +1,57 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Отзывает токен jti до времени expires. Возвращает false, если токен уже был отозван.
+// Заодно удаляет записи о токенах, которые истекли сами
+func (storage *DBStorage) RevokeToken(ctx context.Context, jti string, expires time.Time) (bool, error) {
+	_, err := storage.conn.ExecContext(ctx,
+		`
+		DELETE
+			FROM revoked_tokens
+			WHERE expires < :now
+		`,
+		sql.Named("now", time.Now().Unix()))
+	if err != nil {
+		return false, dbError(ctx, "DBStorage.RevokeToken", err)
+	}
+
+	res, err := storage.conn.ExecContext(ctx,
+		`
+		INSERT OR IGNORE
+			INTO revoked_tokens
+			(jti, expires)
+			VALUES (:jti, :expires)
+		`,
+		sql.Named("jti", jti),
+		sql.Named("expires", expires.Unix()))
+	if err != nil {
+		return false, dbError(ctx, "DBStorage.RevokeToken", err)
+	}
+
+	num, err := res.RowsAffected()
+	if err != nil {
+		return false, dbError(ctx, "DBStorage.RevokeToken", err)
+	}
+	return num == 1, nil
+}
+
+func (storage *DBStorage) TokenRevoked(ctx context.Context, jti string) (bool, error) {
+	row := storage.conn.QueryRowContext(ctx,
+		`
+		SELECT COUNT(*)
+			FROM revoked_tokens
+			WHERE jti = :jti
+		`,
+		sql.Named("jti", jti))
+
+	var count int
+	if err := row.Scan(&count); err != nil {
+		return false, dbError(ctx, "DBStorage.TokenRevoked", err)
+	}
+	return count > 0, nil
+}
@@ -0,0 +1,54 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"go_final_project/internal/app"
+)
+
+// Выполняет fn в одной транзакции и фиксирует ее, если fn не вернула ошибку, иначе отменяет.
+// Транзакция открывается через `BEGIN IMMEDIATE`, поэтому запись блокируется сразу, а не при первом
+// изменении, и параллельные транзакции выполняются по очереди. Вложенный вызов выполняет fn в уже открытой транзакции
+func (storage *DBStorage) WithTx(ctx context.Context, fn func(app.Storage) error) error {
+	return storage.withTx(ctx, func(tx *DBStorage) error {
+		return fn(tx)
+	})
+}
+
+func (storage *DBStorage) withTx(ctx context.Context, fn func(*DBStorage) error) (err error) {
+	if storage.inTx {
+		return fn(storage)
+	}
+
+	conn, err := storage.db.Conn(ctx)
+	if err != nil {
+		return dbError(ctx, "DBStorage.WithTx", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `BEGIN IMMEDIATE`); err != nil {
+		return dbError(ctx, "DBStorage.WithTx", err)
+	}
+
+	committed := false
+	defer func() {
+		if !committed {
+			// Отмена не зависит от ctx: соединение возвращается в пул и не должно остаться с открытой транзакцией
+			if _, rollbackErr := conn.ExecContext(context.Background(), `ROLLBACK`); rollbackErr != nil && err == nil {
+				err = fmt.Errorf("DBStorage.WithTx: %v", rollbackErr)
+			}
+		}
+	}()
+
+	tx := &DBStorage{conn: conn, cfg: storage.cfg, inTx: true}
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	if _, err := conn.ExecContext(ctx, `COMMIT`); err != nil {
+		return dbError(ctx, "DBStorage.WithTx", err)
+	}
+	committed = true
+	return nil
+}
@@ -0,0 +1,44 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+
+	"go_final_project/internal/app"
+)
+
+// Возвращает локального пользователя для учетной записи провайдера, при первом входе создает его
+func (storage *DBStorage) FindOrCreateUser(ctx context.Context, issuer, subject, email string) (app.User, error) {
+	_, err := storage.conn.ExecContext(ctx,
+		`
+		INSERT
+			INTO users
+			(issuer, subject, email)
+			VALUES (:issuer, :subject, :email)
+			ON CONFLICT (issuer, subject) DO UPDATE SET email = :email
+		`,
+		sql.Named("issuer", issuer),
+		sql.Named("subject", subject),
+		sql.Named("email", email))
+
+	if err != nil {
+		return app.User{}, dbError(ctx, "DBStorage.FindOrCreateUser", err)
+	}
+
+	row := storage.conn.QueryRowContext(ctx,
+		`
+		SELECT id, issuer, subject, email
+			FROM users
+			WHERE issuer = :issuer AND subject = :subject
+		`,
+		sql.Named("issuer", issuer),
+		sql.Named("subject", subject))
+
+	var user app.User
+
+	err = row.Scan(&user.ID, &user.Issuer, &user.Subject, &user.Email)
+	if err != nil {
+		return app.User{}, dbError(ctx, "DBStorage.FindOrCreateUser", err)
+	}
+	return user, nil
+}
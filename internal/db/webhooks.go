@@ -0,0 +1,217 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"go_final_project/internal/app"
+	"go_final_project/internal/webhook"
+)
+
+// Ставит событие в очередь каждому получателю, подписанному на его тип. Получатели без списка событий получают все
+func (storage *DBStorage) AddEvent(ctx context.Context, event app.Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("DBStorage.AddEvent: %v", err)
+	}
+	_, err = storage.conn.ExecContext(ctx,
+		`
+		INSERT
+			INTO webhook_outbox
+			(webhook_id, event, payload, status, next_attempt, created)
+			SELECT id, :event, :payload, :status, :now, :created
+				FROM webhooks
+				WHERE events = '' OR instr(',' || events || ',', ',' || :event || ',') > 0
+		`,
+		sql.Named("event", event.Type),
+		sql.Named("payload", string(payload)),
+		sql.Named("status", webhook.StatusPending),
+		sql.Named("now", event.Time.UnixMilli()),
+		sql.Named("created", event.Time.UTC().Format(time.RFC3339)))
+	if err != nil {
+		return dbError(ctx, "DBStorage.AddEvent", err)
+	}
+	return nil
+}
+
+func (storage *DBStorage) AddWebhook(ctx context.Context, hook webhook.Webhook) (int64, error) {
+	res, err := storage.conn.ExecContext(ctx,
+		`
+		INSERT
+			INTO webhooks
+			(url, secret, events, created)
+			VALUES (:url, :secret, :events, :created)
+		`,
+		sql.Named("url", hook.URL),
+		sql.Named("secret", hook.Secret),
+		sql.Named("events", strings.Join(hook.Events, ",")),
+		sql.Named("created", hook.Created))
+	if err != nil {
+		return 0, dbError(ctx, "DBStorage.AddWebhook", err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return id, dbError(ctx, "DBStorage.AddWebhook", err)
+	}
+	return id, nil
+}
+
+func (storage *DBStorage) GetWebhookList(ctx context.Context) ([]webhook.Webhook, error) {
+	rows, err := storage.conn.QueryContext(ctx,
+		`
+		SELECT id, url, events, created
+			FROM webhooks
+			ORDER BY id
+		`)
+	if err != nil {
+		return nil, dbError(ctx, "DBStorage.GetWebhookList", err)
+	}
+	defer rows.Close()
+
+	var hooks []webhook.Webhook
+	for rows.Next() {
+		var hook webhook.Webhook
+		var events string
+		if err := rows.Scan(&hook.ID, &hook.URL, &events, &hook.Created); err != nil {
+			return nil, dbError(ctx, "DBStorage.GetWebhookList", err)
+		}
+		hook.Events = []string{}
+		if len(events) > 0 {
+			hook.Events = strings.Split(events, ",")
+		}
+		hooks = append(hooks, hook)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, dbError(ctx, "DBStorage.GetWebhookList", err)
+	}
+	return hooks, nil
+}
+
+func (storage *DBStorage) RemoveWebhook(ctx context.Context, id string) error {
+	return storage.withTx(ctx, func(tx *DBStorage) error {
+		res, err := tx.conn.ExecContext(ctx,
+			`
+			DELETE
+				FROM webhooks
+				WHERE id = :id
+			`,
+			sql.Named("id", id))
+		if err != nil {
+			return dbError(ctx, "DBStorage.RemoveWebhook", err)
+		}
+		if r, _ := res.RowsAffected(); r == 0 {
+			return fmt.Errorf("DBStorage.RemoveWebhook: %w", app.NotFoundError("coudn't find webhook.id=%s", id))
+		}
+
+		_, err = tx.conn.ExecContext(ctx,
+			`
+			DELETE
+				FROM webhook_outbox
+				WHERE webhook_id = :id
+			`,
+			sql.Named("id", id))
+		if err != nil {
+			return dbError(ctx, "DBStorage.RemoveWebhook", err)
+		}
+		return nil
+	})
+}
+
+func (storage *DBStorage) GetDueDeliveries(ctx context.Context, now time.Time, limit int) ([]webhook.Delivery, error) {
+	return storage.queryDeliveries(ctx, "DBStorage.GetDueDeliveries",
+		`
+		SELECT o.id, o.webhook_id, o.event, o.payload, o.status, o.attempts, o.next_attempt,
+				o.last_status, o.last_error, o.created, o.delivered, w.url, w.secret
+			FROM webhook_outbox o
+			JOIN webhooks w ON w.id = o.webhook_id
+			WHERE o.status = :status AND o.next_attempt <= :now
+			ORDER BY o.id
+			LIMIT :limit
+		`,
+		sql.Named("status", webhook.StatusPending),
+		sql.Named("now", now.UnixMilli()),
+		sql.Named("limit", limit))
+}
+
+func (storage *DBStorage) GetDeliveryList(ctx context.Context, webhookID, status string, limit int) ([]webhook.Delivery, error) {
+	return storage.queryDeliveries(ctx, "DBStorage.GetDeliveryList",
+		`
+		SELECT o.id, o.webhook_id, o.event, o.payload, o.status, o.attempts, o.next_attempt,
+				o.last_status, o.last_error, o.created, o.delivered, '', ''
+			FROM webhook_outbox o
+			WHERE
+				(:webhook = '' OR o.webhook_id = :webhook) AND
+				(:status = '' OR o.status = :status)
+			ORDER BY o.id DESC
+			LIMIT :limit
+		`,
+		sql.Named("webhook", webhookID),
+		sql.Named("status", status),
+		sql.Named("limit", limit))
+}
+
+func (storage *DBStorage) queryDeliveries(ctx context.Context, name, query string, args ...any) ([]webhook.Delivery, error) {
+	rows, err := storage.conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, dbError(ctx, name, err)
+	}
+	defer rows.Close()
+
+	var deliveries []webhook.Delivery
+	for rows.Next() {
+		var d webhook.Delivery
+		var next int64
+		err := rows.Scan(&d.ID, &d.WebhookID, &d.Event, &d.Payload, &d.Status, &d.Attempts, &next,
+			&d.LastStatus, &d.LastError, &d.Created, &d.Delivered, &d.URL, &d.Secret)
+		if err != nil {
+			return nil, dbError(ctx, name, err)
+		}
+		d.NextAttempt = time.UnixMilli(next)
+		deliveries = append(deliveries, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, dbError(ctx, name, err)
+	}
+	return deliveries, nil
+}
+
+func (storage *DBStorage) UpdateDelivery(ctx context.Context, d webhook.Delivery) error {
+	_, err := storage.conn.ExecContext(ctx,
+		`
+		UPDATE webhook_outbox
+			SET status = :status, attempts = :attempts, next_attempt = :next,
+				last_status = :last_status, last_error = :last_error, delivered = :delivered
+			WHERE id = :id
+		`,
+		sql.Named("status", d.Status),
+		sql.Named("attempts", d.Attempts),
+		sql.Named("next", d.NextAttempt.UnixMilli()),
+		sql.Named("last_status", d.LastStatus),
+		sql.Named("last_error", d.LastError),
+		sql.Named("delivered", d.Delivered),
+		sql.Named("id", d.ID))
+	if err != nil {
+		return dbError(ctx, "DBStorage.UpdateDelivery", err)
+	}
+	return nil
+}
+
+func (storage *DBStorage) PruneDeliveries(ctx context.Context, before time.Time) error {
+	_, err := storage.conn.ExecContext(ctx,
+		`
+		DELETE
+			FROM webhook_outbox
+			WHERE status != :pending AND created < :before
+		`,
+		sql.Named("pending", webhook.StatusPending),
+		sql.Named("before", before.UTC().Format(time.RFC3339)))
+	if err != nil {
+		return dbError(ctx, "DBStorage.PruneDeliveries", err)
+	}
+	return nil
+}
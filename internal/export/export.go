@@ -0,0 +1,117 @@
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"go_final_project/internal/app"
+	"go_final_project/internal/ical"
+)
+
+// Форматы выгрузки задач
+const (
+	FormatJSON = "json"
+	FormatCSV  = "csv"
+	FormatICS  = "ics"
+)
+
+// Заголовок CSV, колонки совпадают с полями задачи в api
+var csvHeader = []string{"id", "date", "title", "comment", "repeat", "list"}
+
+var contentTypes = map[string]string{
+	FormatJSON: "application/json; charset=UTF-8",
+	FormatCSV:  "text/csv; charset=UTF-8",
+	FormatICS:  "text/calendar; charset=UTF-8",
+}
+
+// Возвращает Content-Type выгрузки в формате format, false - если формат не поддерживается
+func ContentType(format string) (string, bool) {
+	contentType, ok := contentTypes[format]
+	return contentType, ok
+}
+
+// Записывает задачи в w в формате format. JSON совпадает с ответом `/api/tasks`,
+// а ICS содержит события на весь день, см. WriteICS
+func Write(w io.Writer, format string, tasks []app.Task) error {
+	var err error
+	switch format {
+	case FormatJSON:
+		err = writeJSON(w, tasks)
+	case FormatCSV:
+		err = writeCSV(w, tasks)
+	case FormatICS:
+		err = WriteICS(w, ical.KindEvent, tasks)
+	default:
+		return fmt.Errorf("export.Write: %w", app.ValidationError("format", "unsupported format %q, expected json, csv or ics", format))
+	}
+	if err != nil {
+		return fmt.Errorf("export.Write: %v", err)
+	}
+	return nil
+}
+
+// Записывает задачи как календарь с записями kind. Повторяющиеся задачи получают RRULE,
+// комментарий записывается в описание
+func WriteICS(w io.Writer, kind ical.Kind, tasks []app.Task) error {
+	cal := ical.NewWriter(w, kind, "Планировщик задач")
+	for _, task := range tasks {
+		if err := cal.Write(TaskItem(task)); err != nil {
+			return fmt.Errorf("task %s: %v", task.ID, err)
+		}
+	}
+	return cal.Close()
+}
+
+// Запись календаря для задачи. Правило повторения, которое нельзя перевести в RRULE, остается только в X-TODO-REPEAT
+func TaskItem(task app.Task) ical.Item {
+	item := ical.Item{
+		UID:         "task-" + task.ID + "@go_final_project",
+		Summary:     task.Title,
+		Description: task.Comment,
+		Date:        task.Date,
+		Repeat:      task.Repeat,
+		Stamp:       time.Now(),
+	}
+	if len(task.Repeat) > 0 {
+		item.RRule, _ = ical.RRule(task.Repeat)
+	}
+	return item
+}
+
+// Пишет задачи по одной, не собирая весь ответ в памяти
+func writeJSON(w io.Writer, tasks []app.Task) error {
+	if _, err := io.WriteString(w, `{"tasks":[`); err != nil {
+		return err
+	}
+	for i, task := range tasks {
+		data, err := json.Marshal(task)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			data = append([]byte{','}, data...)
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, "]}\n")
+	return err
+}
+
+func writeCSV(w io.Writer, tasks []app.Task) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, task := range tasks {
+		if err := cw.Write([]string{task.ID, task.Date, task.Title, task.Comment, task.Repeat, task.List}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
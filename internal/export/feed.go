@@ -0,0 +1,39 @@
+package export
+
+import (
+	"io"
+	"time"
+
+	"go_final_project/internal/app"
+	"go_final_project/internal/ical"
+)
+
+// Записывает календарь для подписки: каждая дата задачи на days дней вперед - отдельное событие, просроченная задача
+// показывается на свою дату.
+// Даты повторяющихся задач вычисляются тем же правилом, что и при их выполнении, а не клиентом по RRULE,
+// поэтому календарь совпадает с тем, что покажет сервис. DTSTAMP меняется раз в сутки, чтобы один и тот же
+// набор задач давал один и тот же календарь
+func WriteFeed(w io.Writer, tasks []app.Task, now time.Time, days int) error {
+	cal := ical.NewWriter(w, ical.KindEvent, "Планировщик задач")
+	until := now.AddDate(0, 0, days)
+	stamp := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	for _, task := range tasks {
+		dates, err := app.Occurrences(task, now, until, days+2) // просроченная дата и не больше одной даты в день
+		if err != nil {
+			// Задача с ошибочным правилом показывается только на свою дату
+			dates = []string{task.Date}
+		}
+		for _, date := range dates {
+			item := TaskItem(task)
+			item.UID = "task-" + task.ID + "-" + date + "@go_final_project"
+			item.Date = date
+			item.RRule, item.Repeat = "", ""
+			item.Stamp = stamp
+			if err := cal.Write(item); err != nil {
+				return err
+			}
+		}
+	}
+	return cal.Close()
+}
@@ -0,0 +1,66 @@
+package httputil
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"go_final_project/internal/app"
+)
+
+// ETag задачи, построенный по её версии
+func ETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// Возвращает версию задачи, с которой операция сравнит задачу по заголовку `If-Match`: 0, если заголовка нет
+// или он равен `*`, текущую версию current, если ее ETag есть среди перечисленных, и -1, если его там нет
+// (такой запрос не совпадет ни с одной версией). current читается, только если заголовок ограничивает версию.
+// If-Match сравнивает ETag строго (RFC 9110), поэтому слабые `W/"..."` не совпадают никогда
+func IfMatchVersion(req *http.Request, current func() (int64, error)) (int64, error) {
+	header := strings.TrimSpace(req.Header.Get("If-Match"))
+	if len(header) == 0 || header == "*" {
+		return 0, nil
+	}
+
+	var versions []int64
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if strings.HasPrefix(tag, "W/") {
+			continue
+		}
+		version, err := strconv.ParseInt(strings.Trim(tag, `"`), 10, 64)
+		if err == nil && version > 0 {
+			versions = append(versions, version)
+		}
+	}
+	if len(versions) == 0 {
+		return -1, nil
+	}
+
+	version, err := current()
+	if err != nil {
+		return 0, err
+	}
+	if !slices.Contains(versions, version) {
+		return -1, nil
+	}
+	return version, nil
+}
+
+var errorStatuses = map[app.Code]int{
+	app.CodeValidation:   http.StatusBadRequest,
+	app.CodeNotFound:     http.StatusNotFound,
+	app.CodeConflict:     http.StatusConflict,
+	app.CodeUnauthorized: http.StatusUnauthorized,
+	app.CodePrecondition: http.StatusPreconditionFailed,
+	app.CodeTimeout:      http.StatusServiceUnavailable,
+}
+
+// HTTP-статус ответа на ошибку app с кодом code. Для внутренних и неизвестных ошибок возвращает false:
+// их подробности остаются в журнале сервера, а клиент получает 500
+func ErrorStatus(code app.Code) (int, bool) {
+	status, ok := errorStatuses[code]
+	return status, ok
+}
@@ -0,0 +1,137 @@
+package ical
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Тип записей календаря
+type Kind string
+
+const (
+	KindEvent Kind = "VEVENT" // событие на весь день, видно в любом календаре
+	KindTodo  Kind = "VTODO"  // задача со сроком, ее показывают приложения со списками дел
+)
+
+const (
+	dateFormat  = "20060102"
+	stampFormat = "20060102T150405Z"
+	lineLength  = 75 // максимальная длина строки в байтах, длинные строки переносятся
+)
+
+// Запись календаря. Date - дата в формате 20060102, RRule - правило повторения в формате RFC 5545,
+// Repeat - исходное правило повторения задачи, которое сохраняется в X-TODO-REPEAT для обратного импорта.
+// Kind, Status и Line заполняются только при разборе календаря
+type Item struct {
+	UID         string
+	Summary     string
+	Description string
+	Date        string
+	RRule       string
+	Repeat      string
+	Stamp       time.Time
+
+	Kind   Kind
+	Status string // например COMPLETED у выполненной задачи
+	Line   int
+}
+
+// Записывает календарь iCalendar (RFC 5545): заголовок при первой записи, окончание - при Close
+type Writer struct {
+	w       *bufio.Writer
+	kind    Kind
+	name    string
+	started bool
+	err     error
+}
+
+// Создает календарь с записями kind. name - название календаря, которое показывают приложения
+func NewWriter(w io.Writer, kind Kind, name string) *Writer {
+	return &Writer{w: bufio.NewWriter(w), kind: kind, name: name}
+}
+
+func (w *Writer) Write(item Item) error {
+	w.start()
+	date, err := time.Parse(dateFormat, item.Date)
+	if err != nil {
+		return fmt.Errorf("Writer.Write: invalid date %q", item.Date)
+	}
+
+	w.line("BEGIN:" + string(w.kind))
+	w.line("UID:" + escape(item.UID))
+	w.line("DTSTAMP:" + item.Stamp.UTC().Format(stampFormat))
+	w.line("DTSTART;VALUE=DATE:" + item.Date)
+	if w.kind == KindTodo {
+		w.line("DUE;VALUE=DATE:" + date.AddDate(0, 0, 1).Format(dateFormat))
+	} else {
+		w.line("DTEND;VALUE=DATE:" + date.AddDate(0, 0, 1).Format(dateFormat))
+		w.line("TRANSP:TRANSPARENT")
+	}
+	w.line("SUMMARY:" + escape(item.Summary))
+	if len(item.Description) > 0 {
+		w.line("DESCRIPTION:" + escape(item.Description))
+	}
+	if len(item.RRule) > 0 {
+		w.line("RRULE:" + item.RRule)
+	}
+	if len(item.Repeat) > 0 {
+		w.line("X-TODO-REPEAT:" + escape(item.Repeat))
+	}
+	w.line("END:" + string(w.kind))
+	return w.err
+}
+
+// Завершает календарь. Календарь без записей тоже записывается целиком
+func (w *Writer) Close() error {
+	w.start()
+	w.line("END:VCALENDAR")
+	if w.err != nil {
+		return w.err
+	}
+	return w.w.Flush()
+}
+
+func (w *Writer) start() {
+	if w.started {
+		return
+	}
+	w.started = true
+	w.line("BEGIN:VCALENDAR")
+	w.line("VERSION:2.0")
+	w.line("PRODID:-//go_final_project//TODO app//RU")
+	w.line("CALSCALE:GREGORIAN")
+	if len(w.name) > 0 {
+		w.line("X-WR-CALNAME:" + escape(w.name))
+	}
+}
+
+// Записывает строку, перенося ее по lineLength байт без разрыва символов UTF-8
+func (w *Writer) line(s string) {
+	if w.err != nil {
+		return
+	}
+	limit := lineLength
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		_, w.err = w.w.WriteString(s[:cut] + "\r\n ")
+		s = s[cut:]
+		limit = lineLength - 1 // продолжение начинается с пробела
+	}
+	if w.err == nil {
+		_, w.err = w.w.WriteString(s + "\r\n")
+	}
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+// Экранирует текстовое значение свойства
+func escape(s string) string {
+	return escaper.Replace(s)
+}
@@ -0,0 +1,230 @@
+package ical
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var unescaper = strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, "\n", `\N`, "\n")
+
+// Разбирает календарь iCalendar и возвращает его события и задачи в порядке записи. Line записи - строка, на которой она начинается.
+// Из свойств разбираются только те, что пишет Writer; дата берется из DTSTART, а без него - из DUE
+func Parse(data []byte) ([]Item, error) {
+	var items []Item
+	var current *Item
+	var stack []string // вложенные компоненты, например VCALENDAR, VEVENT, VALARM
+
+	lines := unfold(data)
+	for _, line := range lines {
+		name, value, ok := splitLine(line.text)
+		if !ok {
+			return nil, fmt.Errorf("Parse: line %d: invalid content line", line.number)
+		}
+
+		switch name {
+		case "BEGIN":
+			stack = append(stack, strings.ToUpper(value))
+			if kind := Kind(strings.ToUpper(value)); kind == KindEvent || kind == KindTodo {
+				current = &Item{Kind: kind, Line: line.number}
+			}
+			continue
+		case "END":
+			if len(stack) == 0 || stack[len(stack)-1] != strings.ToUpper(value) {
+				return nil, fmt.Errorf("Parse: line %d: unexpected END:%s", line.number, value)
+			}
+			stack = stack[:len(stack)-1]
+			if current != nil && Kind(strings.ToUpper(value)) == current.Kind {
+				items = append(items, *current)
+				current = nil
+			}
+			continue
+		}
+		// Свойства вложенных компонентов, например напоминаний VALARM, не относятся к самой записи
+		if current == nil || Kind(stack[len(stack)-1]) != current.Kind {
+			continue
+		}
+
+		switch name {
+		case "UID":
+			current.UID = unescaper.Replace(value)
+		case "SUMMARY":
+			current.Summary = unescaper.Replace(value)
+		case "DESCRIPTION":
+			current.Description = unescaper.Replace(value)
+		case "DTSTART":
+			current.Date = parseDate(value)
+		case "DUE":
+			if len(current.Date) == 0 {
+				current.Date = parseDate(value)
+			}
+		case "RRULE":
+			current.RRule = value
+		case "X-TODO-REPEAT":
+			current.Repeat = unescaper.Replace(value)
+		case "STATUS":
+			current.Status = strings.ToUpper(value)
+		}
+	}
+	if len(stack) > 0 {
+		return nil, fmt.Errorf("Parse: %s is not closed", stack[len(stack)-1])
+	}
+	return items, nil
+}
+
+type contentLine struct {
+	number int
+	text   string
+}
+
+// Соединяет перенесенные строки: строка, начинающаяся с пробела или табуляции, продолжает предыдущую
+func unfold(data []byte) []contentLine {
+	var lines []contentLine
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), len(data)+1)
+	for number := 1; scanner.Scan(); number++ {
+		text := strings.TrimSuffix(scanner.Text(), "\r")
+		if len(text) > 0 && (text[0] == ' ' || text[0] == '\t') && len(lines) > 0 {
+			lines[len(lines)-1].text += text[1:]
+			continue
+		}
+		if len(strings.TrimSpace(text)) == 0 {
+			continue
+		}
+		lines = append(lines, contentLine{number: number, text: text})
+	}
+	return lines
+}
+
+// Разбирает строку вида `NAME;PARAM=VALUE:значение`. Параметры не нужны ни одному из разбираемых свойств
+func splitLine(line string) (name, value string, ok bool) {
+	head, value, ok := strings.Cut(line, ":")
+	if !ok {
+		return "", "", false
+	}
+	name, _, _ = strings.Cut(head, ";")
+	return strings.ToUpper(name), value, true
+}
+
+// Дата из значения DATE (20060102) или DATE-TIME (20060102T150405, в UTC с суффиксом Z).
+// Время в UTC переводится в местное, у остального берется дата как записана
+func parseDate(value string) string {
+	if strings.HasSuffix(value, "Z") {
+		if t, err := time.Parse(stampFormat, value); err == nil {
+			return t.Local().Format(dateFormat)
+		}
+	}
+	if len(value) >= len(dateFormat) {
+		return value[:len(dateFormat)]
+	}
+	return value
+}
+
+// Переводит RRULE в правило повторения задачи, обратное RRule. date - дата первой записи в формате 20060102,
+// из нее берется день для ежемесячных и ежегодных правил без BYMONTHDAY. Правила, которые нельзя записать
+// в формате задачи (с COUNT, UNTIL, BYSETPOS, интервалом месяцев и т.п.), возвращают ошибку
+func Repeat(rrule, date string) (string, error) {
+	parts := make(map[string]string)
+	for _, part := range strings.Split(strings.TrimPrefix(rrule, "RRULE:"), ";") {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return "", fmt.Errorf("Repeat: invalid RRULE %q", rrule)
+		}
+		parts[strings.ToUpper(key)] = strings.ToUpper(value)
+	}
+	unsupported := func() (string, error) {
+		return "", fmt.Errorf("Repeat: RRULE %q can't be converted to a repeat rule", rrule)
+	}
+
+	interval := 1
+	if value, ok := parts["INTERVAL"]; ok {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return "", fmt.Errorf("Repeat: invalid INTERVAL in RRULE %q", rrule)
+		}
+		interval = n
+	}
+	freq := parts["FREQ"]
+	for key := range parts {
+		switch key {
+		case "FREQ", "INTERVAL", "WKST":
+		case "BYDAY":
+			if freq != "WEEKLY" {
+				return unsupported()
+			}
+		case "BYMONTHDAY":
+			if freq != "MONTHLY" && freq != "YEARLY" {
+				return unsupported()
+			}
+		case "BYMONTH":
+			if freq != "YEARLY" {
+				return unsupported()
+			}
+		default:
+			return unsupported()
+		}
+	}
+
+	var day int
+	if t, err := time.Parse(dateFormat, date); err == nil {
+		day = t.Day()
+	}
+	monthDays := func() (string, bool) {
+		if value, ok := parts["BYMONTHDAY"]; ok {
+			return value, true
+		}
+		return strconv.Itoa(day), day > 0
+	}
+
+	var repeat string
+	switch {
+	case freq == "DAILY" && interval <= 400:
+		repeat = "d " + strconv.Itoa(interval)
+	case freq == "WEEKLY" && len(parts["BYDAY"]) == 0 && interval*7 <= 400:
+		repeat = "d " + strconv.Itoa(interval*7)
+	case freq == "WEEKLY" && interval == 1:
+		var days []string
+		for _, name := range strings.Split(parts["BYDAY"], ",") {
+			n := indexOf(weekDays, name)
+			if n < 1 {
+				return unsupported()
+			}
+			days = append(days, strconv.Itoa(n))
+		}
+		repeat = "w " + strings.Join(days, ",")
+	case freq == "MONTHLY" && interval == 1:
+		days, ok := monthDays()
+		if !ok {
+			return unsupported()
+		}
+		repeat = "m " + days
+	case freq == "YEARLY" && interval == 1 && len(parts["BYMONTH"]) == 0 && len(parts["BYMONTHDAY"]) == 0:
+		repeat = "y"
+	case freq == "YEARLY" && interval == 1 && len(parts["BYMONTH"]) > 0:
+		days, ok := monthDays()
+		if !ok {
+			return unsupported()
+		}
+		repeat = "m " + days + " " + parts["BYMONTH"]
+	default:
+		return unsupported()
+	}
+
+	// Проверяем, что правило укладывается в ограничения формата задачи
+	if _, err := RRule(repeat); err != nil {
+		return unsupported()
+	}
+	return repeat, nil
+}
+
+func indexOf(list []string, s string) int {
+	for i, item := range list {
+		if item == s {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,88 @@
+package ical
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Дни недели RRULE по номерам из правила `w`: 1 - понедельник, 7 - воскресенье
+var weekDays = []string{"", "MO", "TU", "WE", "TH", "FR", "SA", "SU"}
+
+// Переводит правило повторения задачи в RRULE (RFC 5545):
+// `y` - FREQ=YEARLY, `d 7` - FREQ=DAILY;INTERVAL=7, `w 1,5` - FREQ=WEEKLY;BYDAY=MO,FR,
+// `m 1,-1` - FREQ=MONTHLY;BYMONTHDAY=1,-1, `m 10 3,9` - FREQ=YEARLY;BYMONTH=3,9;BYMONTHDAY=10
+func RRule(repeat string) (string, error) {
+	fields := strings.Fields(repeat)
+	if len(fields) == 0 {
+		return "", fmt.Errorf("RRule: empty repeat rule")
+	}
+
+	switch {
+	case fields[0] == "y" && len(fields) == 1:
+		return "FREQ=YEARLY", nil
+
+	case fields[0] == "d" && len(fields) == 2:
+		days, err := strconv.Atoi(fields[1])
+		if err != nil || days < 1 || days > 400 {
+			return "", fmt.Errorf("RRule: invalid repeat rule %q: days must be between 1 and 400", repeat)
+		}
+		if days == 1 {
+			return "FREQ=DAILY", nil
+		}
+		return "FREQ=DAILY;INTERVAL=" + strconv.Itoa(days), nil
+
+	case fields[0] == "w" && len(fields) == 2:
+		days, err := numbers(fields[1], 1, 7)
+		if err != nil {
+			return "", fmt.Errorf("RRule: invalid repeat rule %q: %v", repeat, err)
+		}
+		byDay := make([]string, len(days))
+		for i, day := range days {
+			byDay[i] = weekDays[day]
+		}
+		return "FREQ=WEEKLY;BYDAY=" + strings.Join(byDay, ","), nil
+
+	case fields[0] == "m" && (len(fields) == 2 || len(fields) == 3):
+		days, err := numbers(fields[1], -2, 31)
+		if err != nil {
+			return "", fmt.Errorf("RRule: invalid repeat rule %q: %v", repeat, err)
+		}
+		for _, day := range days {
+			if day == 0 {
+				return "", fmt.Errorf("RRule: invalid repeat rule %q: day 0", repeat)
+			}
+		}
+		byMonthDay := "BYMONTHDAY=" + join(days)
+		if len(fields) == 2 {
+			return "FREQ=MONTHLY;" + byMonthDay, nil
+		}
+		months, err := numbers(fields[2], 1, 12)
+		if err != nil {
+			return "", fmt.Errorf("RRule: invalid repeat rule %q: %v", repeat, err)
+		}
+		return "FREQ=YEARLY;BYMONTH=" + join(months) + ";" + byMonthDay, nil
+	}
+	return "", fmt.Errorf("RRule: invalid repeat rule %q", repeat)
+}
+
+// Разбирает список чисел через запятую, каждое от min до max
+func numbers(list string, min, max int) ([]int, error) {
+	var result []int
+	for _, s := range strings.Split(list, ",") {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < min || n > max {
+			return nil, fmt.Errorf("%q is not a number between %d and %d", s, min, max)
+		}
+		result = append(result, n)
+	}
+	return result, nil
+}
+
+func join(list []int) string {
+	s := make([]string, len(list))
+	for i, n := range list {
+		s[i] = strconv.Itoa(n)
+	}
+	return strings.Join(s, ",")
+}
@@ -0,0 +1,215 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go_final_project/internal/app"
+	"go_final_project/internal/config"
+	"go_final_project/internal/ical"
+)
+
+// Форматы импортируемых файлов. Первые три совпадают с форматами выгрузки `/api/export`
+const (
+	FormatJSON    = "json"
+	FormatCSV     = "csv"
+	FormatICS     = "ics"
+	FormatTodoist = "todoist" // CSV, выгруженный из Todoist
+	FormatTrello  = "trello"  // JSON доски, выгруженный из Trello
+)
+
+// Определяет формат файла по содержимому
+func Detect(data []byte) (string, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case len(trimmed) == 0:
+		return "", app.ValidationError("file", "file is empty")
+	case trimmed[0] == '{' || trimmed[0] == '[':
+		var board struct {
+			Cards json.RawMessage `json:"cards"`
+		}
+		if trimmed[0] == '{' && json.Unmarshal(trimmed, &board) == nil && board.Cards != nil {
+			return FormatTrello, nil
+		}
+		return FormatJSON, nil
+	case bytes.HasPrefix(bytes.ToUpper(trimmed), []byte("BEGIN:VCALENDAR")):
+		return FormatICS, nil
+	}
+
+	header, err := csv.NewReader(bytes.NewReader(data)).Read()
+	if err != nil {
+		return "", app.ValidationError("file", "unknown file format: %v", err)
+	}
+	columns := columnIndex(header)
+	if _, ok := columns["content"]; ok {
+		if _, ok := columns["type"]; ok {
+			return FormatTodoist, nil
+		}
+	}
+	if _, ok := columns["title"]; ok {
+		return FormatCSV, nil
+	}
+	return "", app.ValidationError("file", "unknown file format, expected json, csv, ics, todoist or trello")
+}
+
+// Разбирает файл формата format в задачи для app.Application.ImportTasks. Пустой format определяется по содержимому.
+// Записи, которые не нужно импортировать (выполненные задачи, закрытые карточки), пропускаются.
+// Возвращает формат файла; ошибка возвращается, только если файл нельзя разобрать целиком
+func Parse(data []byte, format string) ([]app.ImportRow, string, error) {
+	if len(format) == 0 {
+		var err error
+		if format, err = Detect(data); err != nil {
+			return nil, "", fmt.Errorf("importer.Parse: %w", err)
+		}
+	}
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+
+	var rows []app.ImportRow
+	var err error
+	switch format {
+	case FormatJSON:
+		rows, err = parseJSON(data)
+	case FormatCSV:
+		rows, err = parseCSV(data)
+	case FormatICS:
+		rows, err = parseICS(data)
+	case FormatTodoist:
+		rows, err = parseTodoist(data)
+	case FormatTrello:
+		rows, err = parseTrello(data)
+	default:
+		return nil, "", fmt.Errorf("importer.Parse: %w", app.ValidationError("format", "unsupported format %q, expected json, csv, ics, todoist or trello", format))
+	}
+	if err != nil {
+		var appErr *app.Error
+		if !errors.As(err, &appErr) {
+			err = app.ValidationError("file", "invalid %s file: %v", format, err)
+		}
+		return nil, "", fmt.Errorf("importer.Parse: %w", err)
+	}
+	return rows, format, nil
+}
+
+// Задачи в формате выгрузки: `{"tasks":[...]}` или просто массив задач. Идентификаторы не сохраняются
+func parseJSON(data []byte) ([]app.ImportRow, error) {
+	var tasks []app.Task
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		if err := json.Unmarshal(data, &tasks); err != nil {
+			return nil, err
+		}
+	} else {
+		var list app.TaskList
+		if err := json.Unmarshal(data, &list); err != nil {
+			return nil, err
+		}
+		tasks = list.List
+	}
+
+	rows := make([]app.ImportRow, 0, len(tasks))
+	for i, task := range tasks {
+		task.ID = ""
+		row := app.ImportRow{Row: i + 1, Task: task}
+		row.Task.Date, row.Err = parseDate(task.Date)
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// CSV с заголовком. Нужна колонка title, остальные колонки выгрузки (date, comment, repeat, list) необязательны
+func parseCSV(data []byte) ([]app.ImportRow, error) {
+	records, err := readCSV(data)
+	if err != nil {
+		return nil, err
+	}
+	columns := columnIndex(records[0])
+	if _, ok := columns["title"]; !ok {
+		return nil, errors.New("title column is required")
+	}
+
+	var rows []app.ImportRow
+	for i, record := range records[1:] {
+		field := func(name string) string {
+			if n, ok := columns[name]; ok && n < len(record) {
+				return strings.TrimSpace(record[n])
+			}
+			return ""
+		}
+		row := app.ImportRow{Row: i + 1, Task: app.Task{Title: field("title"), Comment: field("comment"), Repeat: field("repeat"), List: field("list")}}
+		row.Task.Date, row.Err = parseDate(field("date"))
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// События и задачи календаря. Правило повторения берется из X-TODO-REPEAT, а без него переводится из RRULE.
+// Выполненные и отмененные задачи пропускаются
+func parseICS(data []byte) ([]app.ImportRow, error) {
+	items, err := ical.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []app.ImportRow
+	for _, item := range items {
+		if item.Status == "COMPLETED" || item.Status == "CANCELLED" {
+			continue
+		}
+		row := app.ImportRow{Row: item.Line, Task: app.Task{Title: item.Summary, Comment: item.Description, Repeat: item.Repeat}}
+		row.Task.Date, row.Err = parseDate(item.Date)
+		if row.Err == nil && len(row.Task.Repeat) == 0 && len(item.RRule) > 0 {
+			if row.Task.Repeat, err = ical.Repeat(item.RRule, row.Task.Date); err != nil {
+				row.Err = app.ValidationError("repeat", "%v", err)
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// Дата задачи из импортируемого файла: 20060102, 2006-01-02 или время в формате RFC 3339, которое переводится в местное
+func parseDate(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if len(value) == 0 {
+		return "", nil
+	}
+	for _, layout := range []string{config.DBDateFormat, time.DateOnly} {
+		if date, err := time.Parse(layout, value); err == nil {
+			return date.Format(config.DBDateFormat), nil
+		}
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.Local().Format(config.DBDateFormat), nil
+	}
+	if t, err := time.Parse("2006-01-02T15:04:05", value); err == nil {
+		return t.Format(config.DBDateFormat), nil
+	}
+	return "", app.ValidationError("date", "invalid date %q", value)
+}
+
+func readCSV(data []byte) ([][]string, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, errors.New("header is missing")
+	}
+	return records, nil
+}
+
+// Номера колонок по их названиям в нижнем регистре
+func columnIndex(header []string) map[string]int {
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	return columns
+}
@@ -0,0 +1,62 @@
+package importer
+
+import (
+	"context"
+	"fmt"
+
+	"go_final_project/internal/app"
+)
+
+// Итог импорта файла, который возвращает `/api/import`
+type Report struct {
+	Format     string         `json:"format"`
+	DryRun     bool           `json:"dry_run"`
+	Created    int            `json:"created"`
+	Duplicates int            `json:"duplicates"`
+	Invalid    int            `json:"invalid"`
+	Results    []ReportResult `json:"results"`
+}
+
+// Итог импорта записи. Row - номер записи в файле: строка данных CSV, элемент JSON или строка начала записи ICS
+type ReportResult struct {
+	Row    int          `json:"row"`
+	Title  string       `json:"title"`
+	Status string       `json:"status"`
+	ID     string       `json:"id,omitempty"`
+	Error  *ReportError `json:"error,omitempty"`
+}
+
+// Ошибка записи в том же виде, что и ошибки api
+type ReportError struct {
+	Error  string            `json:"error"`
+	Code   app.Code          `json:"code"`
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+// Разбирает файл формата format (пустой определяется по содержимому) и импортирует задачи в список list через application
+func Import(ctx context.Context, application *app.Application, list string, data []byte, format string, dryRun bool) (Report, error) {
+	rows, format, err := Parse(data, format)
+	if err != nil {
+		return Report{}, fmt.Errorf("importer.Import: %w", err)
+	}
+	results, err := application.ImportTasks(ctx, list, rows, dryRun)
+	if err != nil {
+		return Report{}, fmt.Errorf("importer.Import: %w", err)
+	}
+
+	report := Report{Format: format, DryRun: dryRun, Results: make([]ReportResult, 0, len(results))}
+	for i, result := range results {
+		r := ReportResult{Row: result.Row, Title: rows[i].Task.Title, Status: result.Status, ID: result.ID}
+		switch result.Status {
+		case app.ImportCreated:
+			report.Created++
+		case app.ImportDuplicate:
+			report.Duplicates++
+		case app.ImportInvalid:
+			report.Invalid++
+			r.Error = &ReportError{Error: app.ErrorMessage(result.Err), Code: app.ErrorCode(result.Err), Fields: app.ErrorFields(result.Err)}
+		}
+		report.Results = append(report.Results, r)
+	}
+	return report, nil
+}
@@ -0,0 +1,176 @@
+package importer
+
+import (
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"go_final_project/internal/app"
+	"go_final_project/internal/config"
+)
+
+// Задачи из CSV, выгруженного из Todoist (колонки TYPE, CONTENT, DESCRIPTION, DATE). Строки note
+// дописываются в комментарий предыдущей задачи, разделы пропускаются
+func parseTodoist(data []byte) ([]app.ImportRow, error) {
+	records, err := readCSV(data)
+	if err != nil {
+		return nil, err
+	}
+	columns := columnIndex(records[0])
+
+	var rows []app.ImportRow
+	for i, record := range records[1:] {
+		field := func(name string) string {
+			if n, ok := columns[name]; ok && n < len(record) {
+				return strings.TrimSpace(record[n])
+			}
+			return ""
+		}
+
+		switch strings.ToLower(field("type")) {
+		case "task":
+			row := app.ImportRow{Row: i + 1, Task: app.Task{Title: field("content"), Comment: field("description")}}
+			row.Task.Date, row.Task.Repeat, row.Err = todoistDate(field("date"), time.Now())
+			rows = append(rows, row)
+		case "note":
+			if len(rows) > 0 && len(field("content")) > 0 {
+				task := &rows[len(rows)-1].Task
+				task.Comment = strings.TrimSpace(task.Comment + "\n" + field("content"))
+			}
+		}
+	}
+	return rows, nil
+}
+
+var (
+	todoistEvery   = regexp.MustCompile(`^every (other |\d+ )?(day|week|month|year)s?$`)
+	todoistNthDay  = regexp.MustCompile(`^every (\d{1,2})(st|nd|rd|th)$`)
+	todoistAliases = map[string]string{"daily": "every day", "weekly": "every week", "monthly": "every month", "yearly": "every year"}
+	weekDayNames   = map[string]int{
+		"mon": 1, "monday": 1, "tue": 2, "tuesday": 2, "wed": 3, "wednesday": 3, "thu": 4, "thursday": 4,
+		"fri": 5, "friday": 5, "sat": 6, "saturday": 6, "sun": 7, "sunday": 7,
+	}
+)
+
+// Переводит срок задачи Todoist в дату и правило повторения. Поддерживаются конкретные даты (2024-01-26, Jan 26, 26 Jan 2024),
+// today, tomorrow и повторения every day, every 3 days, every other week, every mon, fri, every 15th, every month, every year
+func todoistDate(value string, now time.Time) (string, string, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if alias, ok := todoistAliases[value]; ok {
+		value = alias
+	}
+	today := now.Format(config.DBDateFormat)
+
+	switch {
+	case len(value) == 0:
+		return "", "", nil
+	case value == "today":
+		return today, "", nil
+	case value == "tomorrow":
+		return now.AddDate(0, 0, 1).Format(config.DBDateFormat), "", nil
+	case !strings.HasPrefix(value, "every "):
+		return todoistFixedDate(value, now)
+	}
+
+	if m := todoistEvery.FindStringSubmatch(value); m != nil {
+		n := 1
+		if m[1] == "other " {
+			n = 2
+		} else if len(m[1]) > 0 {
+			n, _ = strconv.Atoi(strings.TrimSpace(m[1]))
+		}
+		switch {
+		case m[2] == "day":
+			return today, "d " + strconv.Itoa(n), nil
+		case m[2] == "week":
+			return today, "d " + strconv.Itoa(7*n), nil
+		case m[2] == "month" && n == 1:
+			return today, "m " + strconv.Itoa(now.Day()), nil
+		case m[2] == "year" && n == 1:
+			return today, "y", nil
+		}
+	}
+	if m := todoistNthDay.FindStringSubmatch(value); m != nil {
+		return today, "m " + m[1], nil
+	}
+
+	var days []string
+	for _, name := range strings.Split(strings.TrimPrefix(value, "every "), ",") {
+		day, ok := weekDayNames[strings.TrimSpace(name)]
+		if !ok {
+			return "", "", app.ValidationError("repeat", "unsupported Todoist recurring date %q", value)
+		}
+		days = append(days, strconv.Itoa(day))
+	}
+	return today, "w " + strings.Join(days, ","), nil
+}
+
+// Конкретная дата Todoist. Дата без года относится к ближайшему такому дню, начиная с сегодняшнего
+func todoistFixedDate(value string, now time.Time) (string, string, error) {
+	if date, err := parseDate(value); err == nil {
+		return date, "", nil
+	}
+	for _, layout := range []string{"Jan 2 2006", "2 Jan 2006", "January 2 2006", "2 January 2006"} {
+		if t, err := time.Parse(layout, strings.ReplaceAll(value, ",", "")); err == nil {
+			return t.Format(config.DBDateFormat), "", nil
+		}
+	}
+	for _, layout := range []string{"Jan 2", "2 Jan", "January 2", "2 January"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			date := time.Date(now.Year(), t.Month(), t.Day(), 0, 0, 0, 0, now.Location())
+			if date.Before(time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())) {
+				date = date.AddDate(1, 0, 0)
+			}
+			return date.Format(config.DBDateFormat), "", nil
+		}
+	}
+	return "", "", app.ValidationError("date", "unsupported Todoist date %q", value)
+}
+
+// Задачи из JSON доски, выгруженного из Trello: открытые карточки открытых списков.
+// Описание карточки становится комментарием, срок - датой; выполненные карточки пропускаются
+func parseTrello(data []byte) ([]app.ImportRow, error) {
+	var board struct {
+		Lists []struct {
+			ID     string `json:"id"`
+			Closed bool   `json:"closed"`
+		} `json:"lists"`
+		Cards []struct {
+			Name        string  `json:"name"`
+			Desc        string  `json:"desc"`
+			Due         *string `json:"due"`
+			DueComplete bool    `json:"dueComplete"`
+			Closed      bool    `json:"closed"`
+			IDList      string  `json:"idList"`
+		} `json:"cards"`
+	}
+	if err := json.Unmarshal(data, &board); err != nil {
+		return nil, err
+	}
+	if board.Cards == nil {
+		return nil, errors.New("cards are missing")
+	}
+
+	closedLists := make(map[string]bool)
+	for _, list := range board.Lists {
+		if list.Closed {
+			closedLists[list.ID] = true
+		}
+	}
+
+	var rows []app.ImportRow
+	for i, card := range board.Cards {
+		if card.Closed || card.DueComplete || closedLists[card.IDList] {
+			continue
+		}
+		row := app.ImportRow{Row: i + 1, Task: app.Task{Title: strings.TrimSpace(card.Name), Comment: card.Desc}}
+		if card.Due != nil {
+			row.Task.Date, row.Err = parseDate(*card.Due)
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
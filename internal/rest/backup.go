@@ -0,0 +1,16 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Хэндлер GET обращений к `/api/backup/status`, возвращает время последней и следующей резервной копии
+func (mux Mux) BackupStatusHandler(resp http.ResponseWriter, req *http.Request) {
+	statusBytes, err := json.Marshal(mux.backups.Status())
+	if err != nil {
+		mux.makeErrorJsonResponse(err, resp)
+		return
+	}
+	mux.makeJsonResponse(string(statusBytes), resp)
+}
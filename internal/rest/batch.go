@@ -0,0 +1,102 @@
+package rest
+
+import (
+	"fmt"
+	"net/http"
+
+	"go_final_project/internal/app"
+	"go_final_project/internal/authorization"
+)
+
+// Роли, необходимые для операций пакетного запроса, такие же, как у соответствующих запросов к `/api/task`
+var batchRoles = map[string]authorization.Role{
+	app.BatchCreate:   taskRoles[http.MethodPost],
+	app.BatchUpdate:   taskRoles[http.MethodPut],
+	app.BatchDelete:   taskRoles[http.MethodDelete],
+	app.BatchComplete: editorRoles[http.MethodPost],
+}
+
+// Операции пакета могут относиться к разным спискам, поэтому для самого запроса достаточно доступа к списку list,
+// в котором создаются задачи, а права на каждую операцию проверяются в ее списке
+var batchRouteRoles = methodRoles{
+	http.MethodPost: authorization.RoleViewer,
+}
+
+type batchRequest struct {
+	Atomic     bool          `json:"atomic"`
+	Operations []app.BatchOp `json:"operations"`
+}
+
+type batchResult struct {
+	Op    string         `json:"op"`
+	ID    string         `json:"id,omitempty"`
+	Error *errorResponse `json:"error,omitempty"`
+}
+
+type batchResponse struct {
+	Committed bool          `json:"committed"`
+	Results   []batchResult `json:"results"`
+}
+
+// Хэндлер POST обращений к `/api/tasks/batch[?list=]`, выполняет несколько операций с задачами в одной транзакции.
+// Задачи создаются в списке list
+func (mux Mux) TasksBatchHandler(resp http.ResponseWriter, req *http.Request) {
+	var batch batchRequest
+	if err := mux.readJson(req, &batch); err != nil {
+		mux.makeCodeErrorJsonResponse(codeBadRequest, err.Error(), resp)
+		return
+	}
+
+	// Права проверяются до начала транзакции, чтобы пакет не был выполнен частично из-за нехватки прав
+	identity, _ := authorization.IdentityFrom(req.Context())
+	for i := range batch.Operations {
+		op := &batch.Operations[i]
+		required, ok := batchRoles[op.Op]
+		if !ok {
+			continue
+		}
+
+		list := identity.List
+		if op.Op == app.BatchCreate {
+			op.Task.List = list
+		} else {
+			id := op.ID
+			if len(id) == 0 {
+				id = op.Task.ID
+			}
+			task, err := mux.app.GetTask(req.Context(), id)
+			if err != nil {
+				// О несуществующей задаче сообщит результат самой операции
+				continue
+			}
+			list = task.List
+		}
+
+		role, err := mux.auth.RoleIn(req.Context(), identity, list)
+		if err != nil {
+			mux.makeErrorJsonResponse(err, resp)
+			return
+		}
+		if !role.Includes(required) {
+			mux.makeCodeErrorJsonResponse(codeForbidden, fmt.Sprintf("Permission denied: operation %d requires %s role in list %q", i, required, list), resp)
+			return
+		}
+	}
+
+	results, committed, err := mux.app.Batch(req.Context(), batch.Operations, batch.Atomic)
+	if err != nil {
+		mux.makeErrorJsonResponse(err, resp)
+		return
+	}
+
+	body := batchResponse{Committed: committed, Results: make([]batchResult, 0, len(results))}
+	for _, result := range results {
+		r := batchResult{Op: result.Op, ID: result.ID}
+		if result.Err != nil {
+			body := errorBody(result.Err)
+			r.Error = &body
+		}
+		body.Results = append(body.Results, r)
+	}
+	mux.writeJson(http.StatusOK, body, resp)
+}
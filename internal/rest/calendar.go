@@ -0,0 +1,70 @@
+package rest
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"go_final_project/internal/app"
+	"go_final_project/internal/authorization"
+	"go_final_project/internal/export"
+)
+
+// Хэндлер GET обращений к `/api/calendar.ics?key=[&list=]`, календарь задач списка для подписки в календарных приложениях.
+// Приложения не умеют передавать заголовок Authorization, поэтому API-ключ передается в адресе; такой адрес
+// оседает в настройках и журналах, и принимаются только ключи с областью read
+func (mux Mux) CalendarHandler(resp http.ResponseWriter, req *http.Request) {
+	if mux.auth.Enabled() {
+		key, err := mux.auth.VerifyAPIKey(req.Context(), req.URL.Query().Get("key"))
+		if err != nil {
+			mux.makeCodeErrorJsonResponse(app.CodeUnauthorized, "Authentification required", resp)
+			return
+		}
+		if key.Scope != authorization.ScopeRead {
+			mux.makeCodeErrorJsonResponse(codeForbidden, "only read API keys can be used in a calendar URL", resp)
+			return
+		}
+	}
+
+	// Ключ действует во всех списках, поэтому список достаточно взять из адреса
+	tasks, err := mux.app.AllTasks(req.Context(), req.URL.Query().Get("list"))
+	if err != nil {
+		mux.makeErrorJsonResponse(err, resp)
+		return
+	}
+	var feed bytes.Buffer
+	if err := export.WriteFeed(&feed, tasks, time.Now(), mux.cfg.CalendarDays()); err != nil {
+		mux.makeErrorJsonResponse(err, resp)
+		return
+	}
+
+	// Календарь строится заново при каждом запросе, но неизменившийся не передается повторно
+	sum := sha256.Sum256(feed.Bytes())
+	tag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	resp.Header().Set("ETag", tag)
+	resp.Header().Set("Cache-Control", "no-cache")
+	if etagMatches(req.Header.Get("If-None-Match"), tag) {
+		resp.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	resp.Header().Set("Content-Type", "text/calendar; charset=UTF-8")
+	if _, err := resp.Write(feed.Bytes()); err != nil {
+		log.Printf("Mux.CalendarHandler: %v", err)
+	}
+}
+
+// Проверяет, есть ли tag среди ETag из заголовка `If-None-Match`. Слабые ETag сравниваются как сильные
+func etagMatches(header, tag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == tag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,78 @@
+package rest
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+
+	"go_final_project/internal/app"
+	"go_final_project/internal/authorization"
+)
+
+var davRoles = methodRoles{
+	http.MethodOptions: authorization.RoleViewer,
+	http.MethodGet:     authorization.RoleViewer,
+	http.MethodHead:    authorization.RoleViewer,
+	"PROPFIND":         authorization.RoleViewer,
+	"REPORT":           authorization.RoleViewer,
+	http.MethodPut:     authorization.RoleEditor,
+	http.MethodDelete:  authorization.RoleOwner,
+}
+
+// Проверка доступа для клиентов CalDAV, которые умеют только Basic-авторизацию. Паролем служит API-ключ
+// (имя пользователя не проверяется) или пароль сервиса, который дает роль владельца и, как при входе,
+// ограничивается числом неудачных попыток. Остальные способы авторизации проверяются как в Auth, но ключам
+// с областью read кроме GET доступны и запросы чтения CalDAV: OPTIONS, PROPFIND и REPORT
+func (mux Mux) DAVAuth(next http.HandlerFunc) http.HandlerFunc {
+	auth := mux.authenticate(next, davRoles)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !mux.auth.Enabled() {
+			auth(w, r)
+			return
+		}
+		w = challengeWriter{w}
+
+		_, password, ok := r.BasicAuth()
+		if !ok {
+			auth(w, r)
+			return
+		}
+		if authorization.IsAPIKey(password) {
+			r = r.Clone(r.Context())
+			r.Header.Set("Authorization", "Bearer "+password)
+			auth(w, r)
+			return
+		}
+
+		ip := clientIP(r)
+		if wait, ok := mux.auth.Limiter().Allow(ip); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			mux.makeCodeErrorJsonResponse(codeTooManyRequests, "Too many sign-in attempts", w)
+			return
+		}
+		if err := mux.auth.Limiter().Wait(r.Context(), ip); err != nil {
+			mux.makeErrorJsonResponse(err, w)
+			return
+		}
+		if !mux.auth.VerifyPassword(password) {
+			mux.auth.Limiter().Failure(ip)
+			mux.makeCodeErrorJsonResponse(app.CodeUnauthorized, "Authentification required", w)
+			return
+		}
+		mux.auth.Limiter().Success(ip)
+		identity := authorization.Identity{Subject: authorization.PasswordSubject, Role: authorization.RoleOwner}
+		next(w, r.WithContext(authorization.WithIdentity(r.Context(), identity)))
+	})
+}
+
+// Добавляет к ответу 401 заголовок `WWW-Authenticate`, без которого клиенты не спрашивают пароль
+type challengeWriter struct {
+	http.ResponseWriter
+}
+
+func (w challengeWriter) WriteHeader(status int) {
+	if status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Basic realm="todo", charset="UTF-8"`)
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
@@ -0,0 +1,16 @@
+package rest
+
+import (
+	"net/http"
+
+	"go_final_project/internal/httputil"
+)
+
+// Версия задачи id для операции по заголовку `If-Match`. Операция снова сравнивает версию в своей транзакции,
+// поэтому задача, измененная после чтения, не будет перезаписана
+func (mux Mux) taskIfMatch(req *http.Request, id string) (int64, error) {
+	return httputil.IfMatchVersion(req, func() (int64, error) {
+		task, err := mux.app.GetTask(req.Context(), id)
+		return task.Version, err
+	})
+}
@@ -0,0 +1,51 @@
+package rest
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"go_final_project/internal/export"
+	"go_final_project/internal/ical"
+)
+
+// Хэндлер GET обращений к `/api/export?format=json|csv|ics[&list=]`, выгружает все задачи списка файлом, `list=*` - всех списков.
+// Для ics параметр `component=vtodo` заменяет события на записи списка дел
+func (mux Mux) ExportHandler(resp http.ResponseWriter, req *http.Request) {
+	format := req.URL.Query().Get("format")
+	if len(format) == 0 {
+		format = export.FormatJSON
+	}
+	contentType, ok := export.ContentType(format)
+	if !ok {
+		mux.makeCodeErrorJsonResponse(codeBadRequest, fmt.Sprintf("unsupported format %q, expected json, csv or ics", format), resp)
+		return
+	}
+	kind := ical.KindEvent
+	switch component := req.URL.Query().Get("component"); component {
+	case "", "vevent":
+	case "vtodo":
+		kind = ical.KindTodo
+	default:
+		mux.makeCodeErrorJsonResponse(codeBadRequest, fmt.Sprintf("unsupported component %q, expected vevent or vtodo", component), resp)
+		return
+	}
+
+	tasks, err := mux.app.AllTasks(req.Context(), requestList(req))
+	if err != nil {
+		mux.makeErrorJsonResponse(err, resp)
+		return
+	}
+
+	resp.Header().Set("Content-Type", contentType)
+	resp.Header().Set("Content-Disposition", `attachment; filename="tasks.`+format+`"`)
+	if format == export.FormatICS {
+		err = export.WriteICS(resp, kind, tasks)
+	} else {
+		err = export.Write(resp, format, tasks)
+	}
+	if err != nil {
+		// Заголовки уже отправлены, остается только записать ошибку в журнал
+		log.Printf("Mux.ExportHandler: %v", err)
+	}
+}
@@ -4,10 +4,15 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"log"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	"go_final_project/internal/app"
-	"go_final_project/internal/config"
+	"go_final_project/internal/authorization"
+	"go_final_project/internal/httputil"
 )
 
 // Хэндлер обращений к `/api/task`
@@ -25,47 +30,55 @@ func (mux Mux) TaskHandler(resp http.ResponseWriter, req *http.Request) {
 	case http.MethodGet:
 		mux.TaskGetHandler(resp, req)
 
+	case http.MethodPatch:
+		mux.TaskPatchHandler(resp, req)
+
 	default:
-		mux.makeErrorJsonResponse("TaskHandler: invalid request", resp)
+		mux.makeCodeErrorJsonResponse(codeMethodNotAllowed, "TaskHandler: invalid request", resp)
 	}
 }
 
-// Хэндлер POST обращений к `/api/task`
+// Хэндлер POST обращений к `/api/task[?list=]`, создает задачу в списке list
 func (mux Mux) TaskPostHandler(resp http.ResponseWriter, req *http.Request) {
 	var task app.Task
 	var buf bytes.Buffer
 
 	_, err := buf.ReadFrom(req.Body)
 	if err != nil {
-		mux.makeErrorJsonResponse(err.Error(), resp)
+		mux.makeCodeErrorJsonResponse(codeBadRequest, err.Error(), resp)
 		return
 	}
 
 	resp.Header().Set("Content-Type", "application/json; charset=UTF-8")
 	err = json.Unmarshal(buf.Bytes(), &task)
 	if err != nil {
-		mux.makeErrorJsonResponse(err.Error(), resp)
+		mux.makeCodeErrorJsonResponse(codeBadRequest, err.Error(), resp)
 		return
 	}
 
-	id, err := mux.app.AddTask(task)
+	task.List = requestList(req)
+	task, err = mux.app.AddTask(req.Context(), task)
 	if err != nil {
-		fmt.Println("trying to make json responce")
-		mux.makeErrorJsonResponse(err.Error(), resp)
+		mux.makeErrorJsonResponse(err, resp)
 		return
 	}
 
-	mux.makeJsonResponse(fmt.Sprintf(`{"id":"%d"}`, id), resp)
+	mux.makeJsonResponse(fmt.Sprintf(`{"id":"%s"}`, task.ID), resp)
 }
 
 // Хэндлер DELETE обращений к `/api/task`
 func (mux Mux) TaskDeleteHandler(resp http.ResponseWriter, req *http.Request) {
 	resp.Header().Set("Content-Type", "application/json; charset=UTF-8")
 	id := req.URL.Query().Get("id")
-	err := mux.app.RemoveTask(id)
+	version, err := mux.taskIfMatch(req, id)
+	if err != nil {
+		mux.makeErrorJsonResponse(err, resp)
+		return
+	}
+	err = mux.app.RemoveTask(req.Context(), id, version)
 
 	if err != nil {
-		mux.makeErrorJsonResponse(err.Error(), resp)
+		mux.makeErrorJsonResponse(err, resp)
 		return
 	}
 	mux.makeEmptyJsonResponse(resp)
@@ -78,79 +91,99 @@ func (mux Mux) TaskPutHandler(resp http.ResponseWriter, req *http.Request) {
 
 	_, err := buf.ReadFrom(req.Body)
 	if err != nil {
-		http.Error(resp, err.Error(), http.StatusBadRequest)
+		mux.makeCodeErrorJsonResponse(codeBadRequest, err.Error(), resp)
 		return
 	}
 
 	resp.Header().Set("Content-Type", "application/json; charset=UTF-8")
 	err = json.Unmarshal(buf.Bytes(), &task)
 	if err != nil {
-		mux.makeErrorJsonResponse(err.Error(), resp)
+		mux.makeCodeErrorJsonResponse(codeBadRequest, err.Error(), resp)
 		return
 	}
 
-	err = mux.app.UpdateTask(task)
+	task.Version, err = mux.taskIfMatch(req, task.ID)
+	if err != nil {
+		mux.makeErrorJsonResponse(err, resp)
+		return
+	}
+	task, err = mux.app.UpdateTask(req.Context(), task)
 	// Фронтэнд игнорирует ошибку
 	if err != nil {
-		mux.makeErrorJsonResponse(err.Error(), resp)
+		mux.makeErrorJsonResponse(err, resp)
 		return
 	}
+
+	// Тело ответа остается пустым для фронтенда, новая версия передается в ETag
+	resp.Header().Set("ETag", httputil.ETag(task.Version))
 	mux.makeEmptyJsonResponse(resp)
 }
 
+// Хэндлер PATCH обращений к `/api/task`, принимает JSON Merge Patch (RFC 7396)
+func (mux Mux) TaskPatchHandler(resp http.ResponseWriter, req *http.Request) {
+	mux.patchTask(req.URL.Query().Get("id"), resp, req)
+}
+
 // Хэндлер GET обращений к `/api/task`
 func (mux Mux) TaskGetHandler(resp http.ResponseWriter, req *http.Request) {
 	id := req.URL.Query().Get("id")
-	task, err := mux.app.GetTask(id)
+	task, err := mux.app.GetTask(req.Context(), id)
 	if err != nil {
-		mux.makeErrorJsonResponse(err.Error(), resp)
+		mux.makeErrorJsonResponse(err, resp)
 		return
 	}
 
 	jsonResponse, err := json.Marshal(task)
 	if err != nil {
-		mux.makeErrorJsonResponse(err.Error(), resp)
+		mux.makeErrorJsonResponse(err, resp)
 		return
 	}
 
+	resp.Header().Set("ETag", httputil.ETag(task.Version))
+
 	mux.makeJsonResponse(string(jsonResponse), resp)
 }
 
 // Хэндлер POST обращений к `/api/task/done`
 func (mux Mux) TaskDoneHandler(resp http.ResponseWriter, req *http.Request) {
 	if req.Method != http.MethodPost {
-		http.Error(resp, fmt.Errorf("Invalid Request").Error(), http.StatusBadRequest)
+		mux.makeCodeErrorJsonResponse(codeMethodNotAllowed, "Invalid Request", resp)
 		return
 	}
 
 	id := req.URL.Query().Get("id")
-	err := mux.app.FinishTask(id)
+	version, err := mux.taskIfMatch(req, id)
+	if err != nil {
+		mux.makeErrorJsonResponse(err, resp)
+		return
+	}
+	err = mux.app.FinishTask(req.Context(), id, version)
 
 	if err != nil {
-		mux.makeErrorJsonResponse(err.Error(), resp)
+		mux.makeErrorJsonResponse(err, resp)
 		return
 	}
 	mux.makeEmptyJsonResponse(resp)
 }
 
-// Хэндлер GET обращений к `/api/tasks`
+// Хэндлер GET обращений к `/api/tasks[?list=]`
 func (mux Mux) TasksHandler(resp http.ResponseWriter, req *http.Request) {
 	if req.Method != http.MethodGet {
-		http.Error(resp, fmt.Errorf("Invalid Request").Error(), http.StatusBadRequest)
+		mux.makeCodeErrorJsonResponse(codeMethodNotAllowed, "Invalid Request", resp)
 		return
 	}
 
 	searchString := req.URL.Query().Get("search")
 
-	tasks, err := mux.app.GetTaskList(searchString, config.TaskReturnLimit)
+	tasks, err := mux.app.GetTaskList(req.Context(), requestList(req), searchString, mux.cfg.TaskListLimit())
 	if err != nil {
-		mux.makeErrorJsonResponse(err.Error(), resp)
+		mux.makeErrorJsonResponse(err, resp)
 		return
 	}
 
 	taskListBytes, err := json.Marshal(app.TaskList{List: tasks})
 	if err != nil {
-		mux.makeErrorJsonResponse(err.Error(), resp)
+		mux.makeErrorJsonResponse(err, resp)
 		return
 	}
 
@@ -166,26 +199,40 @@ func (mux Mux) NextDateHandler(resp http.ResponseWriter, req *http.Request) {
 
 	nextDate, err := mux.app.NextDate(now, date, repeat)
 	if err != nil {
-		http.Error(resp, err.Error(), http.StatusBadRequest)
+		mux.makeErrorJsonResponse(err, resp)
+		return
 	}
 
+	// Фронтенд ожидает дату простым текстом
+	resp.Header().Set("Content-Type", "text/plain; charset=UTF-8")
 	_, err = resp.Write([]byte(nextDate))
 	if err != nil {
-		http.Error(resp, err.Error(), http.StatusBadRequest)
+		log.Printf("Mux.NextDateHandler: %v", err)
 	}
 }
 
 // Хэндлер POST обращений к `/api/signin`
 func (mux Mux) SignupHandler(resp http.ResponseWriter, req *http.Request) {
 	if req.Method != http.MethodPost {
-		http.Error(resp, fmt.Errorf("Invalid Request").Error(), http.StatusBadRequest)
+		mux.makeCodeErrorJsonResponse(codeMethodNotAllowed, "Invalid Request", resp)
+		return
+	}
+
+	ip := clientIP(req)
+	if wait, ok := mux.auth.Limiter().Allow(ip); !ok {
+		resp.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		mux.makeCodeErrorJsonResponse(codeTooManyRequests, "Too many sign-in attempts", resp)
+		return
+	}
+	if err := mux.auth.Limiter().Wait(req.Context(), ip); err != nil {
+		mux.makeErrorJsonResponse(err, resp)
 		return
 	}
 
 	var buf bytes.Buffer
 	_, err := buf.ReadFrom(req.Body)
 	if err != nil {
-		mux.makeErrorJsonResponse(fmt.Errorf("Mux.SignupHandler: %v", err).Error(), resp)
+		mux.makeCodeErrorJsonResponse(codeBadRequest, fmt.Sprintf("Mux.SignupHandler: %v", err), resp)
 		return
 	}
 
@@ -194,19 +241,68 @@ func (mux Mux) SignupHandler(resp http.ResponseWriter, req *http.Request) {
 	}{}
 	err = json.Unmarshal(buf.Bytes(), &passStruct)
 	if err != nil {
-		mux.makeErrorJsonResponse(fmt.Errorf("Mux.SignupHandler: %v", err).Error(), resp)
+		mux.makeCodeErrorJsonResponse(codeBadRequest, fmt.Sprintf("Mux.SignupHandler: %v", err), resp)
 		return
 	}
 
 	valid := mux.auth.VerifyPassword(passStruct.Password)
 	if !valid {
-		mux.makeErrorJsonResponse("Неверный пароль", resp)
+		mux.auth.Limiter().Failure(ip)
+		mux.makeCodeErrorJsonResponse(app.CodeUnauthorized, "Неверный пароль", resp)
 		return
 	}
-	tokenString, err := mux.auth.CreateToken()
+	mux.auth.Limiter().Success(ip)
+
+	tokenString, err := mux.auth.CreateToken(authorization.PasswordSubject)
 	if err != nil {
-		mux.makeErrorJsonResponse(fmt.Errorf("Mux.SignupHandler: %v", err).Error(), resp)
+		mux.makeErrorJsonResponse(fmt.Errorf("Mux.SignupHandler: %w", err), resp)
+		return
+	}
+	mux.setTokenCookie(tokenString, resp)
+	mux.makeJsonResponse(fmt.Sprintf(`{"token":"%s"}`, tokenString), resp)
+}
+
+// Хэндлер POST обращений к `/api/token/refresh`. Токен берется из заголовка `Authorization: Bearer`,
+// как его передает утилита todo, или из куки `token`
+func (mux Mux) TokenRefreshHandler(resp http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		mux.makeCodeErrorJsonResponse(codeMethodNotAllowed, "Invalid Request", resp)
 		return
 	}
+
+	current, ok := bearerToken(req)
+	if !ok {
+		cookie, err := req.Cookie("token")
+		if err != nil {
+			mux.makeCodeErrorJsonResponse(app.CodeUnauthorized, "Authentification required", resp)
+			return
+		}
+		current = cookie.Value
+	}
+
+	tokenString, err := mux.auth.RefreshToken(req.Context(), current)
+	if app.ErrorCode(err) == app.CodeTimeout {
+		mux.makeErrorJsonResponse(err, resp)
+		return
+	} else if err != nil {
+		mux.makeCodeErrorJsonResponse(app.CodeUnauthorized, "Authentification required", resp)
+		return
+	}
+
+	mux.setTokenCookie(tokenString, resp)
 	mux.makeJsonResponse(fmt.Sprintf(`{"token":"%s"}`, tokenString), resp)
 }
+
+// Выдает куку `token` со сроком действия токена. При включенном TLS кука недоступна скриптам
+// и передается только по HTTPS
+func (mux Mux) setTokenCookie(tokenString string, resp http.ResponseWriter) {
+	http.SetCookie(resp, &http.Cookie{
+		Name:     "token",
+		Value:    tokenString,
+		Path:     "/",
+		Expires:  time.Now().Add(mux.cfg.TokenTTL()),
+		Secure:   mux.cfg.TLSEnabled(),
+		HttpOnly: mux.cfg.TLSEnabled(),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
@@ -0,0 +1,34 @@
+package rest
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"go_final_project/internal/importer"
+)
+
+// Хэндлер POST обращений к `/api/import[?format=][&dry_run=true][&list=]`, создает задачи из файла в теле запроса в списке list.
+// Формат без параметра format определяется по содержимому
+func (mux Mux) ImportHandler(resp http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	dryRun := query.Get("dry_run") == "true" || query.Get("dry_run") == "1"
+
+	data, err := io.ReadAll(http.MaxBytesReader(resp, req.Body, mux.cfg.ImportMaxBytes()))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			err = fmt.Errorf("file is larger than %d bytes", tooLarge.Limit)
+		}
+		mux.makeCodeErrorJsonResponse(codeBadRequest, err.Error(), resp)
+		return
+	}
+
+	report, err := importer.Import(req.Context(), mux.app, requestList(req), data, query.Get("format"), dryRun)
+	if err != nil {
+		mux.makeErrorJsonResponse(err, resp)
+		return
+	}
+	mux.writeJson(http.StatusOK, report, resp)
+}
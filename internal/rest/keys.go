@@ -0,0 +1,104 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// Хэндлер обращений к `/api/keys`. Без пароля и OIDC api открыт всем, и ключи были бы доступны любому клиенту,
+// а созданные так ключи продолжили бы действовать после включения авторизации, поэтому управление ключами отключено
+func (mux Mux) KeysHandler(resp http.ResponseWriter, req *http.Request) {
+	if !mux.auth.Enabled() {
+		mux.makeCodeErrorJsonResponse(codeForbidden, "API keys require TODO_PASSWORD or OIDC login to be configured", resp)
+		return
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+		mux.KeysGetHandler(resp, req)
+
+	case http.MethodPost:
+		mux.KeysPostHandler(resp, req)
+
+	case http.MethodDelete:
+		mux.KeysDeleteHandler(resp, req)
+
+	default:
+		mux.makeCodeErrorJsonResponse(codeMethodNotAllowed, "KeysHandler: invalid request", resp)
+	}
+}
+
+// Хэндлер GET обращений к `/api/keys`, возвращает список ключей без самих ключей
+func (mux Mux) KeysGetHandler(resp http.ResponseWriter, req *http.Request) {
+	resp.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	keys, err := mux.auth.APIKeyList(req.Context())
+	if err != nil {
+		mux.makeErrorJsonResponse(err, resp)
+		return
+	}
+
+	keysBytes, err := json.Marshal(map[string]any{"keys": keys})
+	if err != nil {
+		mux.makeErrorJsonResponse(err, resp)
+		return
+	}
+
+	mux.makeJsonResponse(string(keysBytes), resp)
+}
+
+// Хэндлер POST обращений к `/api/keys`, создает ключ и единственный раз возвращает его в открытом виде
+func (mux Mux) KeysPostHandler(resp http.ResponseWriter, req *http.Request) {
+	var buf bytes.Buffer
+
+	_, err := buf.ReadFrom(req.Body)
+	if err != nil {
+		mux.makeCodeErrorJsonResponse(codeBadRequest, err.Error(), resp)
+		return
+	}
+
+	resp.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	keyStruct := struct {
+		Name  string `json:"name"`
+		Scope string `json:"scope"`
+	}{}
+	err = json.Unmarshal(buf.Bytes(), &keyStruct)
+	if err != nil {
+		mux.makeCodeErrorJsonResponse(codeBadRequest, err.Error(), resp)
+		return
+	}
+
+	key, secret, err := mux.auth.CreateAPIKey(req.Context(), keyStruct.Name, keyStruct.Scope)
+	if err != nil {
+		mux.makeErrorJsonResponse(fmt.Errorf("Mux.KeysPostHandler: %w", err), resp)
+		return
+	}
+
+	keyBytes, err := json.Marshal(struct {
+		ID      string `json:"id"`
+		Name    string `json:"name"`
+		Scope   string `json:"scope"`
+		Created string `json:"created"`
+		Key     string `json:"key"`
+	}{key.ID, key.Name, key.Scope, key.Created, secret})
+	if err != nil {
+		mux.makeErrorJsonResponse(err, resp)
+		return
+	}
+
+	mux.makeJsonResponse(string(keyBytes), resp)
+}
+
+// Хэндлер DELETE обращений к `/api/keys`, отзывает ключ по id
+func (mux Mux) KeysDeleteHandler(resp http.ResponseWriter, req *http.Request) {
+	resp.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	id := req.URL.Query().Get("id")
+	err := mux.auth.RevokeAPIKey(req.Context(), id)
+
+	if err != nil {
+		mux.makeErrorJsonResponse(err, resp)
+		return
+	}
+	mux.makeEmptyJsonResponse(resp)
+}
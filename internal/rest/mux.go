@@ -2,35 +2,81 @@ package rest
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log"
+	"net"
 	"net/http"
+	"strings"
+	"time"
 
 	"go_final_project/internal/app"
 	"go_final_project/internal/authorization"
+	"go_final_project/internal/backup"
+	"go_final_project/internal/caldav"
 	"go_final_project/internal/config"
+	"go_final_project/internal/httputil"
+	"go_final_project/internal/webhook"
 )
 
 type Mux struct {
 	cfg      *config.Handler
 	app      *app.Application
 	auth     *authorization.Handler
+	backups  *backup.Scheduler
+	dav      *caldav.Handler
+	webhooks *webhook.Dispatcher
 	serveMux *http.ServeMux
+	routes   []string // шаблоны зарегистрированных маршрутов api
 }
 
-func NewMux(app *app.Application, cfg *config.Handler) *Mux {
+// Зависимости api, которые создаются вне пакета rest
+type Deps struct {
+	App      *app.Application
+	Auth     *authorization.Handler
+	Backups  *backup.Scheduler
+	DAV      *caldav.Handler
+	Webhooks *webhook.Dispatcher
+}
+
+func NewMux(deps Deps, cfg *config.Handler) *Mux {
 	mux := &Mux{
 		cfg:      cfg,
-		app:      app,
+		app:      deps.App,
 		serveMux: http.NewServeMux(),
-		auth:     authorization.Create(),
+		auth:     deps.Auth,
+		backups:  deps.Backups,
+		dav:      deps.DAV,
+		webhooks: deps.Webhooks,
 	}
 
 	mux.serveMux.Handle("/", http.FileServer(http.Dir(cfg.WebDirPath())))
-	mux.serveMux.HandleFunc("/api/nextdate", mux.NextDateHandler)
-	mux.serveMux.HandleFunc("/api/task", mux.Auth(mux.TaskHandler))
-	mux.serveMux.HandleFunc("/api/tasks", mux.Auth(mux.TasksHandler))
-	mux.serveMux.HandleFunc("/api/task/done", mux.Auth(mux.TaskDoneHandler))
-	mux.serveMux.HandleFunc("/api/signin", mux.SignupHandler) // ошибка в задании ...
+	mux.handle("/api/nextdate", mux.NextDateHandler)
+	mux.handle("/api/task", mux.Auth(mux.Permit(taskRoles, mux.TaskHandler)))
+	mux.handle("/api/tasks", mux.Auth(mux.Permit(viewerRoles, mux.TasksHandler)))
+	mux.handle("/api/task/done", mux.Auth(mux.Permit(editorRoles, mux.TaskDoneHandler)))
+	mux.handle("POST /api/tasks/batch", mux.Auth(mux.Permit(batchRouteRoles, mux.TasksBatchHandler)))
+	mux.handle("/api/signin", mux.SignupHandler) // ошибка в задании ...
+	mux.handle("/api/token/refresh", mux.TokenRefreshHandler)
+	mux.handle("/api/oidc/login", mux.OIDCLoginHandler)
+	mux.handle("/api/oidc/callback", mux.OIDCCallbackHandler)
+	mux.handle("/api/keys", mux.SessionAuth(mux.PermitOwner(mux.KeysHandler)))
+	mux.handle("/api/roles", mux.SessionAuth(mux.PermitOwner(mux.RolesHandler)))
+	mux.handleTransfer("POST /api/import", mux.Auth(mux.Permit(editorRoles, mux.ImportHandler)))
+	mux.handleTransfer("GET /api/export", mux.Auth(mux.Permit(viewerRoles, mux.ExportHandler)))
+	mux.handle("GET /api/calendar.ics", mux.CalendarHandler)
+	mux.handle("/api/webhooks", mux.SessionAuth(mux.PermitOwner(mux.WebhooksHandler)))
+	mux.handle("GET /api/webhooks/deliveries", mux.SessionAuth(mux.PermitOwner(mux.WebhookDeliveriesHandler)))
+	mux.handle("GET /api/backup/status", mux.Auth(mux.PermitOwner(mux.BackupStatusHandler)))
+	mux.handle("/api/openapi.json", mux.OpenAPIHandler)
+	mux.registerV1()
+
+	// CalDAV не входит в api: методы PROPFIND и REPORT нельзя описать в OpenAPI, а ошибки отдаются текстом
+	mux.serveMux.HandleFunc(caldav.Prefix, mux.TransferTimeout(mux.DAVAuth(mux.Permit(davRoles, mux.dav.ServeHTTP))))
+	mux.serveMux.Handle("/.well-known/caldav", http.RedirectHandler(caldav.Prefix, http.StatusMovedPermanently))
 
 	return mux
 }
@@ -39,38 +85,329 @@ func (mux *Mux) ServeMux() *http.ServeMux {
 	return mux.serveMux
 }
 
+// Регистрирует маршрут api и запоминает его шаблон, чтобы сверять маршруты с описанием api
+func (mux *Mux) handle(pattern string, handler http.HandlerFunc) {
+	mux.serveMux.HandleFunc(pattern, mux.Timeout(handler))
+	mux.routes = append(mux.routes, pattern)
+}
+
+// Шаблоны зарегистрированных маршрутов api в формате http.ServeMux
+func (mux *Mux) Routes() []string {
+	return append([]string(nil), mux.routes...)
+}
+
+// Регистрирует маршрут выгрузки или загрузки задач: время его обработки ограничено TransferTimeout
+func (mux *Mux) handleTransfer(pattern string, handler http.HandlerFunc) {
+	mux.serveMux.HandleFunc(pattern, mux.TransferTimeout(handler))
+	mux.routes = append(mux.routes, pattern)
+}
+
+// Ограничивает время обработки запроса: по истечении RequestTimeout из настроек контекст запроса отменяется,
+// и незавершенные запросы к базе прерываются. Контекст отменяется и при отключении клиента
+func (mux Mux) Timeout(next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), mux.cfg.RequestTimeout())
+		defer cancel()
+		next(w, r.WithContext(ctx))
+	})
+}
+
+// Как Timeout, но с TransferTimeout из настроек. Сроки чтения и записи соединения продлеваются так же,
+// иначе сервер оборвет передачу большого файла по ReadTimeout и WriteTimeout
+func (mux Mux) TransferTimeout(next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		timeout := mux.cfg.TransferTimeout()
+		controller := http.NewResponseController(w)
+		if err := controller.SetReadDeadline(time.Now().Add(timeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			log.Printf("Mux.TransferTimeout: %v", err)
+		}
+		// Запас WriteTimeout нужен, чтобы ответ о превышении времени успел дойти до клиента
+		if err := controller.SetWriteDeadline(time.Now().Add(timeout + mux.cfg.WriteTimeout())); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			log.Printf("Mux.TransferTimeout: %v", err)
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		next(w, r.WithContext(ctx))
+	})
+}
+
+// Пропускает запросы с действительным токеном (из куки `token` или заголовка `Authorization: Bearer`)
+// или с API-ключом, область действия которого разрешает метод запроса
 func (mux Mux) Auth(next http.HandlerFunc) http.HandlerFunc {
+	return mux.authenticate(next, readRoles)
+}
+
+// Как Auth, но не принимает API-ключи: управлять доступом можно только после входа пользователя
+func (mux Mux) SessionAuth(next http.HandlerFunc) http.HandlerFunc {
+	return mux.authenticate(next, nil)
+}
+
+// Проверяет, кто выполняет запрос, и передает его дальше в контексте запроса. Роль пользователя
+// зависит от списка задач и определяется в Permit. Ключам с областью read доступны методы, которым в keyRoles
+// достаточно роли viewer, а без keyRoles ключи не принимаются
+func (mux Mux) authenticate(next http.HandlerFunc, keyRoles methodRoles) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// смотрим наличие пароля
+		if !mux.auth.Enabled() {
+			identity := authorization.Identity{Subject: authorization.PasswordSubject, Role: authorization.RoleOwner}
+			next(w, r.WithContext(authorization.WithIdentity(r.Context(), identity)))
+			return
+		}
+
+		bearer, hasBearer := bearerToken(r)
+
+		if hasBearer && authorization.IsAPIKey(bearer) {
+			if keyRoles == nil {
+				mux.makeCodeErrorJsonResponse(codeForbidden, "API keys are not accepted here", w)
+				return
+			}
+			key, err := mux.auth.VerifyAPIKey(r.Context(), bearer)
+			if err != nil {
+				mux.makeCodeErrorJsonResponse(app.CodeUnauthorized, "Authentification required", w)
+				return
+			}
+			if !authorization.KeyAllows(key, keyRoles[r.Method] == authorization.RoleViewer) {
+				mux.makeCodeErrorJsonResponse(codeForbidden, "API key scope does not allow this request", w)
+				return
+			}
+			identity := authorization.Identity{Subject: "key:" + key.ID, Role: authorization.KeyRole(key)}
+			next(w, r.WithContext(authorization.WithIdentity(r.Context(), identity)))
+			return
+		}
 
-		if mux.auth.PasswordSetted() {
-			var jwt string // JWT-токен из куки
+		jwt := bearer // JWT-токен из заголовка или из куки
+		if !hasBearer {
 			// получаем куку
 			cookie, err := r.Cookie("token")
 			if err == nil {
 				jwt = cookie.Value
 			}
+		}
 
-			if !mux.auth.VerifyTocken(jwt) {
-				http.Error(w, "Authentification required", http.StatusUnauthorized)
-				return
-			}
+		claims, err := mux.auth.ParseToken(r.Context(), jwt)
+		if err != nil {
+			mux.makeCodeErrorJsonResponse(app.CodeUnauthorized, "Authentification required", w)
+			return
 		}
-		next(w, r)
+		identity := authorization.Identity{Subject: claims.Subject, Scoped: true}
+		next(w, r.WithContext(authorization.WithIdentity(r.Context(), identity)))
+	})
+}
+
+// Минимальные роли, необходимые для запросов с каждым из методов
+type methodRoles map[string]authorization.Role
+
+var (
+	// Методы api, которые только читают данные
+	readRoles = methodRoles{
+		http.MethodGet:  authorization.RoleViewer,
+		http.MethodHead: authorization.RoleViewer,
+	}
+	viewerRoles = methodRoles{
+		http.MethodGet: authorization.RoleViewer,
+	}
+	editorRoles = methodRoles{
+		http.MethodPost: authorization.RoleEditor,
+	}
+	taskRoles = methodRoles{
+		http.MethodGet:    authorization.RoleViewer,
+		http.MethodPost:   authorization.RoleEditor,
+		http.MethodPut:    authorization.RoleEditor,
+		http.MethodPatch:  authorization.RoleEditor,
+		http.MethodDelete: authorization.RoleOwner,
+	}
+)
+
+// Пропускает запрос, только если роль в списке задач, к которому он относится, разрешает метод запроса.
+// Методы, не перечисленные в roles, доступны только владельцу. Список и роль в нем передаются дальше в Identity
+func (mux Mux) Permit(roles methodRoles, next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		required, ok := roles[r.Method]
+		if !ok {
+			required = authorization.RoleOwner
+		}
+
+		list, err := mux.resolveList(r)
+		if err != nil {
+			mux.makeErrorJsonResponse(err, w)
+			return
+		}
+		mux.permit(list, required, next, w, r)
+	})
+}
+
+// Пропускает запрос только владельца всех списков задач: для управления доступом, вебхуками и резервными копиями
+func (mux Mux) PermitOwner(next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mux.permit(authorization.AllLists, authorization.RoleOwner, next, w, r)
 	})
 }
 
+func (mux Mux) permit(list string, required authorization.Role, next http.HandlerFunc, w http.ResponseWriter, r *http.Request) {
+	identity, ok := authorization.IdentityFrom(r.Context())
+	if !ok {
+		mux.makeCodeErrorJsonResponse(codeForbidden, fmt.Sprintf("Permission denied: %s role required", required), w)
+		return
+	}
+	role, err := mux.auth.RoleIn(r.Context(), identity, list)
+	if err != nil {
+		mux.makeErrorJsonResponse(err, w)
+		return
+	}
+	if !role.Includes(required) {
+		mux.makeCodeErrorJsonResponse(codeForbidden, fmt.Sprintf("Permission denied: %s role required", required), w)
+		return
+	}
+	identity.Role, identity.List = role, list
+	next(w, r.WithContext(authorization.WithIdentity(r.Context(), identity)))
+}
+
+// Список задач, к которому относится запрос: список задачи, id которой указан в пути, параметре `id`
+// или, для PUT `/api/task`, в теле запроса, иначе параметр `list`
+func (mux Mux) resolveList(r *http.Request) (string, error) {
+	id := r.PathValue("id")
+	if len(id) == 0 {
+		id = r.URL.Query().Get("id")
+	}
+	if len(id) == 0 && r.Method == http.MethodPut && r.URL.Path == "/api/task" {
+		var err error
+		if id, err = peekTaskID(r); err != nil {
+			return "", fmt.Errorf("Mux.resolveList: %w", app.ValidationError("id", "invalid request body: %v", err))
+		}
+	}
+	if len(id) == 0 {
+		return r.URL.Query().Get("list"), nil
+	}
+
+	task, err := mux.app.GetTask(r.Context(), id)
+	if err != nil {
+		return "", fmt.Errorf("Mux.resolveList: %w", err)
+	}
+	return task.List, nil
+}
+
+// Читает id задачи из JSON тела запроса, оставляя тело нетронутым для хэндлера
+func peekTaskID(r *http.Request) (string, error) {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return "", err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(data))
+
+	var body struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(data, &body); err != nil {
+		return "", err
+	}
+	return body.ID, nil
+}
+
+// Список задач, к которому Permit отнес запрос
+func requestList(req *http.Request) string {
+	identity, _ := authorization.IdentityFrom(req.Context())
+	return identity.List
+}
+
+// Коды ошибок уровня api, дополняющие коды ошибок app
+const (
+	codeBadRequest       app.Code = "bad_request"
+	codeForbidden        app.Code = "forbidden"
+	codeMethodNotAllowed app.Code = "method_not_allowed"
+	codeTooManyRequests  app.Code = "too_many_requests"
+
+	codeUnsupportedMediaType app.Code = "unsupported_media_type"
+)
+
+// Статусы ошибок уровня api, статусы ошибок app задает httputil.ErrorStatus
+var errorStatuses = map[app.Code]int{
+	codeBadRequest:       http.StatusBadRequest,
+	codeForbidden:        http.StatusForbidden,
+	codeMethodNotAllowed: http.StatusMethodNotAllowed,
+	codeTooManyRequests:  http.StatusTooManyRequests,
+
+	codeUnsupportedMediaType: http.StatusUnsupportedMediaType,
+}
+
+// Тело ответа с ошибкой. Поле `error` оставлено для фронтенда, который показывает его пользователю
+type errorResponse struct {
+	Error  string            `json:"error"`
+	Code   app.Code          `json:"code"`
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
 func (mux Mux) makeJsonResponse(jsonString string, resp http.ResponseWriter) {
+	resp.Header().Set("Content-Type", "application/json; charset=UTF-8")
 	_, err := resp.Write(bytes.NewBufferString(jsonString).Bytes())
 	if err != nil {
-		http.Error(resp, err.Error(), http.StatusBadRequest)
+		log.Printf("Mux.makeJsonResponse: %v", err)
+	}
+}
+
+// Отвечает ошибкой с HTTP-статусом, соответствующим коду ошибки из цепочки err
+func (mux Mux) makeErrorJsonResponse(err error, resp http.ResponseWriter) {
+	mux.writeError(errorBody(err), resp)
+}
+
+// Тело ответа с ошибкой err: клиент получает только сообщение ошибки предметной области,
+// подробности внутренних ошибок остаются в журнале сервера
+func errorBody(err error) errorResponse {
+	code := app.ErrorCode(err)
+	if code == app.CodeInternal {
+		log.Printf("internal error: %v", err)
+	} else if code == app.CodeTimeout {
+		log.Printf("request timed out: %v", err)
 	}
+	return errorResponse{Error: app.ErrorMessage(err), Code: code, Fields: app.ErrorFields(err)}
 }
 
-func (mux Mux) makeErrorJsonResponse(error string, resp http.ResponseWriter) {
-	mux.makeJsonResponse(fmt.Sprintf(`{"error":"%s"}`, error), resp)
+// Отвечает ошибкой уровня api с указанным кодом
+func (mux Mux) makeCodeErrorJsonResponse(code app.Code, message string, resp http.ResponseWriter) {
+	mux.writeError(errorResponse{Error: message, Code: code}, resp)
+}
+
+func (mux Mux) writeError(body errorResponse, resp http.ResponseWriter) {
+	status, ok := httputil.ErrorStatus(body.Code)
+	if !ok {
+		status, ok = errorStatuses[body.Code]
+	}
+	if !ok {
+		status = http.StatusInternalServerError
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		log.Printf("Mux.writeError: %v", err)
+		data = []byte(`{"error":"internal server error","code":"internal_error"}`)
+	}
+
+	resp.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	resp.WriteHeader(status)
+	if _, err := resp.Write(data); err != nil {
+		log.Printf("Mux.writeError: %v", err)
+	}
 }
 
 func (mux Mux) makeEmptyJsonResponse(resp http.ResponseWriter) {
-	mux.makeJsonResponse(fmt.Sprintf(`{}`), resp)
+	mux.makeJsonResponse(`{}`, resp)
+}
+
+// Возвращает адрес клиента без порта
+func clientIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+// Возвращает значение из заголовка `Authorization: Bearer <...>`
+func bearerToken(req *http.Request) (string, bool) {
+	header := req.Header.Get("Authorization")
+	token, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok || len(token) == 0 {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
 }
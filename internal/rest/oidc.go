@@ -0,0 +1,78 @@
+package rest
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"go_final_project/internal/app"
+)
+
+const oidcStateCookie = "oidc_state"
+
+// Хэндлер GET обращений к `/api/oidc/login`, перенаправляет пользователя на страницу входа OIDC-провайдера
+func (mux Mux) OIDCLoginHandler(resp http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		mux.makeCodeErrorJsonResponse(codeMethodNotAllowed, "Invalid Request", resp)
+		return
+	}
+	if !mux.auth.OIDC().Enabled() {
+		mux.makeCodeErrorJsonResponse(app.CodeNotFound, "OIDC login is not configured", resp)
+		return
+	}
+
+	authURL, state, err := mux.auth.OIDC().AuthURL(req.Context())
+	if err != nil {
+		log.Printf("Mux.OIDCLoginHandler: %v", err)
+		mux.makeCodeErrorJsonResponse(app.CodeInternal, "OIDC provider is unavailable", resp)
+		return
+	}
+	mux.setOIDCStateCookie(state, mux.auth.OIDC().StateTTL(), resp)
+	http.Redirect(resp, req, authURL, http.StatusFound)
+}
+
+// Кука с state привязывает вход к браузеру, который его начал. SameSite=Lax, чтобы кука
+// передавалась при возврате от провайдера по ссылке
+func (mux Mux) setOIDCStateCookie(state string, ttl time.Duration, resp http.ResponseWriter) {
+	http.SetCookie(resp, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/api/oidc/",
+		MaxAge:   int(ttl.Seconds()),
+		Secure:   mux.cfg.TLSEnabled(),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// Хэндлер GET обращений к `/api/oidc/callback`, куда провайдер возвращает пользователя после входа.
+// Выдает куку `token` так же, как это делает фронтенд после входа по паролю
+func (mux Mux) OIDCCallbackHandler(resp http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		mux.makeCodeErrorJsonResponse(codeMethodNotAllowed, "Invalid Request", resp)
+		return
+	}
+
+	query := req.URL.Query()
+	if e := query.Get("error"); len(e) > 0 {
+		mux.makeCodeErrorJsonResponse(app.CodeUnauthorized, "OIDC login failed: "+e, resp)
+		return
+	}
+
+	var browserState string
+	if cookie, err := req.Cookie(oidcStateCookie); err == nil {
+		browserState = cookie.Value
+	}
+	// state одноразовый, кука больше не нужна при любом исходе
+	mux.setOIDCStateCookie("", -time.Second, resp)
+
+	tokenString, err := mux.auth.SigninOIDC(req.Context(), browserState, query.Get("state"), query.Get("code"))
+	if err != nil {
+		log.Printf("Mux.OIDCCallbackHandler: %v", err)
+		mux.makeCodeErrorJsonResponse(app.CodeUnauthorized, "OIDC login failed", resp)
+		return
+	}
+
+	mux.setTokenCookie(tokenString, resp)
+	http.Redirect(resp, req, "/", http.StatusFound)
+}
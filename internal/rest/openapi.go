@@ -0,0 +1,21 @@
+package rest
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// Описание api в формате OpenAPI 3, составляется вручную. Тест в `internal/tests` проверяет, что в нем есть все маршруты
+// из NewMux и что ответы хэндлеров соответствуют описанным схемам
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// Хэндлер GET обращений к `/api/openapi.json`
+func (mux Mux) OpenAPIHandler(resp http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		mux.makeCodeErrorJsonResponse(codeMethodNotAllowed, "Invalid Request", resp)
+		return
+	}
+	mux.makeJsonResponse(string(openAPISpec), resp)
+}
@@ -0,0 +1,100 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"go_final_project/internal/authorization"
+)
+
+// Хэндлер обращений к `/api/roles`
+func (mux Mux) RolesHandler(resp http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		mux.RolesGetHandler(resp, req)
+
+	case http.MethodPost:
+		mux.RolesPostHandler(resp, req)
+
+	case http.MethodDelete:
+		mux.RolesDeleteHandler(resp, req)
+
+	default:
+		mux.makeCodeErrorJsonResponse(codeMethodNotAllowed, "RolesHandler: invalid request", resp)
+	}
+}
+
+// Хэндлер GET обращений к `/api/roles`, возвращает явно назначенные роли
+func (mux Mux) RolesGetHandler(resp http.ResponseWriter, req *http.Request) {
+	resp.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	bindings, err := mux.auth.RoleList(req.Context())
+	if err != nil {
+		mux.makeErrorJsonResponse(err, resp)
+		return
+	}
+
+	rolesBytes, err := json.Marshal(map[string]any{"roles": bindings})
+	if err != nil {
+		mux.makeErrorJsonResponse(err, resp)
+		return
+	}
+
+	mux.makeJsonResponse(string(rolesBytes), resp)
+}
+
+// Назначение роли. Без list роль действует во всех списках, как до появления списков задач
+type roleRequest struct {
+	Subject string  `json:"subject"`
+	List    *string `json:"list"`
+	Role    string  `json:"role"`
+}
+
+// Хэндлер POST обращений к `/api/roles`, назначает пользователю роль в списке задач
+func (mux Mux) RolesPostHandler(resp http.ResponseWriter, req *http.Request) {
+	var binding roleRequest
+	var buf bytes.Buffer
+
+	_, err := buf.ReadFrom(req.Body)
+	if err != nil {
+		mux.makeCodeErrorJsonResponse(codeBadRequest, err.Error(), resp)
+		return
+	}
+
+	resp.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	err = json.Unmarshal(buf.Bytes(), &binding)
+	if err != nil {
+		mux.makeCodeErrorJsonResponse(codeBadRequest, err.Error(), resp)
+		return
+	}
+
+	list := authorization.AllLists
+	if binding.List != nil {
+		list = *binding.List
+	}
+	err = mux.auth.SetRole(req.Context(), binding.Subject, list, authorization.Role(binding.Role))
+	if err != nil {
+		mux.makeErrorJsonResponse(fmt.Errorf("Mux.RolesPostHandler: %w", err), resp)
+		return
+	}
+	mux.makeEmptyJsonResponse(resp)
+}
+
+// Хэндлер DELETE обращений к `/api/roles?subject=[&list=]`, снимает роль пользователя subject в списке list,
+// без list - роль во всех списках
+func (mux Mux) RolesDeleteHandler(resp http.ResponseWriter, req *http.Request) {
+	resp.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	query := req.URL.Query()
+	list := authorization.AllLists
+	if query.Has("list") {
+		list = query.Get("list")
+	}
+	err := mux.auth.RemoveRole(req.Context(), query.Get("subject"), list)
+
+	if err != nil {
+		mux.makeErrorJsonResponse(err, resp)
+		return
+	}
+	mux.makeEmptyJsonResponse(resp)
+}
@@ -0,0 +1,186 @@
+package rest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+
+	"go_final_project/internal/app"
+	"go_final_project/internal/httputil"
+)
+
+const (
+	// Префикс версионированного api
+	v1Prefix = "/api/v1"
+
+	mergePatchMediaType = "application/merge-patch+json"
+)
+
+// Регистрирует маршруты `/api/v1/tasks`. Старые маршруты `/api/task*` остаются для фронтенда из `web`
+func (mux *Mux) registerV1() {
+	mux.handle("GET "+v1Prefix+"/tasks", mux.Auth(mux.Permit(taskRoles, mux.V1ListHandler)))
+	mux.handle("POST "+v1Prefix+"/tasks", mux.Auth(mux.Permit(taskRoles, mux.V1CreateHandler)))
+	mux.handle("GET "+v1Prefix+"/tasks/{id}", mux.Auth(mux.Permit(taskRoles, mux.V1GetHandler)))
+	mux.handle("PUT "+v1Prefix+"/tasks/{id}", mux.Auth(mux.Permit(taskRoles, mux.V1PutHandler)))
+	mux.handle("PATCH "+v1Prefix+"/tasks/{id}", mux.Auth(mux.Permit(taskRoles, mux.V1PatchHandler)))
+	mux.handle("DELETE "+v1Prefix+"/tasks/{id}", mux.Auth(mux.Permit(taskRoles, mux.V1DeleteHandler)))
+	mux.handle("POST "+v1Prefix+"/tasks/{id}/complete", mux.Auth(mux.Permit(editorRoles, mux.V1CompleteHandler)))
+}
+
+// Хэндлер GET обращений к `/api/v1/tasks[?list=]`
+func (mux Mux) V1ListHandler(resp http.ResponseWriter, req *http.Request) {
+	tasks, err := mux.app.GetTaskList(req.Context(), requestList(req), req.URL.Query().Get("search"), mux.cfg.TaskListLimit())
+	if err != nil {
+		mux.makeErrorJsonResponse(err, resp)
+		return
+	}
+	mux.writeJson(http.StatusOK, app.TaskList{List: tasks}, resp)
+}
+
+// Хэндлер POST обращений к `/api/v1/tasks[?list=]`, отвечает `201 Created` с адресом новой задачи
+func (mux Mux) V1CreateHandler(resp http.ResponseWriter, req *http.Request) {
+	var task app.Task
+	if err := mux.readJson(req, &task); err != nil {
+		mux.makeCodeErrorJsonResponse(codeBadRequest, err.Error(), resp)
+		return
+	}
+	task.List = requestList(req)
+
+	task, err := mux.app.AddTask(req.Context(), task)
+	if err != nil {
+		mux.makeErrorJsonResponse(err, resp)
+		return
+	}
+
+	resp.Header().Set("Location", fmt.Sprintf("%s/tasks/%s", v1Prefix, task.ID))
+	resp.Header().Set("ETag", httputil.ETag(task.Version))
+	mux.writeJson(http.StatusCreated, task, resp)
+}
+
+// Хэндлер GET обращений к `/api/v1/tasks/{id}`
+func (mux Mux) V1GetHandler(resp http.ResponseWriter, req *http.Request) {
+	task, err := mux.app.GetTask(req.Context(), req.PathValue("id"))
+	if err != nil {
+		mux.makeErrorJsonResponse(err, resp)
+		return
+	}
+	resp.Header().Set("ETag", httputil.ETag(task.Version))
+	mux.writeJson(http.StatusOK, task, resp)
+}
+
+// Хэндлер PUT обращений к `/api/v1/tasks/{id}`, заменяет задачу целиком
+func (mux Mux) V1PutHandler(resp http.ResponseWriter, req *http.Request) {
+	var task app.Task
+	if err := mux.readJson(req, &task); err != nil {
+		mux.makeCodeErrorJsonResponse(codeBadRequest, err.Error(), resp)
+		return
+	}
+	task.ID = req.PathValue("id")
+	version, err := mux.taskIfMatch(req, task.ID)
+	if err != nil {
+		mux.makeErrorJsonResponse(err, resp)
+		return
+	}
+	task.Version = version
+
+	mux.updateV1Task(task, resp, req)
+}
+
+// Хэндлер PATCH обращений к `/api/v1/tasks/{id}`, принимает JSON Merge Patch (RFC 7396)
+func (mux Mux) V1PatchHandler(resp http.ResponseWriter, req *http.Request) {
+	mux.patchTask(req.PathValue("id"), resp, req)
+}
+
+// Применяет тело запроса к задаче id как JSON Merge Patch и возвращает измененную задачу
+func (mux Mux) patchTask(id string, resp http.ResponseWriter, req *http.Request) {
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if mediaType != mergePatchMediaType && mediaType != "application/json" {
+		mux.makeCodeErrorJsonResponse(codeUnsupportedMediaType, "PATCH requires "+mergePatchMediaType, resp)
+		return
+	}
+
+	patch, err := io.ReadAll(req.Body)
+	if err != nil {
+		mux.makeCodeErrorJsonResponse(codeBadRequest, err.Error(), resp)
+		return
+	}
+
+	version, err := mux.taskIfMatch(req, id)
+	if err != nil {
+		mux.makeErrorJsonResponse(err, resp)
+		return
+	}
+	task, err := mux.app.PatchTask(req.Context(), id, patch, version)
+	if err != nil {
+		mux.makeErrorJsonResponse(err, resp)
+		return
+	}
+	resp.Header().Set("ETag", httputil.ETag(task.Version))
+	mux.writeJson(http.StatusOK, task, resp)
+}
+
+// Сохраняет задачу и возвращает ее в том виде, в котором она сохранена
+func (mux Mux) updateV1Task(task app.Task, resp http.ResponseWriter, req *http.Request) {
+	task, err := mux.app.UpdateTask(req.Context(), task)
+	if err != nil {
+		mux.makeErrorJsonResponse(err, resp)
+		return
+	}
+	resp.Header().Set("ETag", httputil.ETag(task.Version))
+	mux.writeJson(http.StatusOK, task, resp)
+}
+
+// Хэндлер DELETE обращений к `/api/v1/tasks/{id}`
+func (mux Mux) V1DeleteHandler(resp http.ResponseWriter, req *http.Request) {
+	version, err := mux.taskIfMatch(req, req.PathValue("id"))
+	if err != nil {
+		mux.makeErrorJsonResponse(err, resp)
+		return
+	}
+	err = mux.app.RemoveTask(req.Context(), req.PathValue("id"), version)
+	if err != nil {
+		mux.makeErrorJsonResponse(err, resp)
+		return
+	}
+	resp.WriteHeader(http.StatusNoContent)
+}
+
+// Хэндлер POST обращений к `/api/v1/tasks/{id}/complete`
+func (mux Mux) V1CompleteHandler(resp http.ResponseWriter, req *http.Request) {
+	version, err := mux.taskIfMatch(req, req.PathValue("id"))
+	if err != nil {
+		mux.makeErrorJsonResponse(err, resp)
+		return
+	}
+	err = mux.app.FinishTask(req.Context(), req.PathValue("id"), version)
+	if err != nil {
+		mux.makeErrorJsonResponse(err, resp)
+		return
+	}
+	resp.WriteHeader(http.StatusNoContent)
+}
+
+func (mux Mux) readJson(req *http.Request, v any) error {
+	data, err := io.ReadAll(req.Body)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func (mux Mux) writeJson(status int, v any, resp http.ResponseWriter) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		mux.makeErrorJsonResponse(err, resp)
+		return
+	}
+
+	resp.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	resp.WriteHeader(status)
+	if _, err := resp.Write(data); err != nil {
+		log.Printf("Mux.writeJson: %v", err)
+	}
+}
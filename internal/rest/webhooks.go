@@ -0,0 +1,115 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"go_final_project/internal/app"
+)
+
+// Хэндлер обращений к `/api/webhooks`
+func (mux Mux) WebhooksHandler(resp http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		mux.WebhooksGetHandler(resp, req)
+
+	case http.MethodPost:
+		mux.WebhooksPostHandler(resp, req)
+
+	case http.MethodDelete:
+		mux.WebhooksDeleteHandler(resp, req)
+
+	default:
+		mux.makeCodeErrorJsonResponse(codeMethodNotAllowed, "WebhooksHandler: invalid request", resp)
+	}
+}
+
+// Хэндлер GET обращений к `/api/webhooks`, возвращает список получателей без секретов
+func (mux Mux) WebhooksGetHandler(resp http.ResponseWriter, req *http.Request) {
+	hooks, err := mux.webhooks.List(req.Context())
+	if err != nil {
+		mux.makeErrorJsonResponse(err, resp)
+		return
+	}
+
+	hooksBytes, err := json.Marshal(map[string]any{"webhooks": hooks})
+	if err != nil {
+		mux.makeErrorJsonResponse(err, resp)
+		return
+	}
+	mux.makeJsonResponse(string(hooksBytes), resp)
+}
+
+// Хэндлер POST обращений к `/api/webhooks`, создает получателя и единственный раз возвращает секрет подписи
+func (mux Mux) WebhooksPostHandler(resp http.ResponseWriter, req *http.Request) {
+	var buf bytes.Buffer
+
+	_, err := buf.ReadFrom(req.Body)
+	if err != nil {
+		mux.makeCodeErrorJsonResponse(codeBadRequest, err.Error(), resp)
+		return
+	}
+
+	hookStruct := struct {
+		URL    string   `json:"url"`
+		Events []string `json:"events"`
+	}{}
+	err = json.Unmarshal(buf.Bytes(), &hookStruct)
+	if err != nil {
+		mux.makeCodeErrorJsonResponse(codeBadRequest, err.Error(), resp)
+		return
+	}
+
+	hook, err := mux.webhooks.Create(req.Context(), hookStruct.URL, hookStruct.Events)
+	if err != nil {
+		mux.makeErrorJsonResponse(fmt.Errorf("Mux.WebhooksPostHandler: %w", err), resp)
+		return
+	}
+
+	hookBytes, err := json.Marshal(hook)
+	if err != nil {
+		mux.makeErrorJsonResponse(err, resp)
+		return
+	}
+	mux.makeJsonResponse(string(hookBytes), resp)
+}
+
+// Хэндлер DELETE обращений к `/api/webhooks`, удаляет получателя по id вместе с его доставками
+func (mux Mux) WebhooksDeleteHandler(resp http.ResponseWriter, req *http.Request) {
+	err := mux.webhooks.Remove(req.Context(), req.URL.Query().Get("id"))
+	if err != nil {
+		mux.makeErrorJsonResponse(err, resp)
+		return
+	}
+	mux.makeEmptyJsonResponse(resp)
+}
+
+// Хэндлер GET обращений к `/api/webhooks/deliveries[?webhook_id=][&status=][&limit=]`, журнал доставок от новых к старым
+func (mux Mux) WebhookDeliveriesHandler(resp http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	limit := int(mux.cfg.TaskListLimit())
+	if value := query.Get("limit"); len(value) > 0 {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			mux.makeErrorJsonResponse(app.ValidationError("limit", "limit must be a positive integer"), resp)
+			return
+		}
+		limit = n
+	}
+
+	deliveries, err := mux.webhooks.Deliveries(req.Context(), query.Get("webhook_id"), query.Get("status"), limit)
+	if err != nil {
+		mux.makeErrorJsonResponse(err, resp)
+		return
+	}
+
+	deliveriesBytes, err := json.Marshal(map[string]any{"deliveries": deliveries})
+	if err != nil {
+		mux.makeErrorJsonResponse(err, resp)
+		return
+	}
+	mux.makeJsonResponse(string(deliveriesBytes), resp)
+}
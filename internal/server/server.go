@@ -0,0 +1,139 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+
+	"go_final_project/internal/config"
+)
+
+// HTTP-сервер сервиса вместе с фоновыми задачами и ресурсами, которые нужно освободить при остановке
+type Server struct {
+	cfg     *config.Handler
+	http    *http.Server
+	workers []func(ctx context.Context)
+	closers []io.Closer
+}
+
+func New(cfg *config.Handler, handler http.Handler) *Server {
+	return &Server{
+		cfg: cfg,
+		http: &http.Server{
+			Addr:              ":" + cfg.Port(),
+			Handler:           handler,
+			ReadTimeout:       cfg.ReadTimeout(),
+			ReadHeaderTimeout: cfg.ReadTimeout(),
+			WriteTimeout:      cfg.WriteTimeout(),
+			IdleTimeout:       cfg.IdleTimeout(),
+		},
+	}
+}
+
+// Добавляет фоновую задачу, которая запускается вместе с сервером и должна завершиться после отмены ctx
+func (s *Server) Worker(worker func(ctx context.Context)) {
+	s.workers = append(s.workers, worker)
+}
+
+// Добавляет ресурс, который закрывается при остановке после завершения запросов и фоновых задач
+func (s *Server) Closer(closer io.Closer) {
+	s.closers = append(s.closers, closer)
+}
+
+// Слушает порт из настроек и обслуживает запросы до отмены ctx, после чего останавливает сервер
+func (s *Server) Run(ctx context.Context) error {
+	ln, err := net.Listen("tcp", s.http.Addr)
+	if err != nil {
+		s.close()
+		return fmt.Errorf("Server.Run: %v", err)
+	}
+	return s.Serve(ctx, ln)
+}
+
+// Обслуживает запросы из ln до отмены ctx, с включенным TLS - по HTTPS. При остановке дожидается начатых запросов и фоновых задач
+// и закрывает ресурсы, но не дольше ShutdownTimeout из настроек
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	if s.cfg.TLSEnabled() {
+		tlsCfg, err := tlsConfig(s.cfg)
+		if err != nil {
+			ln.Close()
+			s.close()
+			return fmt.Errorf("Server.Serve: %v", err)
+		}
+		ln = newSniffListener(ln, tlsCfg, s.cfg.ReadTimeout())
+		s.http.Handler = redirectPlain(s.http.Handler)
+	}
+
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+
+	var workers sync.WaitGroup
+	for _, worker := range s.workers {
+		workers.Add(1)
+		go func(worker func(ctx context.Context)) {
+			defer workers.Done()
+			worker(workersCtx)
+		}(worker)
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- s.http.Serve(ln)
+	}()
+	log.Printf("Server is running on %s\n", ln.Addr())
+
+	var err error
+	select {
+	case err = <-serveErr:
+		err = fmt.Errorf("Server.Serve: %v", err)
+	case <-ctx.Done():
+		log.Println("Shutting down server")
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.cfg.ShutdownTimeout())
+	defer cancel()
+
+	if shutdownErr := s.http.Shutdown(shutdownCtx); shutdownErr != nil {
+		log.Printf("Server.Serve: requests were not finished in time: %v", shutdownErr)
+		s.http.Close()
+	}
+
+	stopWorkers()
+	done := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-shutdownCtx.Done():
+		log.Println("Server.Serve: background workers were not finished in time")
+	}
+
+	if closeErr := s.close(); closeErr != nil && err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		log.Println("Server stopped")
+	}
+	return err
+}
+
+// Закрывает ресурсы в порядке, обратном добавлению
+func (s *Server) close() error {
+	var errs []error
+	for i := len(s.closers) - 1; i >= 0; i-- {
+		if err := s.closers[i].Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("Server.close: %v", err)
+	}
+	return nil
+}
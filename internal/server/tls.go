@@ -0,0 +1,213 @@
+package server
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go_final_project/internal/config"
+)
+
+const (
+	selfSignedCertFile = "selfsigned.crt"
+	selfSignedKeyFile  = "selfsigned.key"
+	selfSignedTTL      = 365 * 24 * time.Hour
+	selfSignedRenew    = 7 * 24 * time.Hour // сертификат создается заново, если до окончания срока осталось меньше
+
+	tlsRecordHandshake = 0x16 // первый байт TLS-соединения
+)
+
+// Загружает сертификат из настроек или, в режиме разработки, самоподписанный сертификат
+func tlsConfig(cfg *config.Handler) (*tls.Config, error) {
+	var cert tls.Certificate
+	var err error
+	if len(cfg.TLSCert()) > 0 && len(cfg.TLSKey()) > 0 {
+		cert, err = tls.LoadX509KeyPair(cfg.TLSCert(), cfg.TLSKey())
+	} else {
+		cert, err = selfSignedCertificate(cfg.TLSCacheDir())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("tlsConfig: %v", err)
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+		NextProtos:   []string{"h2", "http/1.1"},
+	}, nil
+}
+
+// Возвращает самоподписанный сертификат из каталога dir, при отсутствии или скором окончании срока создает новый
+func selfSignedCertificate(dir string) (tls.Certificate, error) {
+	certPath := filepath.Join(dir, selfSignedCertFile)
+	keyPath := filepath.Join(dir, selfSignedKeyFile)
+
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err == nil {
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err == nil && time.Until(leaf.NotAfter) > selfSignedRenew {
+			return cert, nil
+		}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"TODO app development"}, CommonName: "localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(selfSignedTTL),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	if hostname, err := os.Hostname(); err == nil && hostname != "localhost" {
+		template.DNSNames = append(template.DNSNames, hostname)
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err := os.WriteFile(keyPath, keyPEM, 0600); err != nil {
+		return tls.Certificate{}, err
+	}
+	if err := os.WriteFile(certPath, certPEM, 0644); err != nil {
+		return tls.Certificate{}, err
+	}
+	log.Printf("Generated self-signed certificate %s", certPath)
+
+	return tls.X509KeyPair(certPEM, keyPEM)
+}
+
+// Принимает на одном порту и TLS, и обычные соединения: по первому байту определяет,
+// начинается ли соединение с TLS-рукопожатия. Обычные соединения передаются серверу как есть,
+// и redirectPlain отвечает на их запросы перенаправлением на HTTPS
+type sniffListener struct {
+	net.Listener
+	tls     *tls.Config
+	timeout time.Duration // сколько ждать первого байта от клиента
+
+	conns chan net.Conn
+	errs  chan error
+	once  sync.Once
+	done  chan struct{}
+}
+
+func newSniffListener(ln net.Listener, cfg *tls.Config, timeout time.Duration) *sniffListener {
+	l := &sniffListener{
+		Listener: ln,
+		tls:      cfg,
+		timeout:  timeout,
+		conns:    make(chan net.Conn),
+		errs:     make(chan error, 1),
+		done:     make(chan struct{}),
+	}
+	go l.acceptLoop()
+	return l
+}
+
+func (l *sniffListener) acceptLoop() {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				continue
+			}
+			l.errs <- err
+			return
+		}
+		// Первый байт читается отдельно для каждого соединения, чтобы медленный клиент не задерживал остальных
+		go l.sniff(conn)
+	}
+}
+
+func (l *sniffListener) sniff(conn net.Conn) {
+	conn.SetReadDeadline(time.Now().Add(l.timeout))
+	reader := bufio.NewReader(conn)
+	first, err := reader.Peek(1)
+	conn.SetReadDeadline(time.Time{})
+	if err != nil {
+		conn.Close()
+		return
+	}
+
+	var result net.Conn = &peekedConn{Conn: conn, reader: reader}
+	if first[0] == tlsRecordHandshake {
+		result = tls.Server(result, l.tls)
+	}
+
+	select {
+	case l.conns <- result:
+	case <-l.done:
+		conn.Close()
+	}
+}
+
+func (l *sniffListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case err := <-l.errs:
+		return nil, err
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *sniffListener) Close() error {
+	l.once.Do(func() { close(l.done) })
+	return l.Listener.Close()
+}
+
+// Соединение, из которого уже прочитаны байты для определения протокола
+type peekedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *peekedConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
+
+// Перенаправляет запросы, пришедшие без TLS, на тот же адрес по HTTPS
+func redirectPlain(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil {
+			http.Redirect(w, r, "https://"+r.Host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,76 @@
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"go_final_project/internal/app"
+	"go_final_project/internal/config"
+	"go_final_project/internal/db"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdmin(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("TODO_DBPATH", filepath.Join(dir, "scheduler.db"))
+	cfg, _, err := config.Load(nil)
+	require.NoError(t, err)
+	database := db.New(cfg)
+	require.NoError(t, database.Create())
+	require.NoError(t, database.Open())
+	t.Cleanup(func() { database.Close() })
+	application := app.CreateApplication(database, cfg)
+	ctx := context.Background()
+
+	task, err := application.AddTask(ctx, app.Task{Title: "Полить цветы", Repeat: "d 3"})
+	require.NoError(t, err)
+	invalid, err := application.CheckTasks(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, invalid)
+
+	// Копия снимается с открытой базы и восстанавливает ее прежнее содержимое
+	backup := filepath.Join(dir, "backup.db")
+	require.NoError(t, database.Backup(ctx, backup))
+	_, err = application.AddTask(ctx, app.Task{Title: "Купить хлеб"})
+	require.NoError(t, err)
+	require.NoError(t, database.Restore(ctx, backup))
+	tasks, err := application.GetTaskList(ctx, app.AllLists, "", 50)
+	require.NoError(t, err)
+	require.Len(t, tasks, 1)
+	assert.Equal(t, "Полить цветы", tasks[0].Title)
+
+	assert.Error(t, database.Restore(ctx, filepath.Join(dir, "missing.db")))
+
+	// Задачи, записанные в базу в обход проверок, находятся проверкой
+	raw, err := sql.Open("sqlite3", cfg.DBPath())
+	require.NoError(t, err)
+	defer raw.Close()
+	_, err = raw.Exec(`INSERT INTO scheduler (date, title, repeat) VALUES
+		('2024011', 'Неверная дата', ''),
+		('20240110', 'Неверное правило', 'q 1'),
+		('20240110', '', '')`)
+	require.NoError(t, err)
+
+	invalid, err = application.CheckTasks(ctx)
+	require.NoError(t, err)
+	require.Len(t, invalid, 3)
+	fields := make(map[string]bool)
+	for _, bad := range invalid {
+		assert.NotEqual(t, task.ID, bad.Task.ID)
+		var appErr *app.Error
+		require.ErrorAs(t, bad.Err, &appErr)
+		for field := range appErr.Fields {
+			fields[field] = true
+		}
+	}
+	assert.Equal(t, map[string]bool{"date": true, "repeat": true, "title": true}, fields)
+
+	require.NoError(t, database.Vacuum(ctx))
+	problems, err := database.IntegrityCheck(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, problems)
+}
@@ -0,0 +1,102 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go_final_project/internal/app"
+	"go_final_project/internal/backup"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func backupStatus(t *testing.T, srv *localServer) backup.Status {
+	resp, err := http.Get(srv.URL + "/api/backup/status")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var status backup.Status
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&status))
+	return status
+}
+
+func TestBackupScheduler(t *testing.T) {
+	t.Setenv("TODO_PASSWORD", "")
+	t.Setenv("TODO_OIDC_ISSUER", "")
+	t.Setenv("TODO_BACKUP_DIR", "")
+	t.Setenv("TODO_CONFIG_POLL_INTERVAL", "10ms")
+	srv := newLocalServer(t)
+	ctx := context.Background()
+
+	assert.Equal(t, backup.Status{}, backupStatus(t, srv), "без каталога копии отключены")
+
+	dir := filepath.Join(t.TempDir(), "backups")
+	t.Setenv("TODO_BACKUP_DIR", dir)
+	t.Setenv("TODO_BACKUP_INTERVAL", "1h")
+	t.Setenv("TODO_BACKUP_KEEP", "2")
+	t.Setenv("TODO_BACKUP_GZIP", "true")
+	require.NoError(t, srv.cfg.Reload())
+
+	_, err := app.CreateApplication(srv.db, srv.cfg).AddTask(ctx, app.Task{Title: "Полить цветы"})
+	require.NoError(t, err)
+
+	// Первая копия сохраняется сразу после включения, следующая - через интервал
+	runCtx, stop := context.WithCancel(ctx)
+	stopped := make(chan struct{})
+	go func() {
+		srv.backups.Run(runCtx)
+		close(stopped)
+	}()
+	require.Eventually(t, func() bool { return len(backupStatus(t, srv).LastBackup) > 0 }, 5*time.Second, 10*time.Millisecond)
+	stop()
+	<-stopped
+
+	status := backupStatus(t, srv)
+	assert.True(t, status.Enabled)
+	assert.Empty(t, status.LastError)
+	assert.True(t, strings.HasSuffix(status.LastFile, ".db.gz"), status.LastFile)
+	last, err := time.Parse(time.RFC3339, status.LastBackup)
+	require.NoError(t, err)
+	next, err := time.Parse(time.RFC3339, status.NextBackup)
+	require.NoError(t, err)
+	assert.WithinDuration(t, last.Add(time.Hour), next, time.Second)
+
+	// Сжатая копия восстанавливается той же командой, что и обычная
+	application := app.CreateApplication(srv.db, srv.cfg)
+	_, err = application.AddTask(ctx, app.Task{Title: "Купить хлеб"})
+	require.NoError(t, err)
+	require.NoError(t, srv.db.Restore(ctx, status.LastFile))
+	tasks, err := application.GetTaskList(ctx, app.AllLists, "", 50)
+	require.NoError(t, err)
+	require.Len(t, tasks, 1)
+	assert.Equal(t, "Полить цветы", tasks[0].Title)
+
+	damaged := filepath.Join(t.TempDir(), "damaged.db.gz")
+	require.NoError(t, os.WriteFile(damaged, []byte("SQLite format 3"), 0644))
+	assert.ErrorContains(t, srv.db.Restore(ctx, damaged), "damaged.db.gz")
+
+	// Хранятся только последние BackupKeep копий, посторонние файлы в каталоге не трогаются
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), nil, 0644))
+	for _, stamp := range []string{"20200101-000000", "20200102-000000"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "scheduler-"+stamp+".db"), nil, 0644))
+	}
+	t.Setenv("TODO_BACKUP_GZIP", "false")
+	require.NoError(t, srv.cfg.Reload())
+	path, err := srv.backups.Backup(ctx)
+	require.NoError(t, err)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	assert.ElementsMatch(t, []string{"notes.txt", filepath.Base(status.LastFile), filepath.Base(path)}, names)
+}
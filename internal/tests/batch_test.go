@@ -0,0 +1,150 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"go_final_project/internal/app"
+	"go_final_project/internal/authorization"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type batchResponse struct {
+	Committed bool `json:"committed"`
+	Results   []struct {
+		Op    string `json:"op"`
+		ID    string `json:"id"`
+		Error *struct {
+			Error string `json:"error"`
+			Code  string `json:"code"`
+		} `json:"error"`
+	} `json:"results"`
+}
+
+func postBatch(t *testing.T, srv *localServer, token string, body map[string]any) (int, batchResponse) {
+	data, err := json.Marshal(body)
+	require.NoError(t, err)
+	req, err := http.NewRequest(http.MethodPost, srv.URL+"/api/tasks/batch", bytes.NewBuffer(data))
+	require.NoError(t, err)
+	if len(token) > 0 {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	var batch batchResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&batch))
+	return resp.StatusCode, batch
+}
+
+func TestBatch(t *testing.T) {
+	t.Setenv("TODO_PASSWORD", "")
+	t.Setenv("TODO_OIDC_ISSUER", "")
+	srv := newLocalServer(t)
+
+	today := time.Now().Format(`20060102`)
+	newTask := func(repeat string) string {
+		id, err := srv.db.AddTask(context.Background(), app.Task{Date: today, Title: "Задача", Repeat: repeat})
+		require.NoError(t, err)
+		return fmt.Sprint(id)
+	}
+	exists := func(id string) bool {
+		_, err := srv.db.GetTaskByID(context.Background(), id)
+		return err == nil
+	}
+
+	once, daily, removed := newTask(""), newTask("d 1"), newTask("")
+
+	// Без atomic неудачные операции пропускаются, остальные сохраняются
+	status, batch := postBatch(t, srv, "", map[string]any{"operations": []map[string]any{
+		{"op": "create", "task": map[string]any{"title": "Новая задача"}},
+		{"op": "complete", "id": once},
+		{"op": "complete", "id": daily},
+		{"op": "delete", "id": removed},
+		{"op": "complete", "id": "999999"},
+		{"op": "update", "id": daily, "task": map[string]any{"title": ""}},
+		{"op": "rename", "id": daily},
+	}})
+	require.Equal(t, http.StatusOK, status)
+	assert.True(t, batch.Committed)
+	require.Len(t, batch.Results, 7)
+	for i, code := range []string{"", "", "", "", "not_found", "validation_error", "validation_error"} {
+		if len(code) == 0 {
+			assert.Nil(t, batch.Results[i].Error, "операция %d", i)
+		} else if assert.NotNil(t, batch.Results[i].Error, "операция %d", i) {
+			assert.Equal(t, code, batch.Results[i].Error.Code, "операция %d", i)
+		}
+	}
+	assert.True(t, exists(batch.Results[0].ID))
+	assert.False(t, exists(once))
+	assert.True(t, exists(daily))
+	assert.False(t, exists(removed))
+
+	task, err := srv.db.GetTaskByID(context.Background(), daily)
+	require.NoError(t, err)
+	assert.Greater(t, task.Date, today, "повторяющаяся задача должна быть перенесена")
+
+	// С atomic первая неудачная операция отменяет весь пакет
+	kept := newTask("")
+	status, batch = postBatch(t, srv, "", map[string]any{"atomic": true, "operations": []map[string]any{
+		{"op": "create", "task": map[string]any{"title": "Отмененная задача"}},
+		{"op": "delete", "id": kept},
+		{"op": "complete", "id": "999999"},
+		{"op": "delete", "id": daily},
+	}})
+	require.Equal(t, http.StatusOK, status)
+	assert.False(t, batch.Committed)
+	require.Len(t, batch.Results, 3, "после неудачной операции пакет не продолжается")
+	assert.False(t, exists(batch.Results[0].ID))
+	assert.True(t, exists(kept))
+	assert.True(t, exists(daily))
+
+	// Версия работает так же, как If-Match
+	status, batch = postBatch(t, srv, "", map[string]any{"atomic": true, "operations": []map[string]any{
+		{"op": "delete", "id": kept, "version": 5},
+	}})
+	require.Equal(t, http.StatusOK, status)
+	assert.False(t, batch.Committed)
+	assert.Equal(t, "precondition_failed", batch.Results[0].Error.Code)
+
+	status, _ = postBatch(t, srv, "", map[string]any{"operations": []map[string]any{}})
+	assert.Equal(t, http.StatusBadRequest, status)
+}
+
+func TestBatchRoles(t *testing.T) {
+	t.Setenv("TODO_PASSWORD", "123321")
+	t.Setenv("TODO_OIDC_ISSUER", "")
+	srv := newLocalServer(t)
+
+	require.NoError(t, srv.auth.SetRole(context.Background(), authorization.UserSubject("1"), authorization.AllLists, authorization.RoleEditor))
+	editor, err := srv.auth.CreateToken(authorization.UserSubject("1"))
+	require.NoError(t, err)
+	viewer, err := srv.auth.CreateToken(authorization.UserSubject("2"))
+	require.NoError(t, err)
+
+	id, err := srv.db.AddTask(context.Background(), app.Task{Date: time.Now().Format(`20060102`), Title: "Задача"})
+	require.NoError(t, err)
+	ops := map[string]any{"operations": []map[string]any{
+		{"op": "create", "task": map[string]any{"title": "Новая задача"}},
+		{"op": "delete", "id": fmt.Sprint(id)},
+	}}
+
+	status, _ := postBatch(t, srv, viewer, ops)
+	assert.Equal(t, http.StatusForbidden, status)
+
+	// Удаление доступно только владельцу, поэтому редактор не может выполнить и остальные операции пакета
+	status, _ = postBatch(t, srv, editor, ops)
+	assert.Equal(t, http.StatusForbidden, status)
+	tasks, err := srv.db.GetTaskList(context.Background(), app.AllLists, "", 10)
+	require.NoError(t, err)
+	assert.Len(t, tasks, 1)
+}
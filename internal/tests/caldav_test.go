@@ -0,0 +1,296 @@
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"go_final_project/internal/app"
+	"go_final_project/internal/authorization"
+	"go_final_project/internal/ical"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Ответ multistatus в том объеме, в котором его разбирают клиенты
+type davMultistatus struct {
+	Responses []struct {
+		Href     string `xml:"DAV: href"`
+		Status   string `xml:"DAV: status"`
+		Propstat []struct {
+			Prop struct {
+				ETag         string `xml:"DAV: getetag"`
+				CTag         string `xml:"http://calendarserver.org/ns/ getctag"`
+				CalendarData string `xml:"urn:ietf:params:xml:ns:caldav calendar-data"`
+				HomeSet      struct {
+					Href string `xml:"DAV: href"`
+				} `xml:"urn:ietf:params:xml:ns:caldav calendar-home-set"`
+				ResourceType struct {
+					Calendar *struct{} `xml:"urn:ietf:params:xml:ns:caldav calendar"`
+				} `xml:"DAV: resourcetype"`
+			} `xml:"DAV: prop"`
+			Status string `xml:"DAV: status"`
+		} `xml:"DAV: propstat"`
+	} `xml:"DAV: response"`
+}
+
+const vtodo = "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//test//EN\r\nBEGIN:VTODO\r\nUID:%UID%\r\n" +
+	"DTSTAMP:20240101T000000Z\r\nDUE;VALUE=DATE:%DATE%\r\nSUMMARY:%TITLE%\r\n%EXTRA%END:VTODO\r\nEND:VCALENDAR\r\n"
+
+func TestCalDAV(t *testing.T) {
+	t.Setenv("TODO_PASSWORD", "123321")
+	t.Setenv("TODO_OIDC_ISSUER", "")
+	srv := newLocalServer(t)
+	ctx := context.Background()
+
+	_, readKey, err := srv.auth.CreateAPIKey(ctx, "phone-read", authorization.ScopeRead)
+	require.NoError(t, err)
+	_, writeKey, err := srv.auth.CreateAPIKey(ctx, "phone", authorization.ScopeReadWrite)
+	require.NoError(t, err)
+
+	dav := func(password, method, path, body string, headers ...string) (*http.Response, string) {
+		req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		require.NoError(t, err)
+		if password != "" {
+			req.SetBasicAuth("phone", password)
+		}
+		for i := 0; i+1 < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp, string(data)
+	}
+	multistatus := func(password, method, path, body, depth string) davMultistatus {
+		resp, data := dav(password, method, path, body, "Depth", depth, "Content-Type", "application/xml")
+		require.Equal(t, http.StatusMultiStatus, resp.StatusCode, data)
+		var ms davMultistatus
+		require.NoError(t, xml.Unmarshal([]byte(data), &ms), data)
+		return ms
+	}
+	todo := func(uid, date, title, extra string) string {
+		return strings.NewReplacer("%UID%", uid, "%DATE%", date, "%TITLE%", title, "%EXTRA%", extra).Replace(vtodo)
+	}
+
+	// Клиент без пароля получает приглашение авторизоваться, неверный пароль не принимается
+	resp, _ := dav("", "PROPFIND", "/dav/", "", "Depth", "0")
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Contains(t, resp.Header.Get("WWW-Authenticate"), "Basic")
+	resp, _ = dav("wrong", "PROPFIND", "/dav/", "", "Depth", "0")
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	resp, _ = dav("", http.MethodGet, "/.well-known/caldav", "")
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, "после перенаправления на /dav/ нужен пароль")
+
+	// Поиск календаря: принципал, домашний каталог, календарь задач
+	ms := multistatus(writeKey, "PROPFIND", "/dav/", `<?xml version="1.0"?>
+		<d:propfind xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav"><d:prop>
+		<d:current-user-principal/><c:calendar-home-set/><d:unknown-property/></d:prop></d:propfind>`, "0")
+	require.Len(t, ms.Responses, 1)
+	require.Len(t, ms.Responses[0].Propstat, 2)
+	assert.Equal(t, "/dav/", ms.Responses[0].Propstat[0].Prop.HomeSet.Href)
+	assert.Contains(t, ms.Responses[0].Propstat[1].Status, "404")
+
+	ms = multistatus(writeKey, "PROPFIND", "/dav/", "", "1")
+	require.Len(t, ms.Responses, 2)
+	assert.Equal(t, "/dav/tasks/", ms.Responses[1].Href)
+	assert.NotNil(t, ms.Responses[1].Propstat[0].Prop.ResourceType.Calendar)
+	ctag := ms.Responses[1].Propstat[0].Prop.CTag
+	require.NotEmpty(t, ctag)
+
+	// Задача, созданная через api, видна под именем по ее id
+	today := time.Now().Format(`20060102`)
+	id, err := srv.db.AddTask(ctx, app.Task{Date: today, Title: "Полить цветы", Repeat: "d 3"})
+	require.NoError(t, err)
+	resp, data := dav(readKey, http.MethodGet, "/dav/tasks/"+strconv.FormatInt(id, 10)+".ics", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode, data)
+	assert.Equal(t, `"1"`, resp.Header.Get("ETag"))
+	assert.Contains(t, data, "RRULE:FREQ=DAILY;INTERVAL=3")
+
+	// Ключ только для чтения не может менять задачи
+	resp, _ = dav(readKey, http.MethodPut, "/dav/tasks/new.ics", todo("new@phone", today, "Новая", ""))
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	// Задача из приложения сохраняется под выбранным им именем и UID, RRULE переводится в правило повторения
+	weekday := time.Now().AddDate(0, 0, 1)
+	date := weekday.Format(`20060102`)
+	resp, data = dav(writeKey, http.MethodPut, "/dav/tasks/abc-123.ics",
+		todo("abc-123@phone", date, "Вынести мусор", "RRULE:FREQ=WEEKLY;BYDAY=MO,TH\r\n"), "If-None-Match", "*")
+	require.Equal(t, http.StatusCreated, resp.StatusCode, data)
+	tasks, err := srv.db.GetTaskList(ctx, app.AllLists, "мусор", 10)
+	require.NoError(t, err)
+	require.Len(t, tasks, 1)
+	assert.Equal(t, "w 1,4", tasks[0].Repeat)
+	created := tasks[0]
+
+	resp, _ = dav(writeKey, http.MethodPut, "/dav/tasks/abc-123.ics", todo("abc-123@phone", date, "Вынести мусор", ""), "If-None-Match", "*")
+	assert.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+	resp, _ = dav(writeKey, http.MethodPut, "/dav/tasks/other.ics", todo("abc-123@phone", date, "Копия", ""))
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	resp, _ = dav(writeKey, http.MethodPut, "/dav/tasks/bad.ics", todo("bad@phone", date, "", ""))
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// Изменения видны по CTag и ETag, а calendar-query возвращает записи с содержимым
+	ms = multistatus(writeKey, "PROPFIND", "/dav/tasks/", `<d:propfind xmlns:d="DAV:" xmlns:cs="http://calendarserver.org/ns/">
+		<d:prop><cs:getctag/><d:getetag/></d:prop></d:propfind>`, "1")
+	require.Len(t, ms.Responses, 3)
+	assert.NotEqual(t, ctag, ms.Responses[0].Propstat[0].Prop.CTag)
+	ctag = ms.Responses[0].Propstat[0].Prop.CTag
+
+	ms = multistatus(writeKey, "REPORT", "/dav/tasks/", `<c:calendar-query xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">
+		<d:prop><d:getetag/><c:calendar-data/></d:prop>
+		<c:filter><c:comp-filter name="VCALENDAR"><c:comp-filter name="VTODO"/></c:comp-filter></c:filter></c:calendar-query>`, "1")
+	require.Len(t, ms.Responses, 2)
+	etags := map[string]string{}
+	for _, r := range ms.Responses {
+		items, err := ical.Parse([]byte(r.Propstat[0].Prop.CalendarData))
+		require.NoError(t, err)
+		require.Len(t, items, 1)
+		etags[items[0].UID] = r.Propstat[0].Prop.ETag
+		if items[0].UID == "abc-123@phone" {
+			assert.Equal(t, "/dav/tasks/abc-123.ics", r.Href)
+			assert.Equal(t, "FREQ=WEEKLY;BYDAY=MO,TH", items[0].RRule)
+		}
+	}
+	require.Len(t, etags, 2)
+
+	ms = multistatus(writeKey, "REPORT", "/dav/tasks/", `<c:calendar-multiget xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">
+		<d:prop><d:getetag/></d:prop><d:href>/dav/tasks/abc-123.ics</d:href><d:href>/dav/tasks/missing.ics</d:href></c:calendar-multiget>`, "1")
+	require.Len(t, ms.Responses, 2)
+	assert.Equal(t, etags["abc-123@phone"], ms.Responses[0].Propstat[0].Prop.ETag)
+	assert.Contains(t, ms.Responses[1].Status, "404")
+
+	// Изменение с устаревшим ETag отклоняется, с текущим (в том числе не первым в списке) - сохраняется
+	resp, _ = dav(writeKey, http.MethodPut, "/dav/tasks/abc-123.ics", todo("abc-123@phone", date, "Вынести мусор вечером", ""), "If-Match", `"7"`)
+	assert.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+	resp, data = dav(writeKey, http.MethodPut, "/dav/tasks/abc-123.ics",
+		todo("abc-123@phone", date, "Вынести мусор вечером", "RRULE:FREQ=WEEKLY;BYDAY=MO,TH\r\nX-TODO-REPEAT:w 1,4\r\n"), "If-Match", `"7", `+etags["abc-123@phone"])
+	require.Equal(t, http.StatusNoContent, resp.StatusCode, data)
+	task, err := srv.db.GetTaskByID(ctx, created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Вынести мусор вечером", task.Title)
+	assert.Equal(t, "w 1,4", task.Repeat)
+
+	// Выполненная в приложении повторяющаяся задача переносится на следующую дату
+	resp, _ = dav(writeKey, http.MethodPut, "/dav/tasks/abc-123.ics", todo("abc-123@phone", date, "Вынести мусор вечером", "STATUS:COMPLETED\r\n"))
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+	next, err := app.NextDate(time.Now(), task.Date, task.Repeat)
+	require.NoError(t, err)
+	task, err = srv.db.GetTaskByID(ctx, created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, next, task.Date)
+
+	// Удалять задачи, как и в api, может только владелец, ключ read-write удаляет их так же, как через api
+	resp, _ = dav(readKey, http.MethodDelete, "/dav/tasks/abc-123.ics", "")
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp, _ = dav(writeKey, http.MethodDelete, "/dav/tasks/abc-123.ics", "")
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	resp, _ = dav("123321", http.MethodGet, "/dav/tasks/abc-123.ics", "")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	ms = multistatus(readKey, "PROPFIND", "/dav/tasks/", "", "0")
+	assert.NotEqual(t, ctag, ms.Responses[0].Propstat[0].Prop.CTag)
+}
+
+func TestCalDAVPutTx(t *testing.T) {
+	t.Setenv("TODO_PASSWORD", "")
+	t.Setenv("TODO_OIDC_ISSUER", "")
+	srv := newLocalServer(t)
+	ctx := context.Background()
+	_, err := srv.webhooks.Create(ctx, "https://example.com/hook", nil)
+	require.NoError(t, err)
+
+	// Имя занято записью задачи из другого списка: календарь ее не показывает, но сохранить запись под этим именем нельзя
+	application := app.CreateApplication(srv.db, srv.cfg)
+	work, err := application.AddTask(ctx, app.Task{Title: "Рабочая", List: "work"})
+	require.NoError(t, err)
+	raw, err := sql.Open("sqlite3", srv.cfg.DBPath())
+	require.NoError(t, err)
+	defer raw.Close()
+	_, err = raw.Exec(`INSERT INTO dav_objects (id, name, uid) VALUES (?, 'work.ics', 'work@phone')`, work.ID)
+	require.NoError(t, err)
+	outbox := func() int {
+		var count int
+		require.NoError(t, raw.QueryRow(`SELECT count(*) FROM webhook_outbox`).Scan(&count))
+		return count
+	}
+	require.Equal(t, 1, outbox())
+
+	put := func(name, uid string) int {
+		body := strings.NewReplacer("%UID%", uid, "%DATE%", "20240101", "%TITLE%", "Из телефона", "%EXTRA%", "").Replace(vtodo)
+		req, err := http.NewRequest(http.MethodPut, srv.URL+"/dav/tasks/"+name, strings.NewReader(body))
+		require.NoError(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	resp, err := http.Get(srv.URL + "/dav/tasks/work.ics")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// Задача создается вместе с записью: при ошибке не остается ни задачи, ни событий для вебхуков
+	assert.Equal(t, http.StatusConflict, put("work.ics", "new@phone"))
+	tasks, err := application.AllTasks(ctx, app.AllLists)
+	require.NoError(t, err)
+	assert.Len(t, tasks, 1)
+	assert.Equal(t, 1, outbox())
+
+	assert.Equal(t, http.StatusCreated, put("new.ics", "new@phone"))
+	assert.Equal(t, 2, outbox())
+
+	// UID занят записью с другим именем, в том числе назначенным сервером
+	assert.Equal(t, http.StatusConflict, put("other.ics", "new@phone"))
+	server, err := application.AddTask(ctx, app.Task{Title: "С сервера"})
+	require.NoError(t, err)
+	serverID := server.ID
+	assert.Equal(t, http.StatusConflict, put("server.ics", "task-"+serverID+"@go_final_project"))
+	assert.Equal(t, http.StatusNoContent, put(serverID+".ics", "task-"+serverID+"@go_final_project"))
+	resp, err = http.Get(srv.URL + "/dav/tasks/0" + serverID + ".ics")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestCalDAVKeyScope(t *testing.T) {
+	t.Setenv("TODO_PASSWORD", "123321")
+	t.Setenv("TODO_OIDC_ISSUER", "")
+	srv := newLocalServer(t)
+	_, readKey, err := srv.auth.CreateAPIKey(context.Background(), "read", authorization.ScopeRead)
+	require.NoError(t, err)
+
+	call := func(method, path string, basic bool) int {
+		req, err := http.NewRequest(method, srv.URL+path, nil)
+		require.NoError(t, err)
+		if basic {
+			req.SetBasicAuth("phone", readKey)
+		} else {
+			req.Header.Set("Authorization", "Bearer "+readKey)
+		}
+		req.Header.Set("Depth", "0")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// Запросы чтения CalDAV доступны ключу read только в CalDAV
+	assert.Equal(t, http.StatusOK, call(http.MethodOptions, "/dav/", true))
+	assert.Equal(t, http.StatusMultiStatus, call("PROPFIND", "/dav/", true))
+	assert.Equal(t, http.StatusMultiStatus, call("PROPFIND", "/dav/", false))
+	assert.Equal(t, http.StatusOK, call(http.MethodGet, "/api/tasks", false))
+	for _, method := range []string{http.MethodOptions, "PROPFIND", "REPORT", http.MethodPost} {
+		assert.Equal(t, http.StatusForbidden, call(method, "/api/tasks", false), method)
+	}
+}
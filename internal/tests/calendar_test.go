@@ -0,0 +1,103 @@
+package tests
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"go_final_project/internal/app"
+	"go_final_project/internal/authorization"
+	"go_final_project/internal/ical"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCalendarFeed(t *testing.T) {
+	t.Setenv("TODO_PASSWORD", "123321")
+	t.Setenv("TODO_OIDC_ISSUER", "")
+	t.Setenv("TODO_CALENDAR_DAYS", "30")
+	srv := newLocalServer(t)
+	ctx := context.Background()
+
+	_, readKey, err := srv.auth.CreateAPIKey(ctx, "calendar", authorization.ScopeRead)
+	require.NoError(t, err)
+	_, writeKey, err := srv.auth.CreateAPIKey(ctx, "client", authorization.ScopeReadWrite)
+	require.NoError(t, err)
+
+	now := time.Now()
+	today := now.Format(`20060102`)
+	weekly, err := srv.db.AddTask(ctx, app.Task{Date: today, Title: "Уборка", Repeat: "d 7"})
+	require.NoError(t, err)
+	// Просроченная задача показывается на свою дату и на ближайшие даты по правилу
+	overdue := now.AddDate(0, 0, -10).Format(`20060102`)
+	_, err = srv.db.AddTask(ctx, app.Task{Date: overdue, Title: "Зарядка", Repeat: "d 1"})
+	require.NoError(t, err)
+
+	get := func(key, etag string) (*http.Response, string) {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+"/api/calendar.ics?key="+url.QueryEscape(key), nil)
+		require.NoError(t, err)
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp, string(body)
+	}
+
+	resp, _ := get("", "")
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	resp, _ = get(writeKey, "")
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	resp, body := get(readKey, "")
+	require.Equal(t, http.StatusOK, resp.StatusCode, body)
+	assert.True(t, strings.HasPrefix(resp.Header.Get("Content-Type"), "text/calendar"))
+	etag := resp.Header.Get("ETag")
+	require.NotEmpty(t, etag)
+
+	items, err := ical.Parse([]byte(body))
+	require.NoError(t, err)
+	dates := map[string][]string{}
+	for _, item := range items {
+		assert.Empty(t, item.RRule)
+		dates[item.Summary] = append(dates[item.Summary], item.Date)
+	}
+
+	// Даты повторяющейся задачи совпадают с датами, которые получаются при ее выполнении
+	var expected []string
+	last := now.AddDate(0, 0, 30).Format(`20060102`)
+	for date := today; date <= last; {
+		expected = append(expected, date)
+		current, err := time.Parse(`20060102`, date)
+		require.NoError(t, err)
+		date, err = app.NextDate(current, date, "d 7")
+		require.NoError(t, err)
+	}
+	assert.Equal(t, expected, dates["Уборка"])
+	require.Len(t, dates["Зарядка"], 32)
+	assert.Equal(t, overdue, dates["Зарядка"][0])
+	assert.Equal(t, today, dates["Зарядка"][1])
+
+	// Неизменившийся календарь повторно не передается
+	resp, body = get(readKey, `W/"other", `+etag)
+	assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+	assert.Empty(t, body)
+
+	task, err := srv.db.GetTaskByID(ctx, strconv.FormatInt(weekly, 10))
+	require.NoError(t, err)
+	task.Title = "Генеральная уборка"
+	require.NoError(t, srv.db.UpdateTask(ctx, task))
+	resp, body = get(readKey, etag)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NotEqual(t, etag, resp.Header.Get("ETag"))
+	assert.Contains(t, body, "Генеральная уборка")
+}
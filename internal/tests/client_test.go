@@ -0,0 +1,70 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go_final_project/internal/app"
+	"go_final_project/internal/client"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient(t *testing.T) {
+	t.Setenv("TODO_PASSWORD", "123321")
+	t.Setenv("TODO_OIDC_ISSUER", "")
+	srv := newLocalServer(t)
+	ctx := context.Background()
+
+	// Без токена api недоступно, ошибка приходит с кодом из ответа
+	_, err := client.New(srv.URL, "", nil).GetTaskList(ctx, "")
+	assert.ErrorIs(t, err, app.ErrUnauthorized)
+
+	_, err = client.New(srv.URL, "", nil).Signin(ctx, "wrong")
+	assert.ErrorIs(t, err, app.ErrUnauthorized)
+	token, err := client.New(srv.URL, "", nil).Signin(ctx, "123321")
+	require.NoError(t, err)
+	c := client.New(srv.URL+"/", token, nil)
+
+	future := time.Now().AddDate(0, 0, 10).Format(`20060102`)
+	task, err := c.AddTask(ctx, app.Task{Date: future, Title: "Сходить к врачу", Comment: "к 10:00", Repeat: "d 7"})
+	require.NoError(t, err)
+	assert.NotEmpty(t, task.ID)
+	assert.Equal(t, future, task.Date)
+
+	other, err := c.AddTask(ctx, app.Task{Title: "Купить хлеб"})
+	require.NoError(t, err)
+
+	_, err = c.AddTask(ctx, app.Task{Title: "Задача", Repeat: "x"})
+	assert.ErrorIs(t, err, app.ErrValidation)
+
+	tasks, err := c.GetTaskList(ctx, "")
+	require.NoError(t, err)
+	assert.Len(t, tasks, 2)
+	tasks, err = c.GetTaskList(ctx, "врач")
+	require.NoError(t, err)
+	require.Len(t, tasks, 1)
+	assert.Equal(t, task, tasks[0])
+
+	// Изменяются только переданные поля
+	patched, err := c.PatchTask(ctx, task.ID, map[string]any{"title": "Сходить к стоматологу", "comment": ""})
+	require.NoError(t, err)
+	assert.Equal(t, "Сходить к стоматологу", patched.Title)
+	assert.Empty(t, patched.Comment)
+	assert.Equal(t, task.Repeat, patched.Repeat)
+
+	// Повторяющаяся задача переносится, остальные удаляются
+	require.NoError(t, c.FinishTask(ctx, task.ID))
+	got, err := c.GetTask(ctx, task.ID)
+	require.NoError(t, err)
+	assert.Equal(t, time.Now().AddDate(0, 0, 17).Format(`20060102`), got.Date)
+
+	require.NoError(t, c.FinishTask(ctx, other.ID))
+	_, err = c.GetTask(ctx, other.ID)
+	assert.ErrorIs(t, err, app.ErrNotFound)
+
+	require.NoError(t, c.RemoveTask(ctx, task.ID))
+	assert.ErrorIs(t, c.RemoveTask(ctx, task.ID), app.ErrNotFound)
+}
@@ -0,0 +1,177 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go_final_project/internal/app"
+	"go_final_project/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "todo.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+port: 8000
+webdir: `+dir+`
+dbpath: `+filepath.Join(dir, "scheduler.db")+`
+list_limit: 20
+read_timeout: 5s
+oidc:
+  issuer: https://idp.example.com
+signin:
+  free_attempts: 5
+`), 0644))
+
+	t.Setenv("TODO_CONFIG", path)
+	t.Setenv("TODO_PORT", "8001")
+	t.Setenv("TODO_LIST_LIMIT", "30")
+	for _, name := range []string{"TODO_DBPATH", "TODO_WEBDIR", "TODO_READ_TIMEOUT", "TODO_OIDC_ISSUER", "TODO_SIGNIN_FREE_ATTEMPTS", "TODO_BATCH_MAX_OPS"} {
+		t.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+
+	// Флаги важнее переменных окружения, переменные - файла, а файл - значений по умолчанию
+	cfg, _, err := config.Load([]string{"-port", "8002"})
+	require.NoError(t, err)
+	assert.Equal(t, "8002", cfg.Port())
+	assert.Equal(t, int64(30), cfg.TaskListLimit())
+	assert.Equal(t, 5*time.Second, cfg.ReadTimeout())
+	assert.Equal(t, "https://idp.example.com", cfg.OIDCIssuer())
+	assert.Equal(t, 5, cfg.SigninFreeAttempts())
+	assert.Equal(t, 100, cfg.BatchMaxOps())
+	assert.NoError(t, cfg.Validate())
+
+	cfg, _, err = config.Load([]string{"-config", path, "-tls-dev"})
+	require.NoError(t, err)
+	assert.Equal(t, "8001", cfg.Port())
+	assert.True(t, cfg.TLSDev())
+
+	// Опечатки в файле и флагах не проходят незамеченными
+	require.NoError(t, os.WriteFile(path, []byte("list_limt: 20\n"), 0644))
+	_, _, err = config.Load(nil)
+	assert.ErrorContains(t, err, "unknown setting list_limt")
+	_, _, err = config.Load([]string{"-list-limt", "20"})
+	assert.Error(t, err)
+
+	// Ошибочные значения сообщаются все сразу
+	t.Setenv("TODO_PORT", "70000")
+	require.NoError(t, os.WriteFile(path, []byte(`
+webdir: `+filepath.Join(dir, "missing")+`
+dbpath: `+filepath.Join(dir, "missing", "scheduler.db")+`
+read_timeout: soon
+search_date_format: "02.01"
+`), 0644))
+	cfg, _, err = config.Load([]string{"-list-limit", "0"})
+	require.NoError(t, err)
+	err = cfg.Validate()
+	require.Error(t, err)
+	for _, key := range []string{"port", "webdir", "dbpath", "read_timeout", "search_date_format", "list_limit"} {
+		assert.ErrorContains(t, err, key+":")
+	}
+	// До исправления используются значения по умолчанию
+	assert.Equal(t, 15*time.Second, cfg.ReadTimeout())
+	assert.Equal(t, int64(50), cfg.TaskListLimit())
+}
+
+func TestConfigListLimit(t *testing.T) {
+	t.Setenv("TODO_PASSWORD", "")
+	t.Setenv("TODO_OIDC_ISSUER", "")
+	t.Setenv("TODO_LIST_LIMIT", "2")
+	srv := newLocalServer(t)
+
+	today := time.Now().Format(`20060102`)
+	for i := 0; i < 3; i++ {
+		_, err := srv.db.AddTask(context.Background(), app.Task{Date: today, Title: "Задача"})
+		require.NoError(t, err)
+	}
+
+	resp, err := http.Get(srv.URL + "/api/tasks")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var list struct {
+		Tasks []map[string]string `json:"tasks"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&list))
+	assert.Len(t, list.Tasks, 2)
+}
+
+func TestConfigTOML(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "todo.toml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+port = 8000
+webdir = "`+dir+`"
+dbpath = "`+filepath.Join(dir, "scheduler.db")+`"
+list_limit = 20
+read_timeout = "5s"
+
+[oidc]
+issuer = "https://idp.example.com"
+
+[signin]
+free_attempts = 5
+
+[backup]
+gzip = true
+`), 0644))
+
+	t.Setenv("TODO_CONFIG", path)
+	for _, name := range []string{"TODO_PORT", "TODO_DBPATH", "TODO_WEBDIR", "TODO_LIST_LIMIT", "TODO_READ_TIMEOUT",
+		"TODO_OIDC_ISSUER", "TODO_SIGNIN_FREE_ATTEMPTS", "TODO_BACKUP_GZIP"} {
+		t.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+
+	// Разделы TOML соединяются с ключами так же, как вложенные разделы YAML
+	cfg, _, err := config.Load(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "8000", cfg.Port())
+	assert.Equal(t, int64(20), cfg.TaskListLimit())
+	assert.Equal(t, 5*time.Second, cfg.ReadTimeout())
+	assert.Equal(t, "https://idp.example.com", cfg.OIDCIssuer())
+	assert.Equal(t, 5, cfg.SigninFreeAttempts())
+	assert.True(t, cfg.BackupGzip())
+	assert.NoError(t, cfg.Validate())
+
+	// Ошибки в файле сообщаются так же, как для YAML
+	for content, message := range map[string]string{
+		"list_limt = 20\n":          "unknown setting list_limt",
+		"[oidc]\nissuers = \"x\"\n": "unknown setting oidc_issuers",
+		"list_limit = [1, 2]\n":     "lists are not supported",
+		"port: 8000\n":              "todo.toml",
+	} {
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+		_, _, err = config.Load(nil)
+		assert.ErrorContains(t, err, message, content)
+	}
+}
+
+func TestConfigExamples(t *testing.T) {
+	// Примеры файлов настроек в обоих форматах задают одни и те же значения
+	load := func(path string) *config.Handler {
+		cfg, _, err := config.Load([]string{"-config", path})
+		require.NoError(t, err, path)
+		return cfg
+	}
+	yaml, toml := load("../../config.example.yaml"), load("../../config.example.toml")
+
+	values := func(cfg *config.Handler) []any {
+		return []any{cfg.Port(), cfg.DBPath(), cfg.WebDirPath(), cfg.TokenTTL(), cfg.ReadTimeout(), cfg.WriteTimeout(),
+			cfg.IdleTimeout(), cfg.ShutdownTimeout(), cfg.RequestTimeout(), cfg.TransferTimeout(), cfg.DBBusyTimeout(),
+			cfg.ImportMaxRows(), cfg.ImportMaxBytes(), cfg.CalendarDays(), cfg.TaskListLimit(), cfg.BatchMaxOps(), cfg.SearchDateFormat(),
+			cfg.TLSCert(), cfg.TLSKey(), cfg.TLSDev(), cfg.BackupDir(), cfg.BackupInterval(), cfg.BackupKeep(), cfg.BackupGzip(),
+			cfg.WebhookTimeout(), cfg.WebhookMaxAttempts(), cfg.WebhookRetryDelay(), cfg.WebhookAllowedHosts(), cfg.OIDCIssuer(), cfg.OIDCClientID(),
+			cfg.OIDCRedirectURL(), cfg.OIDCAllowed(), cfg.SigninFreeAttempts(), cfg.SigninBackoffBase(),
+			cfg.SigninLockoutAttempts(), cfg.SigninLockoutTime(), cfg.SigninGlobalLimit(), cfg.SigninGlobalWindow()}
+	}
+	assert.Equal(t, values(yaml), values(toml))
+}
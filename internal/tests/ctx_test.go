@@ -0,0 +1,59 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go_final_project/internal/app"
+	"go_final_project/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContext(t *testing.T) {
+	t.Setenv("TODO_PASSWORD", "")
+	t.Setenv("TODO_OIDC_ISSUER", "")
+	srv := newLocalServer(t)
+	application := app.CreateApplication(srv.db, config.New())
+
+	today := time.Now().Format(`20060102`)
+	created, err := application.AddTask(context.Background(), app.Task{Date: today, Title: "Задача", Repeat: "d 1"})
+	require.NoError(t, err)
+
+	// Отмененный запрос не выполняется, и api отвечает на него как на превышение времени
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = application.GetTaskList(canceled, app.AllLists, "", 10)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, app.CodeTimeout, app.ErrorCode(err))
+
+	err = application.FinishTask(canceled, created.ID, 0)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, app.CodeTimeout, app.ErrorCode(err))
+
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	_, err = application.AddTask(expired, app.Task{Date: today, Title: "Задача"})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, app.CodeTimeout, app.ErrorCode(err))
+
+	// Транзакция, прерванная на середине, отменяется целиком и не блокирует следующие запросы
+	ctx, cancel := context.WithCancel(context.Background())
+	err = srv.db.WithTx(ctx, func(storage app.Storage) error {
+		task, err := storage.GetTaskByID(ctx, created.ID)
+		require.NoError(t, err)
+		task.Title = "Не сохранится"
+		require.NoError(t, storage.UpdateTask(ctx, task))
+		cancel()
+		return storage.UpdateTask(ctx, task)
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+
+	task, err := application.GetTask(context.Background(), created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, created, task, "отмененные запросы не должны менять задачу")
+	assert.NoError(t, application.FinishTask(context.Background(), created.ID, 0))
+}
@@ -16,6 +16,8 @@ type Task struct {
 	Title   string `db:"title"`
 	Comment string `db:"comment"`
 	Repeat  string `db:"repeat"`
+	List    string `db:"list"`
+	Version int64  `db:"version"`
 }
 
 func count(db *sqlx.DB) (int, error) {
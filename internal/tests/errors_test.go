@@ -0,0 +1,113 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"go_final_project/internal/app"
+	"go_final_project/internal/importer"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrorCode(t *testing.T) {
+	tbl := []struct {
+		err     error
+		code    app.Code
+		message string
+	}{
+		{app.ValidationError("title", "Error, Task.Title is empty"), app.CodeValidation, "Error, Task.Title is empty"},
+		{app.NotFoundError("coudn't find task.id=%d", 7), app.CodeNotFound, "coudn't find task.id=7"},
+		{app.ConflictError("task already exists"), app.CodeConflict, "task already exists"},
+		{app.PreconditionError("task.id=%d has been modified", 7), app.CodePrecondition, "task.id=7 has been modified"},
+		{context.DeadlineExceeded, app.CodeTimeout, "request timed out"},
+		{context.Canceled, app.CodeTimeout, "request timed out"},
+		{errors.New("database is locked"), app.CodeInternal, "internal server error"},
+	}
+	for _, v := range tbl {
+		// Код и сообщение не зависят от того, через сколько вызовов прошла ошибка
+		err := fmt.Errorf("DBStorage.UpdateTask: %w", v.err)
+		err = fmt.Errorf("Application.UpdateTask: %w", err)
+		assert.Equal(t, v.code, app.ErrorCode(err), v.err)
+		assert.Equal(t, v.message, app.ErrorMessage(err), v.err)
+	}
+}
+
+func TestErrorStatus(t *testing.T) {
+	t.Setenv("TODO_PASSWORD", "")
+	t.Setenv("TODO_OIDC_ISSUER", "")
+	srv := newLocalServer(t)
+
+	today := time.Now().Format(`20060102`)
+	id, err := srv.db.AddTask(context.Background(), app.Task{Date: today, Title: "Задача"})
+	require.NoError(t, err)
+
+	tbl := []struct {
+		method, path, contentType, ifMatch, body string
+		status                                   int
+		code                                     string
+		message                                  string
+	}{
+		{http.MethodPost, "/api/task", "application/json", "", `{"title":""}`,
+			http.StatusBadRequest, "validation_error", "Error, Task.Title is empty"},
+		{http.MethodPost, "/api/task", "application/json", "", `{"title":`,
+			http.StatusBadRequest, "bad_request", ""},
+		{http.MethodGet, "/api/task?id=999999", "", "", "",
+			http.StatusNotFound, "not_found", "coudn't find task.id=999999"},
+		{http.MethodGet, "/api/v1/tasks/999999", "", "", "",
+			http.StatusNotFound, "not_found", "coudn't find task.id=999999"},
+		{http.MethodPut, fmt.Sprintf("/api/v1/tasks/%d", id), "application/json", `"5"`, `{"title":"Изменена"}`,
+			http.StatusPreconditionFailed, "precondition_failed", fmt.Sprintf("task.id=%d has been modified", id)},
+		{http.MethodGet, "/api/task/done", "", "", "",
+			http.StatusMethodNotAllowed, "method_not_allowed", ""},
+		{http.MethodPatch, fmt.Sprintf("/api/v1/tasks/%d", id), "text/plain", "", `{"title":"Изменена"}`,
+			http.StatusUnsupportedMediaType, "unsupported_media_type", ""},
+	}
+	for _, v := range tbl {
+		name := v.method + " " + v.path
+		req, err := http.NewRequest(v.method, srv.URL+v.path, strings.NewReader(v.body))
+		require.NoError(t, err)
+		if len(v.contentType) > 0 {
+			req.Header.Set("Content-Type", v.contentType)
+		}
+		if len(v.ifMatch) > 0 {
+			req.Header.Set("If-Match", v.ifMatch)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		var m map[string]any
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&m), name)
+		resp.Body.Close()
+
+		assert.Equal(t, v.status, resp.StatusCode, name)
+		assert.Equal(t, v.code, m["code"], name)
+		if len(v.message) > 0 {
+			assert.Equal(t, v.message, m["error"], name)
+		}
+	}
+
+	// Ошибки отдельных операций пакета и строк импорта тоже не раскрывают цепочку вызовов
+	_, batch := postBatch(t, srv, "", map[string]any{"operations": []map[string]any{
+		{"op": "update", "id": fmt.Sprint(id), "task": map[string]any{"title": ""}},
+	}})
+	require.Len(t, batch.Results, 1)
+	require.NotNil(t, batch.Results[0].Error)
+	assert.Equal(t, "Error, Task.Title is empty", batch.Results[0].Error.Error)
+
+	resp, err := http.Post(srv.URL+"/api/import", "text/csv", strings.NewReader("title,date\n,"+today+"\n"))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var report importer.Report
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&report))
+	require.Len(t, report.Results, 1)
+	require.NotNil(t, report.Results[0].Error)
+	assert.Equal(t, "Error, Task.Title is empty", report.Results[0].Error.Error)
+}
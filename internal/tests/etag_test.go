@@ -0,0 +1,105 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"go_final_project/internal/app"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLegacyIfMatch(t *testing.T) {
+	t.Setenv("TODO_PASSWORD", "")
+	t.Setenv("TODO_OIDC_ISSUER", "")
+	srv := newLocalServer(t)
+	ctx := context.Background()
+
+	today := time.Now().Format(`20060102`)
+	add := func(repeat string) string {
+		id, err := srv.db.AddTask(ctx, app.Task{Date: today, Title: "Задача", Repeat: repeat})
+		require.NoError(t, err)
+		return fmt.Sprint(id)
+	}
+	call := func(method, path, ifMatch, body string) *http.Response {
+		req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		require.NoError(t, err)
+		if len(ifMatch) > 0 {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp
+	}
+	version := func(id string) int64 {
+		task, err := srv.db.GetTaskByID(ctx, id)
+		require.NoError(t, err)
+		return task.Version
+	}
+
+	id := add("d 1")
+	resp := call(http.MethodGet, "/api/task?id="+id, "", "")
+	assert.Equal(t, `"1"`, resp.Header.Get("ETag"))
+
+	// PUT возвращает ETag новой версии
+	put := func(ifMatch string) *http.Response {
+		return call(http.MethodPut, "/api/task", ifMatch, `{"id":"`+id+`","date":"`+today+`","title":"Изменена","repeat":"d 1"}`)
+	}
+	resp = put(`"1"`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, `"2"`, resp.Header.Get("ETag"))
+	assert.Equal(t, int64(2), version(id))
+
+	// Устаревший ETag отклоняется для PUT, DELETE и done, задача не меняется
+	for _, v := range []struct{ method, path string }{
+		{http.MethodPut, "/api/task"},
+		{http.MethodDelete, "/api/task?id=" + id},
+		{http.MethodPost, "/api/task/done?id=" + id},
+	} {
+		var resp *http.Response
+		if v.method == http.MethodPut {
+			resp = put(`"1"`)
+		} else {
+			resp = call(v.method, v.path, `"1"`, "")
+		}
+		assert.Equal(t, http.StatusPreconditionFailed, resp.StatusCode, v.method+" "+v.path)
+	}
+	assert.Equal(t, int64(2), version(id))
+
+	// If-Match сравнивается строго: слабый ETag не совпадает даже с текущей версией
+	for _, method := range []string{http.MethodDelete, http.MethodPost} {
+		path := "/api/task?id=" + id
+		if method == http.MethodPost {
+			path = "/api/task/done?id=" + id
+		}
+		resp = call(method, path, `W/"2"`, "")
+		assert.Equal(t, http.StatusPreconditionFailed, resp.StatusCode, method)
+	}
+	resp = put(`W/"2"`)
+	assert.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+	resp = put(`W/"2", "2"`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, `"3"`, resp.Header.Get("ETag"))
+
+	// Из нескольких ETag достаточно совпадения любого, а не только первого
+	resp = call(http.MethodPost, "/api/task/done?id="+id, `"1", "2"`, "")
+	assert.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+	resp = put(`"1", "3"`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, `"4"`, resp.Header.Get("ETag"))
+
+	// С актуальным ETag задача выполняется и удаляется
+	resp = call(http.MethodPost, "/api/task/done?id="+id, `"4"`, "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, int64(5), version(id))
+	resp = call(http.MethodDelete, "/api/task?id="+id, `"5"`, "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	_, err := srv.db.GetTaskByID(ctx, id)
+	assert.ErrorIs(t, err, app.ErrNotFound)
+}
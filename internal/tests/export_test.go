@@ -0,0 +1,118 @@
+package tests
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"go_final_project/internal/app"
+	"go_final_project/internal/ical"
+	"go_final_project/internal/importer"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRRule(t *testing.T) {
+	for repeat, rrule := range map[string]string{
+		"y":        "FREQ=YEARLY",
+		"d 1":      "FREQ=DAILY",
+		"d 7":      "FREQ=DAILY;INTERVAL=7",
+		"w 1,5,7":  "FREQ=WEEKLY;BYDAY=MO,FR,SU",
+		"m 1,-1":   "FREQ=MONTHLY;BYMONTHDAY=1,-1",
+		"m 10 3,9": "FREQ=YEARLY;BYMONTH=3,9;BYMONTHDAY=10",
+		"m -2 12":  "FREQ=YEARLY;BYMONTH=12;BYMONTHDAY=-2",
+	} {
+		got, err := ical.RRule(repeat)
+		require.NoError(t, err, repeat)
+		assert.Equal(t, rrule, got, repeat)
+	}
+	for _, repeat := range []string{"", "y 1", "d", "d 401", "w 8", "w", "m 0", "m 32", "m 1 13", "x 1"} {
+		_, err := ical.RRule(repeat)
+		assert.Error(t, err, repeat)
+	}
+}
+
+func TestExport(t *testing.T) {
+	t.Setenv("TODO_PASSWORD", "")
+	t.Setenv("TODO_OIDC_ISSUER", "")
+	srv := newLocalServer(t)
+	application := app.CreateApplication(srv.db, srv.cfg)
+
+	date := time.Now().AddDate(0, 0, 3).Format(`20060102`)
+	tasks := []app.Task{
+		{Date: date, Title: "Пробежка", Comment: "парк, 5 км; не забыть часы", Repeat: "w 1,5"},
+		{Date: date, Title: "Купить хлеб"},
+	}
+	for _, task := range tasks {
+		_, err := application.AddTask(context.Background(), task)
+		require.NoError(t, err)
+	}
+
+	get := func(query string) (*http.Response, string) {
+		resp, err := http.Get(srv.URL + "/api/export" + query)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp, string(body)
+	}
+
+	resp, body := get("")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, resp.Header.Get("Content-Disposition"), `filename="tasks.json"`)
+	var list app.TaskList
+	require.NoError(t, json.Unmarshal([]byte(body), &list))
+	require.Len(t, list.List, 2)
+	assert.Equal(t, "w 1,5", list.List[0].Repeat)
+
+	resp, body = get("?format=csv")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.True(t, strings.HasPrefix(resp.Header.Get("Content-Type"), "text/csv"))
+	records, err := csv.NewReader(strings.NewReader(body)).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	assert.Equal(t, []string{"id", "date", "title", "comment", "repeat", "list"}, records[0])
+	assert.Equal(t, []string{date, "Пробежка", "парк, 5 км; не забыть часы", "w 1,5", ""}, records[1][1:])
+
+	// Выгрузка всех списков указывает список каждой задачи, и импорт читает его так же, как из JSON
+	_, err = application.AddTask(context.Background(), app.Task{Date: date, Title: "Отчет", List: "work"})
+	require.NoError(t, err)
+	_, body = get("?format=csv&list=*")
+	rows, format, err := importer.Parse([]byte(body), "")
+	require.NoError(t, err)
+	assert.Equal(t, importer.FormatCSV, format)
+	require.Len(t, rows, 3)
+	lists := map[string]string{}
+	for _, row := range rows {
+		lists[row.Task.Title] = row.Task.List
+	}
+	assert.Equal(t, map[string]string{"Пробежка": "", "Купить хлеб": "", "Отчет": "work"}, lists)
+
+	resp, body = get("?format=ics")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.True(t, strings.HasPrefix(resp.Header.Get("Content-Type"), "text/calendar"))
+	assert.True(t, strings.HasPrefix(body, "BEGIN:VCALENDAR\r\n"))
+	assert.True(t, strings.HasSuffix(body, "END:VCALENDAR\r\n"))
+	assert.Equal(t, 2, strings.Count(body, "BEGIN:VEVENT"))
+	assert.Contains(t, body, "DTSTART;VALUE=DATE:"+date+"\r\n")
+	assert.Contains(t, body, "RRULE:FREQ=WEEKLY;BYDAY=MO,FR\r\n")
+	assert.Contains(t, body, `DESCRIPTION:парк\, 5 км\; не забыть часы`)
+	for _, line := range strings.Split(body, "\r\n") {
+		assert.LessOrEqual(t, len(line), 75, line)
+	}
+
+	_, body = get("?format=ics&component=vtodo")
+	assert.Equal(t, 2, strings.Count(body, "BEGIN:VTODO"))
+	assert.NotContains(t, body, "VEVENT")
+
+	resp, _ = get("?format=xml")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp, _ = get("?format=ics&component=vjournal")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
@@ -0,0 +1,242 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"go_final_project/internal/app"
+	"go_final_project/internal/ical"
+	"go_final_project/internal/importer"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepeatFromRRule(t *testing.T) {
+	for rrule, repeat := range map[string]string{
+		"FREQ=YEARLY":                           "y",
+		"FREQ=DAILY":                            "d 1",
+		"FREQ=DAILY;INTERVAL=3":                 "d 3",
+		"FREQ=WEEKLY;INTERVAL=2":                "d 14",
+		"FREQ=WEEKLY;BYDAY=MO,FR;WKST=MO":       "w 1,5",
+		"FREQ=MONTHLY":                          "m 26",
+		"FREQ=MONTHLY;BYMONTHDAY=1,-1":          "m 1,-1",
+		"FREQ=YEARLY;BYMONTH=3,9;BYMONTHDAY=10": "m 10 3,9",
+		"FREQ=YEARLY;BYMONTH=3":                 "m 26 3",
+	} {
+		got, err := ical.Repeat(rrule, "20240126")
+		require.NoError(t, err, rrule)
+		assert.Equal(t, repeat, got, rrule)
+
+		// Перевод обратно в RRULE и снова в правило не меняет правило
+		back, err := ical.RRule(got)
+		require.NoError(t, err, got)
+		again, err := ical.Repeat(back, "20240126")
+		require.NoError(t, err, back)
+		assert.Equal(t, got, again)
+	}
+	for _, rrule := range []string{"FREQ=DAILY;COUNT=3", "FREQ=WEEKLY;BYDAY=1MO", "FREQ=MONTHLY;INTERVAL=2", "FREQ=HOURLY", "FREQ=DAILY;INTERVAL=500", "garbage"} {
+		_, err := ical.Repeat(rrule, "20240126")
+		assert.Error(t, err, rrule)
+	}
+}
+
+func TestImportDetect(t *testing.T) {
+	for data, format := range map[string]string{
+		`{"tasks":[]}`:                             importer.FormatJSON,
+		` [{"title":"x"}]`:                         importer.FormatJSON,
+		`{"name":"Доска","cards":[]}`:              importer.FormatTrello,
+		"BEGIN:VCALENDAR\r\nEND:VCALENDAR\r\n":     importer.FormatICS,
+		"id,date,title,comment,repeat,list\n":      importer.FormatCSV,
+		"\xef\xbb\xbfTYPE,CONTENT,DATE\ntask,x,\n": importer.FormatTodoist,
+	} {
+		got, err := importer.Detect([]byte(data))
+		require.NoError(t, err, data)
+		assert.Equal(t, format, got, data)
+	}
+	_, err := importer.Detect([]byte("a;b;c\n"))
+	assert.ErrorIs(t, err, app.ErrValidation)
+}
+
+func TestImport(t *testing.T) {
+	t.Setenv("TODO_PASSWORD", "")
+	t.Setenv("TODO_OIDC_ISSUER", "")
+	srv := newLocalServer(t)
+	application := app.CreateApplication(srv.db, srv.cfg)
+	ctx := context.Background()
+
+	future := time.Now().AddDate(0, 0, 5).Format(`20060102`)
+	_, err := application.AddTask(ctx, app.Task{Date: future, Title: "Уже есть"})
+	require.NoError(t, err)
+
+	post := func(query, body string) (int, importer.Report) {
+		resp, err := http.Post(srv.URL+"/api/import"+query, "text/csv", strings.NewReader(body))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var report importer.Report
+		if resp.StatusCode == http.StatusOK {
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&report))
+		}
+		return resp.StatusCode, report
+	}
+	count := func() int {
+		tasks, err := application.AllTasks(ctx, app.AllLists)
+		require.NoError(t, err)
+		return len(tasks)
+	}
+
+	csv := "title,date,repeat,comment\n" +
+		"Новая," + future + ",,коммент\n" +
+		"Уже есть," + future + ",,\n" +
+		"Новая," + future + ",,повтор в файле\n" +
+		",20240101,,без заголовка\n" +
+		"Неверное правило,,x 1,\n" +
+		"Неверная дата,2024-13-45,,\n"
+
+	// В режиме проверки база не меняется
+	status, report := post("?dry_run=true", csv)
+	require.Equal(t, http.StatusOK, status)
+	assert.Equal(t, importer.FormatCSV, report.Format)
+	assert.True(t, report.DryRun)
+	assert.Equal(t, []int{1, 2, 3}, []int{report.Created, report.Duplicates, report.Invalid})
+	assert.Equal(t, 1, count())
+
+	status, report = post("", csv)
+	require.Equal(t, http.StatusOK, status)
+	assert.Equal(t, []int{1, 2, 3}, []int{report.Created, report.Duplicates, report.Invalid})
+	require.Len(t, report.Results, 6)
+	assert.Equal(t, app.ImportCreated, report.Results[0].Status)
+	assert.NotEmpty(t, report.Results[0].ID)
+	assert.Equal(t, app.ImportDuplicate, report.Results[1].Status)
+	assert.NotEmpty(t, report.Results[1].ID)
+	for i, field := range map[int]string{3: "title", 4: "repeat", 5: "date"} {
+		assert.Equal(t, i+1, report.Results[i].Row)
+		require.NotNil(t, report.Results[i].Error, i)
+		assert.Equal(t, app.CodeValidation, report.Results[i].Error.Code)
+		assert.Contains(t, report.Results[i].Error.Fields, field)
+	}
+	assert.Equal(t, 2, count())
+
+	// Повторный импорт собственной выгрузки ничего не создает
+	for _, format := range []string{"json", "csv", "ics"} {
+		resp, err := http.Get(srv.URL + "/api/export?format=" + format)
+		require.NoError(t, err)
+		data, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.NoError(t, err)
+
+		status, report := post("", string(data))
+		require.Equal(t, http.StatusOK, status, format)
+		assert.Equal(t, format, report.Format)
+		assert.Equal(t, []int{0, 2, 0}, []int{report.Created, report.Duplicates, report.Invalid}, format)
+	}
+
+	// Календарь другого приложения: RRULE переводится в правило, напоминания и выполненные задачи не мешают
+	ics := strings.Join([]string{
+		"BEGIN:VCALENDAR", "VERSION:2.0", "PRODID:-//Other//EN",
+		"BEGIN:VEVENT", "UID:1", "DTSTART;TZID=Europe/Moscow:" + future + "T090000", "SUMMARY:Планерка\\, еженедельная",
+		"DESCRIPTION:Переговорная 3", "RRULE:FREQ=WEEKLY;BYDAY=TU,TH",
+		"BEGIN:VALARM", "ACTION:DISPLAY", "DESCRIPTION:Напоминание", "TRIGGER:-PT15M", "END:VALARM",
+		"END:VEVENT",
+		"BEGIN:VTODO", "UID:2", "DUE;VALUE=DATE:" + future, "SUMMARY:Сделано", "STATUS:COMPLETED", "END:VTODO",
+		"BEGIN:VTODO", "UID:3", "DTSTART;VALUE=DATE:" + future, "SUMMARY:Отчет", "RRULE:FREQ=DAILY;COUNT=5", "END:VTODO",
+		"END:VCALENDAR", "",
+	}, "\r\n")
+	status, report = post("", ics)
+	require.Equal(t, http.StatusOK, status)
+	assert.Equal(t, importer.FormatICS, report.Format)
+	require.Len(t, report.Results, 2)
+	assert.Equal(t, app.ImportCreated, report.Results[0].Status)
+	assert.Equal(t, app.ImportInvalid, report.Results[1].Status)
+	task, err := application.GetTask(ctx, report.Results[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, app.Task{ID: task.ID, Date: task.Date, Title: "Планерка, еженедельная", Comment: "Переговорная 3", Repeat: "w 2,4", Version: task.Version}, task)
+
+	// Доска Trello: архивные карточки и карточки архивных списков пропускаются
+	trello := `{"name":"Переезд","lists":[{"id":"l1","closed":false},{"id":"l2","closed":true}],"cards":[
+		{"name":"Упаковать книги","desc":"коробки в кладовке","due":"` + time.Now().AddDate(0, 0, 7).UTC().Format(time.RFC3339) + `","idList":"l1"},
+		{"name":"Заказать машину","desc":"","due":null,"idList":"l1"},
+		{"name":"Старая","closed":true,"idList":"l1"},
+		{"name":"Из архива","idList":"l2"},
+		{"name":"Выполнена","dueComplete":true,"due":"2024-01-01T10:00:00.000Z","idList":"l1"}]}`
+	status, report = post("", trello)
+	require.Equal(t, http.StatusOK, status)
+	assert.Equal(t, importer.FormatTrello, report.Format)
+	assert.Equal(t, 2, report.Created)
+	assert.Equal(t, []int{1, 2}, []int{report.Results[0].Row, report.Results[1].Row})
+
+	// Выгрузка Todoist: заметки дописываются в комментарий, повторения переводятся в правила
+	todoist := "TYPE,CONTENT,DESCRIPTION,PRIORITY,INDENT,AUTHOR,RESPONSIBLE,DATE,DATE_LANG,TIMEZONE\n" +
+		"section,Дом,,,,,,,,\n" +
+		"task,Полить цветы,,1,1,me,,every other day,en,\n" +
+		"note,фикус реже,,,,,,,,\n" +
+		"task,Спорт,,1,1,me,,\"every mon, thu\",en,\n" +
+		"task,Квартплата,,1,1,me,,every 10th,en,\n" +
+		"task,Странное,,1,1,me,,every last workday,en,\n"
+	status, report = post("?format=todoist", todoist)
+	require.Equal(t, http.StatusOK, status)
+	assert.Equal(t, []int{3, 0, 1}, []int{report.Created, report.Duplicates, report.Invalid})
+	var repeats []string
+	for _, result := range report.Results[:3] {
+		task, err := application.GetTask(ctx, result.ID)
+		require.NoError(t, err)
+		repeats = append(repeats, task.Repeat)
+		if task.Title == "Полить цветы" {
+			assert.Equal(t, "фикус реже", task.Comment)
+		}
+	}
+	assert.Equal(t, []string{"d 2", "w 1,4", "m 10"}, repeats)
+
+	status, _ = post("?format=xml", csv)
+	assert.Equal(t, http.StatusBadRequest, status)
+	status, _ = post("", `{"tasks":[`)
+	assert.Equal(t, http.StatusBadRequest, status)
+	status, _ = post("", "")
+	assert.Equal(t, http.StatusBadRequest, status)
+}
+
+func TestImportLimits(t *testing.T) {
+	t.Setenv("TODO_PASSWORD", "")
+	t.Setenv("TODO_OIDC_ISSUER", "")
+	t.Setenv("TODO_DB_BUSY_TIMEOUT", "200ms")
+	t.Setenv("TODO_IMPORT_MAX_BYTES", "64")
+	srv := newLocalServer(t)
+	application := app.CreateApplication(srv.db, srv.cfg)
+	ctx := context.Background()
+
+	// Размер файла ограничен настройкой
+	post := func(body string) (int, string) {
+		resp, err := http.Post(srv.URL+"/api/import?format=csv", "text/csv", strings.NewReader(body))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, string(data)
+	}
+	status, body := post("title\n" + strings.Repeat("Задача\n", 10))
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Contains(t, body, "file is larger than 64 bytes")
+	status, _ = post("title\nЗадача\n")
+	assert.Equal(t, http.StatusOK, status)
+
+	// Проверка файла не ждет транзакцию, которая держит запись, а импорт ждет и завершается ошибкой
+	rows := []app.ImportRow{{Row: 1, Task: app.Task{Title: "Новая"}}, {Row: 2, Task: app.Task{Title: "Задача"}}}
+	err := srv.db.WithTx(ctx, func(app.Storage) error {
+		results, err := application.ImportTasks(ctx, "", rows, true)
+		require.NoError(t, err)
+		assert.Equal(t, []string{app.ImportCreated, app.ImportDuplicate}, []string{results[0].Status, results[1].Status})
+
+		_, err = application.ImportTasks(ctx, "", rows, false)
+		assert.Error(t, err)
+		return nil
+	})
+	require.NoError(t, err)
+	tasks, err := application.AllTasks(ctx, app.AllLists)
+	require.NoError(t, err)
+	assert.Len(t, tasks, 1)
+}
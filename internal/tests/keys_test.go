@@ -0,0 +1,116 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"go_final_project/internal/app"
+	"go_final_project/internal/authorization"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIKeys(t *testing.T) {
+	t.Setenv("TODO_PASSWORD", "123321")
+	t.Setenv("TODO_OIDC_ISSUER", "")
+	srv := newLocalServer(t)
+	ctx := context.Background()
+
+	owner, err := srv.auth.CreateToken(authorization.PasswordSubject)
+	require.NoError(t, err)
+	call := func(method, path, bearer string, body any) (int, map[string]any) {
+		var data []byte
+		if body != nil {
+			data, err = json.Marshal(body)
+			require.NoError(t, err)
+		}
+		req, err := http.NewRequest(method, srv.URL+path, bytes.NewReader(data))
+		require.NoError(t, err)
+		if len(bearer) > 0 {
+			req.Header.Set("Authorization", "Bearer "+bearer)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var m map[string]any
+		json.NewDecoder(resp.Body).Decode(&m)
+		return resp.StatusCode, m
+	}
+	createKey := func(name, scope string) string {
+		status, m := call(http.MethodPost, "/api/keys", owner, map[string]any{"name": name, "scope": scope})
+		require.Equal(t, http.StatusOK, status, m)
+		return m["key"].(string)
+	}
+
+	read := createKey("monitoring", authorization.ScopeRead)
+	write := createKey("ci", authorization.ScopeReadWrite)
+	status, _ := call(http.MethodPost, "/api/keys", owner, map[string]any{"name": "bad", "scope": "admin"})
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	today := time.Now().Format(`20060102`)
+	id, err := srv.db.AddTask(ctx, app.Task{Date: today, Title: "Задача"})
+	require.NoError(t, err)
+	task := "/api/task?id=" + strconv.FormatInt(id, 10)
+
+	// Ключ принимается в заголовке Authorization: Bearer, без ключа и с неизвестным ключом запрос отклоняется
+	status, _ = call(http.MethodGet, "/api/tasks", read, nil)
+	assert.Equal(t, http.StatusOK, status)
+	status, _ = call(http.MethodGet, "/api/tasks", "", nil)
+	assert.Equal(t, http.StatusUnauthorized, status)
+	status, _ = call(http.MethodGet, "/api/tasks", "todo_unknown", nil)
+	assert.Equal(t, http.StatusUnauthorized, status)
+
+	// Ключ только для чтения не может изменять задачи
+	status, m := call(http.MethodPost, "/api/task", read, map[string]any{"title": "Новая"})
+	assert.Equal(t, http.StatusForbidden, status)
+	assert.Equal(t, "forbidden", m["code"])
+	status, _ = call(http.MethodPost, "/api/task/done?id="+strconv.FormatInt(id, 10), read, nil)
+	assert.Equal(t, http.StatusForbidden, status)
+	status, _ = call(http.MethodDelete, task, read, nil)
+	assert.Equal(t, http.StatusForbidden, status)
+	status, _ = call(http.MethodGet, task, read, nil)
+	assert.Equal(t, http.StatusOK, status)
+
+	// Ключ для чтения и записи может создавать, изменять, выполнять и удалять задачи в любом списке
+	status, m = call(http.MethodPost, "/api/task?list=work", write, map[string]any{"title": "Новая"})
+	assert.Equal(t, http.StatusOK, status, m)
+	created := m["id"].(string)
+	status, _ = call(http.MethodPut, "/api/task", write, map[string]any{"id": strconv.FormatInt(id, 10), "date": today, "title": "Изменена"})
+	assert.Equal(t, http.StatusOK, status)
+	status, m = call(http.MethodPost, "/api/task/done?id="+strconv.FormatInt(id, 10), write, nil)
+	assert.Equal(t, http.StatusOK, status, m)
+	status, m = call(http.MethodDelete, "/api/task?id="+created, write, nil)
+	assert.Equal(t, http.StatusOK, status, m)
+
+	// Ключами нельзя управлять ключами
+	status, _ = call(http.MethodGet, "/api/keys", write, nil)
+	assert.Equal(t, http.StatusForbidden, status)
+
+	// Отозванный ключ больше не принимается
+	status, m = call(http.MethodGet, "/api/keys", owner, nil)
+	require.Equal(t, http.StatusOK, status)
+	keys := m["keys"].([]any)
+	require.Len(t, keys, 2)
+	assert.NotContains(t, keys[0], "key", "ключ возвращается только при создании")
+	status, _ = call(http.MethodDelete, "/api/keys?id="+keys[0].(map[string]any)["id"].(string), owner, nil)
+	require.Equal(t, http.StatusOK, status)
+	status, _ = call(http.MethodGet, "/api/tasks", read, nil)
+	assert.Equal(t, http.StatusUnauthorized, status)
+}
+
+func TestAPIKeysWithoutAuth(t *testing.T) {
+	t.Setenv("TODO_PASSWORD", "")
+	t.Setenv("TODO_OIDC_ISSUER", "")
+	srv := newLocalServer(t)
+
+	resp, err := http.Post(srv.URL+"/api/keys", "application/json", bytes.NewReader([]byte(`{"name":"ci","scope":"read-write"}`)))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
@@ -0,0 +1,64 @@
+package tests
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go_final_project/internal/app"
+	"go_final_project/internal/authorization"
+	"go_final_project/internal/backup"
+	"go_final_project/internal/caldav"
+	"go_final_project/internal/config"
+	"go_final_project/internal/db"
+	"go_final_project/internal/rest"
+	"go_final_project/internal/webhook"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Сервис, запущенный в текущем процессе
+type localServer struct {
+	*httptest.Server
+	cfg      *config.Handler
+	db       *db.DBStorage
+	auth     *authorization.Handler
+	backups  *backup.Scheduler
+	webhooks *webhook.Dispatcher
+	mux      *rest.Mux
+}
+
+// Собирает зависимости api так же, как cmd/main.go
+func newDeps(database *db.DBStorage, cfg *config.Handler) rest.Deps {
+	application := app.CreateApplication(database, cfg)
+	return rest.Deps{
+		App:      application,
+		Auth:     authorization.Create(database, cfg),
+		Backups:  backup.New(database, cfg),
+		DAV:      caldav.New(application, database),
+		Webhooks: webhook.New(database, cfg),
+	}
+}
+
+// Запускает сервис в текущем процессе с пустой базой во временном каталоге.
+// Переменные окружения для настройки должны быть выставлены до вызова или перечитаны через cfg.Reload
+func newLocalServer(t *testing.T) *localServer {
+	if len(os.Getenv("TODO_WEBDIR")) == 0 {
+		t.Setenv("TODO_WEBDIR", "../../web")
+	}
+	t.Setenv("TODO_DBPATH", filepath.Join(t.TempDir(), "scheduler.db"))
+
+	cfg, _, err := config.Load(nil)
+	require.NoError(t, err)
+	database := db.New(cfg)
+	require.NoError(t, database.Create())
+	require.NoError(t, database.Open())
+	t.Cleanup(func() { database.Close() })
+
+	deps := newDeps(database, cfg)
+	mux := rest.NewMux(deps, cfg)
+	srv := httptest.NewServer(mux.ServeMux())
+	t.Cleanup(srv.Close)
+	return &localServer{Server: srv, cfg: cfg, db: database, auth: deps.Auth, backups: deps.Backups, webhooks: deps.Webhooks, mux: mux}
+}
@@ -0,0 +1,282 @@
+package tests
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"go_final_project/internal/app"
+	"go_final_project/internal/authorization"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Минимальный OpenID Connect провайдер, который сразу авторизует пользователя alice
+type mockIdP struct {
+	srv           *httptest.Server
+	key           *rsa.PrivateKey
+	clientID      string
+	secret        string
+	nonces        map[string]string // code -> nonce
+	emailVerified bool
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	idp := &mockIdP{key: key, clientID: "todo", secret: "s3cr3t", nonces: make(map[string]string), emailVerified: true}
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.srv.URL,
+			"authorization_endpoint": idp.srv.URL + "/authorize",
+			"token_endpoint":         idp.srv.URL + "/token",
+			"jwks_uri":               idp.srv.URL + "/jwks",
+		})
+	})
+
+	mux.HandleFunc("/authorize", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		assert.Equal(t, idp.clientID, q.Get("client_id"))
+		assert.Equal(t, "code", q.Get("response_type"))
+
+		code := "code-" + q.Get("state")
+		idp.nonces[code] = q.Get("nonce")
+		redirect, err := url.Parse(q.Get("redirect_uri"))
+		assert.NoError(t, err)
+		redirect.RawQuery = url.Values{"code": {code}, "state": {q.Get("state")}}.Encode()
+		http.Redirect(w, r, redirect.String(), http.StatusFound)
+	})
+
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		id, secret, ok := r.BasicAuth()
+		if !ok || id != idp.clientID || secret != idp.secret {
+			http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+			return
+		}
+		nonce, ok := idp.nonces[r.FormValue("code")]
+		if !ok {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		delete(idp.nonces, r.FormValue("code"))
+
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"iss":            idp.srv.URL,
+			"aud":            idp.clientID,
+			"sub":            "alice",
+			"email":          "alice@example.com",
+			"email_verified": idp.emailVerified,
+			"nonce":          nonce,
+			"iat":            time.Now().Unix(),
+			"exp":            time.Now().Add(time.Minute).Unix(),
+		})
+		token.Header["kid"] = "test"
+		idToken, err := token.SignedString(idp.key)
+		assert.NoError(t, err)
+		json.NewEncoder(w).Encode(map[string]string{"id_token": idToken, "token_type": "Bearer"})
+	})
+
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kid": "test",
+			"kty": "RSA",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(idp.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(idp.key.E)).Bytes()),
+		}}})
+	})
+
+	idp.srv = httptest.NewServer(mux)
+	t.Cleanup(idp.srv.Close)
+	return idp
+}
+
+func TestOIDCLogin(t *testing.T) {
+	idp := newMockIdP(t)
+	t.Setenv("TODO_PASSWORD", "")
+	t.Setenv("TODO_OIDC_ISSUER", idp.srv.URL)
+	t.Setenv("TODO_OIDC_CLIENT_ID", idp.clientID)
+	t.Setenv("TODO_OIDC_CLIENT_SECRET", idp.secret)
+	t.Setenv("TODO_OIDC_ALLOWED", "bob, alice@example.com")
+
+	srv := newLocalServer(t)
+	t.Setenv("TODO_OIDC_REDIRECT_URL", srv.URL+"/api/oidc/callback")
+	require.NoError(t, srv.cfg.Reload())
+
+	// Без входа задачи недоступны
+	resp, err := http.Get(srv.URL + "/api/tasks")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	jar, err := cookiejar.New(nil)
+	require.NoError(t, err)
+	client := &http.Client{Jar: jar}
+
+	resp, err = client.Get(srv.URL + "/api/oidc/login")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "/", resp.Request.URL.Path, "после входа пользователь должен вернуться на главную страницу")
+
+	srvURL, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+	var token string
+	for _, c := range jar.Cookies(srvURL) {
+		if c.Name == "token" {
+			token = c.Value
+		}
+	}
+	require.NotEmpty(t, token, "после входа должна быть выставлена кука token")
+
+	// Пользователь провайдера сопоставлен с локальным пользователем, и токен выдан на него
+	user, err := srv.db.FindOrCreateUser(context.Background(), idp.srv.URL, "alice", "alice@example.com")
+	require.NoError(t, err)
+	claims := jwt.MapClaims{}
+	_, _, err = jwt.NewParser().ParseUnverified(token, claims)
+	require.NoError(t, err)
+	assert.Equal(t, authorization.UserSubject(user.ID), claims["sub"])
+
+	// Пока владелец не назначил роль, задачи вошедшему пользователю недоступны
+	resp, err = client.Get(srv.URL + "/api/tasks")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	require.NoError(t, srv.auth.SetRole(context.Background(), authorization.UserSubject(user.ID), app.DefaultList, authorization.RoleViewer))
+	resp, err = client.Get(srv.URL + "/api/tasks")
+	require.NoError(t, err)
+	var m map[string]any
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&m))
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, m, "tasks")
+
+	// Неизвестный state не принимается
+	resp, err = http.Get(srv.URL + "/api/oidc/callback?state=unknown&code=code-unknown")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+// Начинает вход в браузере client и возвращает адрес возврата от провайдера, не переходя по нему
+func oidcCallbackURL(t *testing.T, srv *localServer, client *http.Client) string {
+	noRedirect := *client
+	noRedirect.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if strings.HasPrefix(req.URL.String(), srv.URL+"/api/oidc/callback") {
+			return http.ErrUseLastResponse
+		}
+		return nil
+	}
+	resp, err := noRedirect.Get(srv.URL + "/api/oidc/login")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusFound, resp.StatusCode)
+	return resp.Header.Get("Location")
+}
+
+func TestOIDCLoginCSRF(t *testing.T) {
+	idp := newMockIdP(t)
+	t.Setenv("TODO_PASSWORD", "")
+	t.Setenv("TODO_OIDC_ISSUER", idp.srv.URL)
+	t.Setenv("TODO_OIDC_CLIENT_ID", idp.clientID)
+	t.Setenv("TODO_OIDC_CLIENT_SECRET", idp.secret)
+	t.Setenv("TODO_OIDC_ALLOWED", "alice")
+
+	srv := newLocalServer(t)
+	t.Setenv("TODO_OIDC_REDIRECT_URL", srv.URL+"/api/oidc/callback")
+	require.NoError(t, srv.cfg.Reload())
+
+	srvURL, err := url.Parse(srv.URL + "/api/oidc/callback")
+	require.NoError(t, err)
+	newClient := func() *http.Client {
+		jar, err := cookiejar.New(nil)
+		require.NoError(t, err)
+		return &http.Client{Jar: jar}
+	}
+	stateCookie := func(client *http.Client) string {
+		for _, c := range client.Jar.Cookies(srvURL) {
+			if c.Name == "oidc_state" {
+				return c.Value
+			}
+		}
+		return ""
+	}
+	callback := func(client *http.Client, location string) int {
+		resp, err := client.Get(location)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// Кука со state выдается браузеру, начавшему вход
+	attacker := newClient()
+	location := oidcCallbackURL(t, srv, attacker)
+	assert.NotEmpty(t, stateCookie(attacker))
+
+	// Адрес возврата, начатый в другом браузере, не выполняет вход у жертвы
+	victim := newClient()
+	assert.Equal(t, http.StatusUnauthorized, callback(victim, location))
+	assert.Empty(t, victim.Jar.Cookies(srvURL))
+
+	// Подмененный state не принимается, даже если в браузере есть своя кука
+	location = oidcCallbackURL(t, srv, victim)
+	forged, err := url.Parse(location)
+	require.NoError(t, err)
+	query := forged.Query()
+	query.Set("state", "forged")
+	forged.RawQuery = query.Encode()
+	assert.Equal(t, http.StatusUnauthorized, callback(victim, forged.String()))
+
+	// Тот же браузер входит, а кука со state после возврата удаляется
+	location = oidcCallbackURL(t, srv, victim)
+	assert.Equal(t, http.StatusOK, callback(victim, location))
+	assert.Empty(t, stateCookie(victim))
+	assert.Equal(t, http.StatusUnauthorized, callback(victim, location), "state одноразовый")
+}
+
+func TestOIDCAllowed(t *testing.T) {
+	idp := newMockIdP(t)
+	t.Setenv("TODO_PASSWORD", "")
+	t.Setenv("TODO_OIDC_ISSUER", idp.srv.URL)
+	t.Setenv("TODO_OIDC_CLIENT_ID", idp.clientID)
+	t.Setenv("TODO_OIDC_CLIENT_SECRET", idp.secret)
+
+	srv := newLocalServer(t)
+	t.Setenv("TODO_OIDC_REDIRECT_URL", srv.URL+"/api/oidc/callback")
+
+	login := func(allowed string, emailVerified bool) int {
+		t.Setenv("TODO_OIDC_ALLOWED", allowed)
+		require.NoError(t, srv.cfg.Reload())
+		idp.emailVerified = emailVerified
+
+		jar, err := cookiejar.New(nil)
+		require.NoError(t, err)
+		resp, err := (&http.Client{Jar: jar}).Get(srv.URL + "/api/oidc/login")
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, login("", true), "пустой список запрещает вход всем")
+	assert.Equal(t, http.StatusUnauthorized, login("bob, bob@example.com", true))
+	assert.Equal(t, http.StatusUnauthorized, login("alice@example.com", false), "неподтвержденный адрес почты не учитывается")
+	assert.Equal(t, http.StatusOK, login("ALICE@example.com", true))
+	assert.Equal(t, http.StatusOK, login("bob,alice", false))
+	assert.Equal(t, http.StatusOK, login("*", false))
+}
@@ -0,0 +1,374 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"go_final_project/internal/authorization"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Описание api, загруженное с сервера
+type openAPI struct {
+	Paths      map[string]map[string]openAPIOperation `json:"paths"`
+	Components struct {
+		Schemas   map[string]*schema          `json:"schemas"`
+		Responses map[string]*openAPIResponse `json:"responses"`
+	} `json:"components"`
+
+	token   string            // токен для заголовка Authorization, если задан
+	headers map[string]string // дополнительные заголовки запросов
+}
+
+type openAPIOperation struct {
+	Responses map[string]*openAPIResponse `json:"responses"`
+}
+
+type openAPIResponse struct {
+	Ref     string `json:"$ref"`
+	Content map[string]struct {
+		Schema *schema `json:"schema"`
+	} `json:"content"`
+}
+
+// Подмножество JSON Schema, которое используется в описании api
+type schema struct {
+	Ref                  string             `json:"$ref"`
+	Type                 string             `json:"type"`
+	Properties           map[string]*schema `json:"properties"`
+	Required             []string           `json:"required"`
+	Items                *schema            `json:"items"`
+	Enum                 []string           `json:"enum"`
+	Nullable             bool               `json:"nullable"`
+	AdditionalProperties json.RawMessage    `json:"additionalProperties"`
+}
+
+func loadOpenAPI(t *testing.T, srv *localServer) *openAPI {
+	resp, err := http.Get(srv.URL + "/api/openapi.json")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var spec openAPI
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&spec))
+	return &spec
+}
+
+// Находит операцию, описывающую запрос method к path, и шаблон ее пути
+func (spec *openAPI) operation(method, path string) (openAPIOperation, string, bool) {
+	segments := strings.Split(path, "/")
+	for tmpl, ops := range spec.Paths {
+		tmplSegments := strings.Split(tmpl, "/")
+		if len(tmplSegments) != len(segments) {
+			continue
+		}
+		match := true
+		for i, s := range tmplSegments {
+			if s != segments[i] && !strings.HasPrefix(s, "{") {
+				match = false
+				break
+			}
+		}
+		if match {
+			op, ok := ops[strings.ToLower(method)]
+			return op, tmpl, ok
+		}
+	}
+	return openAPIOperation{}, "", false
+}
+
+func (spec *openAPI) response(r *openAPIResponse) *openAPIResponse {
+	if name, ok := strings.CutPrefix(r.Ref, "#/components/responses/"); ok {
+		return spec.Components.Responses[name]
+	}
+	return r
+}
+
+// Проверяет значение v по схеме s, возвращает описание первого несоответствия
+func (spec *openAPI) validate(s *schema, v any, path string) error {
+	if name, ok := strings.CutPrefix(s.Ref, "#/components/schemas/"); ok {
+		ref, ok := spec.Components.Schemas[name]
+		if !ok {
+			return fmt.Errorf("%s: unknown schema %s", path, s.Ref)
+		}
+		return spec.validate(ref, v, path)
+	}
+	if v == nil {
+		if s.Nullable {
+			return nil
+		}
+		return fmt.Errorf("%s: unexpected null", path)
+	}
+
+	switch s.Type {
+	case "object":
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s: %v is not an object", path, v)
+		}
+		for _, name := range s.Required {
+			if _, ok := obj[name]; !ok {
+				return fmt.Errorf("%s: required property %s is missing", path, name)
+			}
+		}
+		for name, value := range obj {
+			prop, ok := s.Properties[name]
+			if !ok {
+				if string(s.AdditionalProperties) == "false" {
+					return fmt.Errorf("%s: unexpected property %s", path, name)
+				}
+				if len(s.AdditionalProperties) > 0 && string(s.AdditionalProperties) != "true" {
+					var additional schema
+					if err := json.Unmarshal(s.AdditionalProperties, &additional); err != nil {
+						return err
+					}
+					prop = &additional
+				} else {
+					continue
+				}
+			}
+			if err := spec.validate(prop, value, path+"."+name); err != nil {
+				return err
+			}
+		}
+	case "array":
+		arr, ok := v.([]any)
+		if !ok {
+			return fmt.Errorf("%s: %v is not an array", path, v)
+		}
+		for i, item := range arr {
+			if err := spec.validate(s.Items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("%s: %v is not a string", path, v)
+		}
+		if len(s.Enum) > 0 && !contains(s.Enum, str) {
+			return fmt.Errorf("%s: %q is not one of %v", path, str, s.Enum)
+		}
+	case "integer", "number":
+		if _, ok := v.(float64); !ok {
+			return fmt.Errorf("%s: %v is not a number", path, v)
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return fmt.Errorf("%s: %v is not a boolean", path, v)
+		}
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Выполняет запрос и проверяет, что статус и тело ответа описаны в спецификации
+func (spec *openAPI) call(t *testing.T, srv *localServer, method, path, contentType string, body any) (int, map[string]any) {
+	t.Helper()
+
+	var reqBody io.Reader
+	if text, ok := body.(string); ok {
+		reqBody = strings.NewReader(text)
+	} else if body != nil {
+		data, err := json.Marshal(body)
+		require.NoError(t, err)
+		reqBody = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, srv.URL+path, reqBody)
+	require.NoError(t, err)
+	if len(contentType) > 0 {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if len(spec.token) > 0 {
+		req.Header.Set("Authorization", "Bearer "+spec.token)
+	}
+	for name, value := range spec.headers {
+		req.Header.Set(name, value)
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	name := method + " " + path
+	op, tmpl, ok := spec.operation(method, strings.SplitN(path, "?", 2)[0])
+	require.True(t, ok, "%s: operation is not described", name)
+
+	described, ok := op.Responses[fmt.Sprint(resp.StatusCode)]
+	require.True(t, ok, "%s %s: status %d is not described", method, tmpl, resp.StatusCode)
+	described = spec.response(described)
+
+	if len(described.Content) == 0 {
+		assert.Empty(t, data, "%s: body is not described", name)
+		return resp.StatusCode, nil
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	content, ok := described.Content[mediaType]
+	require.True(t, ok, "%s: content type %s is not described", name, mediaType)
+
+	var v any = string(data)
+	if mediaType == "application/json" {
+		require.NoError(t, json.Unmarshal(data, &v), "%s: %s", name, data)
+	}
+	assert.NoError(t, spec.validate(content.Schema, v, "body"), "%s: %s", name, data)
+
+	m, _ := v.(map[string]any)
+	return resp.StatusCode, m
+}
+
+func TestOpenAPI(t *testing.T) {
+	t.Setenv("TODO_PASSWORD", "")
+	t.Setenv("TODO_OIDC_ISSUER", "")
+	srv := newLocalServer(t)
+	spec := loadOpenAPI(t, srv)
+
+	// В описании есть все маршруты, зарегистрированные в NewMux
+	for _, route := range srv.mux.Routes() {
+		method, path, ok := strings.Cut(route, " ")
+		if !ok {
+			path, method = route, ""
+		}
+		ops, ok := spec.Paths[path]
+		if !assert.True(t, ok, "route %s is not described", route) {
+			continue
+		}
+		if len(method) > 0 {
+			assert.Contains(t, ops, strings.ToLower(method), "route %s is not described", route)
+		}
+	}
+
+	today := time.Now().Format(`20060102`)
+	task := map[string]any{"date": today, "title": "Задача", "comment": "", "repeat": "d 1"}
+
+	spec.call(t, srv, http.MethodGet, "/api/nextdate?now=20240126&date=20240126&repeat=d%201", "", nil)
+	spec.call(t, srv, http.MethodGet, "/api/nextdate?now=20240126&date=20240126&repeat=x", "", nil)
+
+	_, created := spec.call(t, srv, http.MethodPost, "/api/task", "application/json", task)
+	id := fmt.Sprint(created["id"])
+	spec.call(t, srv, http.MethodPost, "/api/task", "application/json", map[string]any{"title": ""})
+	spec.call(t, srv, http.MethodGet, "/api/task?id="+id, "", nil)
+	spec.call(t, srv, http.MethodGet, "/api/task?id=999999", "", nil)
+	spec.call(t, srv, http.MethodPut, "/api/task", "application/json", map[string]any{"id": id, "date": today, "title": "Изменена"})
+	spec.call(t, srv, http.MethodPatch, "/api/task?id="+id, "application/merge-patch+json", map[string]any{"comment": "patch"})
+	spec.call(t, srv, http.MethodPatch, "/api/task?id="+id, "text/plain", map[string]any{"comment": "patch"})
+	spec.call(t, srv, http.MethodGet, "/api/tasks", "", nil)
+	spec.call(t, srv, http.MethodPost, "/api/tasks/batch", "application/json", map[string]any{"operations": []map[string]any{
+		{"op": "update", "id": id, "task": task}, {"op": "complete", "id": "999999"},
+	}})
+	spec.call(t, srv, http.MethodPost, "/api/tasks/batch", "application/json", map[string]any{"operations": []map[string]any{}})
+	spec.call(t, srv, http.MethodPost, "/api/task/done?id="+id, "", nil)
+	spec.call(t, srv, http.MethodDelete, "/api/task?id="+id, "", nil)
+	spec.call(t, srv, http.MethodDelete, "/api/task?id="+id, "", nil)
+
+	status, v1 := spec.call(t, srv, http.MethodPost, "/api/v1/tasks", "application/json", task)
+	assert.Equal(t, http.StatusCreated, status)
+	v1ID := fmt.Sprint(v1["id"])
+	spec.call(t, srv, http.MethodGet, "/api/v1/tasks", "", nil)
+	spec.call(t, srv, http.MethodGet, "/api/v1/tasks/"+v1ID, "", nil)
+	spec.call(t, srv, http.MethodPut, "/api/v1/tasks/"+v1ID, "application/json", task)
+	spec.call(t, srv, http.MethodPatch, "/api/v1/tasks/"+v1ID, "application/merge-patch+json", map[string]any{"comment": nil})
+	spec.call(t, srv, http.MethodPost, "/api/v1/tasks/"+v1ID+"/complete", "", nil)
+	spec.call(t, srv, http.MethodDelete, "/api/v1/tasks/"+v1ID, "", nil)
+	spec.call(t, srv, http.MethodGet, "/api/v1/tasks/"+v1ID, "", nil)
+
+	status, _ = spec.call(t, srv, http.MethodGet, "/api/keys", "", nil)
+	assert.Equal(t, http.StatusForbidden, status, "без авторизации ключи не выдаются")
+
+	spec.call(t, srv, http.MethodPost, "/api/roles", "application/json", map[string]any{"subject": "user:1", "role": "editor"})
+	spec.call(t, srv, http.MethodGet, "/api/roles", "", nil)
+	spec.call(t, srv, http.MethodDelete, "/api/roles?subject=user:1", "", nil)
+
+	// Выгрузка и загрузка во всех форматах
+	spec.call(t, srv, http.MethodPost, "/api/task", "application/json", task)
+	for _, format := range []string{"json", "csv", "ics"} {
+		status, _ = spec.call(t, srv, http.MethodGet, "/api/export?format="+format, "", nil)
+		assert.Equal(t, http.StatusOK, status, format)
+	}
+	spec.call(t, srv, http.MethodGet, "/api/export?format=ics&component=vevent", "", nil)
+	spec.call(t, srv, http.MethodGet, "/api/export?format=xml", "", nil)
+	status, report := spec.call(t, srv, http.MethodPost, "/api/import?dry_run=true", "text/csv", "title,date\nИз файла,"+today+"\n,"+today+"\n")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, float64(1), report["invalid"])
+	status, _ = spec.call(t, srv, http.MethodPost, "/api/import", "application/json", map[string]any{"tasks": []map[string]any{task}})
+	assert.Equal(t, http.StatusOK, status)
+	status, _ = spec.call(t, srv, http.MethodPost, "/api/import", "text/calendar", "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nBEGIN:VTODO\r\nUID:1@example.com\r\nSUMMARY:Из календаря\r\nDUE;VALUE=DATE:"+today+"\r\nEND:VTODO\r\nEND:VCALENDAR\r\n")
+	assert.Equal(t, http.StatusOK, status)
+	spec.call(t, srv, http.MethodPost, "/api/import?format=xml", "text/csv", "title\n")
+
+	// Подписка на календарь и ответ без тела при совпадении ETag
+	status, _ = spec.call(t, srv, http.MethodGet, "/api/calendar.ics", "", nil)
+	assert.Equal(t, http.StatusOK, status)
+	resp, err := http.Get(srv.URL + "/api/calendar.ics")
+	require.NoError(t, err)
+	resp.Body.Close()
+	spec.headers = map[string]string{"If-None-Match": resp.Header.Get("ETag")}
+	status, _ = spec.call(t, srv, http.MethodGet, "/api/calendar.ics", "", nil)
+	assert.Equal(t, http.StatusNotModified, status)
+	spec.headers = nil
+
+	// Получатели событий и журнал доставок
+	status, hook := spec.call(t, srv, http.MethodPost, "/api/webhooks", "application/json", map[string]any{"url": "https://hooks.example.com/todo", "events": []string{"task.created"}})
+	require.Equal(t, http.StatusOK, status)
+	status, _ = spec.call(t, srv, http.MethodPost, "/api/webhooks", "application/json", map[string]any{"url": "ftp://hooks.example.com/todo"})
+	assert.Equal(t, http.StatusBadRequest, status)
+	spec.call(t, srv, http.MethodGet, "/api/webhooks", "", nil)
+	spec.call(t, srv, http.MethodGet, "/api/webhooks/deliveries?webhook_id="+fmt.Sprint(hook["id"])+"&limit=10", "", nil)
+	spec.call(t, srv, http.MethodGet, "/api/webhooks/deliveries?limit=x", "", nil)
+	status, _ = spec.call(t, srv, http.MethodDelete, "/api/webhooks?id="+fmt.Sprint(hook["id"]), "", nil)
+	assert.Equal(t, http.StatusOK, status)
+	status, _ = spec.call(t, srv, http.MethodDelete, "/api/webhooks?id=999999", "", nil)
+	assert.Equal(t, http.StatusNotFound, status)
+	spec.call(t, srv, http.MethodGet, "/api/backup/status", "", nil)
+
+	spec.call(t, srv, http.MethodPost, "/api/signin", "application/json", map[string]any{"password": "wrong"})
+	spec.call(t, srv, http.MethodPost, "/api/token/refresh", "", nil)
+	spec.call(t, srv, http.MethodGet, "/api/oidc/login", "", nil)
+	spec.call(t, srv, http.MethodGet, "/api/oidc/callback?state=unknown&code=unknown", "", nil)
+}
+
+func TestOpenAPIAuth(t *testing.T) {
+	t.Setenv("TODO_PASSWORD", "123321")
+	t.Setenv("TODO_OIDC_ISSUER", "")
+	srv := newLocalServer(t)
+	spec := loadOpenAPI(t, srv)
+
+	spec.call(t, srv, http.MethodGet, "/api/tasks", "", nil)
+	spec.call(t, srv, http.MethodGet, "/api/v1/tasks", "", nil)
+
+	status, _ := spec.call(t, srv, http.MethodPost, "/api/signin", "application/json", map[string]any{"password": "123321"})
+	assert.Equal(t, http.StatusOK, status)
+	for i := 0; i < 10 && status != http.StatusTooManyRequests; i++ {
+		status, _ = spec.call(t, srv, http.MethodPost, "/api/signin", "application/json", map[string]any{"password": "wrong"})
+	}
+	assert.Equal(t, http.StatusTooManyRequests, status)
+
+	// Управление ключами доступно только после входа
+	token, err := srv.auth.CreateToken(authorization.PasswordSubject)
+	require.NoError(t, err)
+	spec.token = token
+	_, key := spec.call(t, srv, http.MethodPost, "/api/keys", "application/json", map[string]any{"name": "ci", "scope": "read"})
+	spec.call(t, srv, http.MethodPost, "/api/keys", "application/json", map[string]any{"name": "ci", "scope": "read"})
+	spec.call(t, srv, http.MethodGet, "/api/keys", "", nil)
+	spec.call(t, srv, http.MethodDelete, "/api/keys?id="+fmt.Sprint(key["id"]), "", nil)
+}
@@ -0,0 +1,113 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"go_final_project/internal/app"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPatchTask(t *testing.T) {
+	t.Setenv("TODO_PASSWORD", "")
+	t.Setenv("TODO_OIDC_ISSUER", "")
+	srv := newLocalServer(t)
+	ctx := context.Background()
+
+	date := time.Now().AddDate(0, 0, 3).Format(`20060102`)
+	id, err := srv.db.AddTask(ctx, app.Task{Date: date, Title: "Задача", Comment: "Комментарий", Repeat: "d 2"})
+	require.NoError(t, err)
+	path := fmt.Sprintf("/api/v1/tasks/%d", id)
+
+	patch := func(path, contentType, ifMatch, body string) (int, http.Header, map[string]any) {
+		req, err := http.NewRequest(http.MethodPatch, srv.URL+path, strings.NewReader(body))
+		require.NoError(t, err)
+		if len(contentType) > 0 {
+			req.Header.Set("Content-Type", contentType)
+		}
+		if len(ifMatch) > 0 {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		var m map[string]any
+		require.NoError(t, json.Unmarshal(data, &m), string(data))
+		return resp.StatusCode, resp.Header, m
+	}
+	stored := func() app.Task {
+		task, err := srv.db.GetTaskByID(ctx, fmt.Sprint(id))
+		require.NoError(t, err)
+		return task
+	}
+
+	// Меняются только переданные поля
+	status, header, m := patch(path, "application/merge-patch+json", "", `{"title":"Новый заголовок"}`)
+	require.Equal(t, http.StatusOK, status, m)
+	assert.Equal(t, `"2"`, header.Get("ETag"))
+	assert.Equal(t, app.Task{ID: fmt.Sprint(id), Date: date, Title: "Новый заголовок", Comment: "Комментарий", Repeat: "d 2", Version: 2}, stored())
+
+	// null очищает поле
+	status, _, m = patch(path, "application/merge-patch+json", "", `{"comment":null,"repeat":null}`)
+	require.Equal(t, http.StatusOK, status, m)
+	assert.Equal(t, "", m["comment"])
+	assert.Equal(t, "", m["repeat"])
+	assert.Equal(t, app.Task{ID: fmt.Sprint(id), Date: date, Title: "Новый заголовок", Version: 3}, stored())
+
+	// Итоговая задача проверяется целиком: заголовок нельзя очистить, неизвестные поля,
+	// смена id и списка отклоняются, задача при этом не меняется
+	for _, v := range []struct {
+		body  string
+		field string
+	}{
+		{`{"title":null}`, "title"},
+		{`{"title":""}`, "title"},
+		{`{"titel":"Опечатка"}`, "patch"},
+		{`{"version":10}`, "patch"},
+		{`{"id":"999999"}`, "id"},
+		{`{"list":"work"}`, "list"},
+		{`{"repeat":"x 1"}`, "repeat"},
+		{`{"title":`, "patch"},
+	} {
+		status, _, m = patch(path, "application/merge-patch+json", "", v.body)
+		assert.Equal(t, http.StatusBadRequest, status, v.body)
+		assert.Equal(t, "validation_error", m["code"], v.body)
+		assert.Contains(t, m["fields"], v.field, v.body)
+	}
+	assert.Equal(t, int64(3), stored().Version)
+
+	// Принимаются только application/merge-patch+json и application/json
+	for _, contentType := range []string{"", "text/plain", "application/json-patch+json"} {
+		status, _, m = patch(path, contentType, "", `{"title":"Другой"}`)
+		assert.Equal(t, http.StatusUnsupportedMediaType, status, contentType)
+		assert.Equal(t, "unsupported_media_type", m["code"], contentType)
+	}
+	status, _, _ = patch(path, "application/json; charset=UTF-8", "", `{"title":"Другой"}`)
+	assert.Equal(t, http.StatusOK, status)
+
+	// If-Match защищает от потери одновременных изменений
+	status, _, m = patch(path, "application/merge-patch+json", `"3"`, `{"title":"Устаревший"}`)
+	assert.Equal(t, http.StatusPreconditionFailed, status)
+	assert.Equal(t, "precondition_failed", m["code"])
+	status, _, _ = patch(path, "application/merge-patch+json", `"4"`, `{"title":"Актуальный"}`)
+	assert.Equal(t, http.StatusOK, status)
+
+	// Старый маршрут принимает тот же формат
+	status, _, m = patch(fmt.Sprintf("/api/task?id=%d", id), "application/merge-patch+json", "", `{"comment":"Снова"}`)
+	require.Equal(t, http.StatusOK, status, m)
+	assert.Equal(t, "Актуальный", m["title"])
+	assert.Equal(t, "Снова", stored().Comment)
+
+	status, _, _ = patch("/api/v1/tasks/999999", "application/merge-patch+json", "", `{"title":"Нет"}`)
+	assert.Equal(t, http.StatusNotFound, status)
+}
@@ -0,0 +1,268 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"go_final_project/internal/app"
+	"go_final_project/internal/authorization"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoles(t *testing.T) {
+	t.Setenv("TODO_PASSWORD", "123321")
+	t.Setenv("TODO_OIDC_ISSUER", "")
+	srv := newLocalServer(t)
+
+	tokens := map[authorization.Role]string{}
+	var err error
+	tokens[authorization.RoleOwner], err = srv.auth.CreateToken(authorization.PasswordSubject)
+	require.NoError(t, err)
+
+	require.NoError(t, srv.auth.SetRole(context.Background(), authorization.UserSubject("1"), authorization.AllLists, authorization.RoleEditor))
+	tokens[authorization.RoleEditor], err = srv.auth.CreateToken(authorization.UserSubject("1"))
+	require.NoError(t, err)
+
+	require.NoError(t, srv.auth.SetRole(context.Background(), authorization.UserSubject("2"), authorization.AllLists, authorization.RoleViewer))
+	tokens[authorization.RoleViewer], err = srv.auth.CreateToken(authorization.UserSubject("2"))
+	require.NoError(t, err)
+
+	today := time.Now().Format(`20060102`)
+	newTask := func() string {
+		id, err := srv.db.AddTask(context.Background(), app.Task{Date: today, Title: "Общая задача"})
+		require.NoError(t, err)
+		return fmt.Sprint(id)
+	}
+
+	tbl := []struct {
+		method string
+		path   func(role authorization.Role) string
+		body   func(role authorization.Role) map[string]any
+		min    authorization.Role
+	}{
+		{http.MethodGet, func(authorization.Role) string { return "/api/tasks" }, nil, authorization.RoleViewer},
+		{http.MethodGet, func(authorization.Role) string { return "/api/task?id=" + newTask() }, nil, authorization.RoleViewer},
+		{http.MethodPost, func(authorization.Role) string { return "/api/task" },
+			func(authorization.Role) map[string]any { return map[string]any{"title": "Новая задача"} }, authorization.RoleEditor},
+		{http.MethodPut, func(authorization.Role) string { return "/api/task" },
+			func(authorization.Role) map[string]any {
+				return map[string]any{"id": newTask(), "date": today, "title": "Измененная задача"}
+			}, authorization.RoleEditor},
+		{http.MethodPost, func(authorization.Role) string { return "/api/task/done?id=" + newTask() }, nil, authorization.RoleEditor},
+		{http.MethodDelete, func(authorization.Role) string { return "/api/task?id=" + newTask() }, nil, authorization.RoleOwner},
+		{http.MethodGet, func(authorization.Role) string { return "/api/keys" }, nil, authorization.RoleOwner},
+		{http.MethodPost, func(authorization.Role) string { return "/api/keys" },
+			func(role authorization.Role) map[string]any {
+				return map[string]any{"name": "key-" + string(role), "scope": authorization.ScopeRead}
+			}, authorization.RoleOwner},
+		{http.MethodDelete, func(authorization.Role) string { return "/api/keys?id=1" }, nil, authorization.RoleOwner},
+		{http.MethodGet, func(authorization.Role) string { return "/api/roles" }, nil, authorization.RoleOwner},
+		{http.MethodPost, func(authorization.Role) string { return "/api/roles" },
+			func(authorization.Role) map[string]any {
+				return map[string]any{"subject": authorization.UserSubject("3"), "role": authorization.RoleViewer}
+			}, authorization.RoleOwner},
+		{http.MethodDelete, func(authorization.Role) string { return "/api/roles?subject=" + authorization.UserSubject("3") }, nil, authorization.RoleOwner},
+	}
+
+	for _, v := range tbl {
+		for _, role := range []authorization.Role{authorization.RoleViewer, authorization.RoleEditor, authorization.RoleOwner} {
+			var data []byte
+			if v.body != nil {
+				data, err = json.Marshal(v.body(role))
+				require.NoError(t, err)
+			}
+			path := v.path(role)
+			req, err := http.NewRequest(v.method, srv.URL+path, bytes.NewBuffer(data))
+			require.NoError(t, err)
+			req.Header.Set("Authorization", "Bearer "+tokens[role])
+
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			body, err := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			require.NoError(t, err)
+
+			var m map[string]any
+			assert.NoError(t, json.Unmarshal(body, &m), "%s %s: ответ должен быть в формате JSON", v.method, path)
+			if role.Includes(v.min) {
+				assert.Equal(t, http.StatusOK, resp.StatusCode, "%s %s должен быть доступен роли %s: %s", v.method, path, role, body)
+				assert.NotContains(t, m, "error", "%s %s для роли %s", v.method, path, role)
+			} else {
+				assert.Equal(t, http.StatusForbidden, resp.StatusCode, "%s %s должен быть запрещен роли %s", v.method, path, role)
+				assert.NotEmpty(t, m["error"], "%s %s для роли %s", v.method, path, role)
+			}
+		}
+	}
+}
+
+func TestScopedRoles(t *testing.T) {
+	t.Setenv("TODO_PASSWORD", "123321")
+	t.Setenv("TODO_OIDC_ISSUER", "")
+	srv := newLocalServer(t)
+	ctx := context.Background()
+
+	token := func(subject string) string {
+		tokenString, err := srv.auth.CreateToken(subject)
+		require.NoError(t, err)
+		return tokenString
+	}
+	owner := token(authorization.PasswordSubject)
+	call := func(method, path, bearer string, body any) (int, map[string]any) {
+		var data []byte
+		if body != nil {
+			var err error
+			data, err = json.Marshal(body)
+			require.NoError(t, err)
+		}
+		req, err := http.NewRequest(method, srv.URL+path, bytes.NewReader(data))
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+bearer)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var m map[string]any
+		json.NewDecoder(resp.Body).Decode(&m)
+		return resp.StatusCode, m
+	}
+	setRole := func(subject string, body map[string]any) {
+		body["subject"] = subject
+		status, m := call(http.MethodPost, "/api/roles", owner, body)
+		require.Equal(t, http.StatusOK, status, m)
+	}
+
+	// editor - редактор списка work, manager - владелец списка work, но не общего списка;
+	// senior - редактор всех списков, кроме work, где он только читает
+	editor, manager, senior := authorization.UserSubject("1"), authorization.UserSubject("2"), authorization.UserSubject("3")
+	setRole(editor, map[string]any{"list": "work", "role": authorization.RoleEditor})
+	setRole(manager, map[string]any{"list": "work", "role": authorization.RoleOwner})
+	setRole(senior, map[string]any{"role": authorization.RoleEditor})
+	setRole(senior, map[string]any{"list": "work", "role": authorization.RoleViewer})
+
+	status, m := call(http.MethodGet, "/api/roles", owner, nil)
+	require.Equal(t, http.StatusOK, status)
+	assert.Len(t, m["roles"], 4)
+	assert.Contains(t, m["roles"], map[string]any{"subject": senior, "list": authorization.AllLists, "role": string(authorization.RoleEditor)})
+	status, _ = call(http.MethodPost, "/api/roles", owner, map[string]any{"subject": editor, "list": strings.Repeat("x", 65), "role": authorization.RoleViewer})
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	today := time.Now().Format(`20060102`)
+	newTask := func(list string) string {
+		id, err := srv.db.AddTask(ctx, app.Task{Date: today, Title: "Задача " + list, List: list})
+		require.NoError(t, err)
+		return fmt.Sprint(id)
+	}
+	work, home := newTask("work"), newTask("")
+
+	// Задача создается в списке из параметра list и остается в нем после изменения
+	status, m = call(http.MethodPost, "/api/task?list=work", token(editor), map[string]any{"title": "Отчет"})
+	require.Equal(t, http.StatusOK, status, m)
+	created := fmt.Sprint(m["id"])
+	status, m = call(http.MethodPut, "/api/task", token(editor), map[string]any{"id": created, "date": today, "title": "Отчет за месяц", "list": ""})
+	require.Equal(t, http.StatusOK, status, m)
+	status, m = call(http.MethodGet, "/api/task?id="+created, token(editor), nil)
+	require.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "work", m["list"])
+	assert.Equal(t, "Отчет за месяц", m["title"])
+
+	tbl := []struct {
+		name    string
+		method  string
+		path    string
+		body    map[string]any
+		allowed map[string]bool
+	}{
+		{"создание в общем списке", http.MethodPost, "/api/task", map[string]any{"title": "Новая"}, map[string]bool{senior: true}},
+		{"создание в work", http.MethodPost, "/api/task?list=work", map[string]any{"title": "Новая"}, map[string]bool{editor: true, manager: true}},
+		{"изменение в work", http.MethodPut, "/api/task", map[string]any{"id": work, "date": today, "title": "Изменена"}, map[string]bool{editor: true, manager: true}},
+		{"изменение в общем списке", http.MethodPut, "/api/task", map[string]any{"id": home, "date": today, "title": "Изменена"}, map[string]bool{senior: true}},
+		{"merge patch в work", http.MethodPatch, "/api/task?id=" + work, map[string]any{"comment": "срочно"}, map[string]bool{editor: true, manager: true}},
+		{"merge patch в общем списке", http.MethodPatch, "/api/v1/tasks/" + home, map[string]any{"comment": "срочно"}, map[string]bool{senior: true}},
+		{"список work", http.MethodGet, "/api/tasks?list=work", nil, map[string]bool{editor: true, manager: true, senior: true}},
+		{"выгрузка всех списков", http.MethodGet, "/api/export?list=*", nil, map[string]bool{senior: true}},
+		{"список общих задач", http.MethodGet, "/api/tasks", nil, map[string]bool{senior: true}},
+		{"управление ролями", http.MethodGet, "/api/roles", nil, map[string]bool{}},
+	}
+	for _, v := range tbl {
+		for _, subject := range []string{editor, manager, senior} {
+			status, m := call(v.method, v.path, token(subject), v.body)
+			if v.allowed[subject] {
+				assert.Equal(t, http.StatusOK, status, "%s: %s должен быть доступен %s: %v", v.name, v.path, subject, m)
+			} else {
+				assert.Equal(t, http.StatusForbidden, status, "%s: %s должен быть запрещен %s", v.name, v.path, subject)
+			}
+		}
+	}
+
+	// Список задач и выгрузка показывают только задачи выбранного списка
+	status, m = call(http.MethodGet, "/api/tasks?list=work", token(editor), nil)
+	require.Equal(t, http.StatusOK, status)
+	require.Len(t, m["tasks"], 4)
+	for _, task := range m["tasks"].([]any) {
+		assert.Equal(t, "work", task.(map[string]any)["list"])
+	}
+	status, m = call(http.MethodGet, "/api/tasks", token(senior), nil)
+	require.Equal(t, http.StatusOK, status)
+	for _, task := range m["tasks"].([]any) {
+		assert.NotContains(t, task, "list")
+	}
+
+	// Пакет проверяет права каждой операции в списке ее задачи
+	batch := func(subject, query string, ops ...map[string]any) int {
+		status, _ := call(http.MethodPost, "/api/tasks/batch"+query, token(subject), map[string]any{"atomic": true, "operations": ops})
+		return status
+	}
+	update := func(id string) map[string]any {
+		return map[string]any{"op": app.BatchUpdate, "id": id, "task": map[string]any{"date": today, "title": "Из пакета"}}
+	}
+	assert.Equal(t, http.StatusOK, batch(editor, "?list=work", map[string]any{"op": app.BatchCreate, "task": map[string]any{"title": "Из пакета"}}, update(work)))
+	assert.Equal(t, http.StatusOK, batch(senior, "", map[string]any{"op": app.BatchCreate, "task": map[string]any{"title": "Из пакета"}}))
+	// Без роли в общем списке пакет без list не принимается, даже если его операции относятся к другим спискам
+	assert.Equal(t, http.StatusForbidden, batch(editor, "", update(work)))
+	assert.Equal(t, http.StatusForbidden, batch(editor, "", map[string]any{"op": app.BatchCreate, "task": map[string]any{"title": "Из пакета"}}))
+	assert.Equal(t, http.StatusForbidden, batch(editor, "?list=work", update(work), update(home)))
+	assert.Equal(t, http.StatusForbidden, batch(senior, "", update(work)))
+
+	// Пользователю без назначенной роли задачи недоступны ни в одном списке
+	stranger := authorization.UserSubject("4")
+	for _, path := range []string{"/api/tasks", "/api/tasks?list=work", "/api/task?id=" + work, "/api/task?id=" + home} {
+		status, _ = call(http.MethodGet, path, token(stranger), nil)
+		assert.Equal(t, http.StatusForbidden, status, "%s должен быть запрещен пользователю без роли", path)
+	}
+
+	// Удалять задачи может только владелец их списка
+	status, _ = call(http.MethodDelete, "/api/task?id="+work, token(editor), nil)
+	assert.Equal(t, http.StatusForbidden, status)
+	status, _ = call(http.MethodDelete, "/api/task?id="+home, token(manager), nil)
+	assert.Equal(t, http.StatusForbidden, status)
+	status, m = call(http.MethodDelete, "/api/task?id="+work, token(manager), nil)
+	assert.Equal(t, http.StatusOK, status, m)
+
+	// Имя "*" зарезервировано для всех списков
+	status, _ = call(http.MethodPost, "/api/task?list=*", owner, map[string]any{"title": "Новая"})
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	// Снятая роль в списке больше не действует
+	status, _ = call(http.MethodDelete, "/api/roles?subject="+editor+"&list=work", owner, nil)
+	require.Equal(t, http.StatusOK, status)
+	status, _ = call(http.MethodPost, "/api/task?list=work", token(editor), map[string]any{"title": "Новая"})
+	assert.Equal(t, http.StatusForbidden, status)
+
+	// CalDAV показывает только общий список задач
+	req, err := http.NewRequest(http.MethodGet, srv.URL+"/dav/tasks/"+created+".ics", nil)
+	require.NoError(t, err)
+	req.SetBasicAuth("", "123321")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
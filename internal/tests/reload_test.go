@@ -0,0 +1,117 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Журнал, в который можно писать из нескольких горутин
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestConfigReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "todo.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("password: first\nlist_limit: 5\n"), 0644))
+	t.Setenv("TODO_CONFIG", path)
+	t.Setenv("TODO_CONFIG_POLL_INTERVAL", "20ms")
+	t.Setenv("TODO_OIDC_ISSUER", "")
+	for _, name := range []string{"TODO_PASSWORD", "TODO_SECRET", "TODO_LIST_LIMIT"} {
+		t.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+	srv := newLocalServer(t)
+
+	var logs syncBuffer
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	signals := make(chan os.Signal, 1)
+	ctx, stop := context.WithCancel(context.Background())
+	watched := make(chan struct{})
+	go func() {
+		srv.cfg.Watch(ctx, signals)
+		close(watched)
+	}()
+	t.Cleanup(func() {
+		stop()
+		<-watched
+	})
+
+	signin := func(password string) string {
+		resp, err := http.Post(srv.URL+"/api/signin", "application/json", strings.NewReader(`{"password":"`+password+`"}`))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var body struct {
+			Token string `json:"token"`
+		}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		return body.Token
+	}
+	tasksStatus := func(token string) int {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+"/api/tasks", nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	oldToken := signin("first")
+	require.NotEmpty(t, oldToken)
+	assert.Equal(t, http.StatusOK, tasksStatus(oldToken))
+
+	// Изменение файла применяется без перезапуска, а смена пароля отзывает выданные токены
+	require.NoError(t, os.WriteFile(path, []byte("password: second\nlist_limit: 1\n"), 0644))
+	require.Eventually(t, func() bool { return srv.cfg.Password() == "second" }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, int64(1), srv.cfg.TaskListLimit())
+	assert.Equal(t, http.StatusUnauthorized, tasksStatus(oldToken))
+	newToken := signin("second")
+	require.NotEmpty(t, newToken)
+	assert.Equal(t, http.StatusOK, tasksStatus(newToken))
+
+	// В журнале видно, что изменилось, но не значения секретов
+	assert.Contains(t, logs.String(), "password: changed")
+	assert.Contains(t, logs.String(), `list_limit: "5" -> "1"`)
+	assert.NotContains(t, logs.String(), "second")
+
+	// Ошибочные настройки не применяются, действуют прежние
+	require.NoError(t, os.WriteFile(path, []byte("password: third\nlist_limit: none\n"), 0644))
+	assert.Error(t, srv.cfg.Reload())
+	assert.Equal(t, "second", srv.cfg.Password())
+	assert.Equal(t, http.StatusOK, tasksStatus(newToken))
+
+	// SIGHUP перечитывает и переменные окружения
+	require.NoError(t, os.WriteFile(path, []byte("password: second\n"), 0644))
+	t.Setenv("TODO_LIST_LIMIT", "3")
+	signals <- syscall.SIGHUP
+	require.Eventually(t, func() bool { return srv.cfg.TaskListLimit() == 3 }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, http.StatusOK, tasksStatus(newToken), "токены действуют, пока не сменились пароль и секрет")
+}
@@ -0,0 +1,91 @@
+package tests
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go_final_project/internal/config"
+	"go_final_project/internal/server"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type closerFunc func() error
+
+func (f closerFunc) Close() error {
+	return f()
+}
+
+func TestGracefulShutdown(t *testing.T) {
+	t.Setenv("TODO_SHUTDOWN_TIMEOUT", "5s")
+
+	started := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(300 * time.Millisecond)
+		io.WriteString(w, "done")
+	})
+
+	srv := server.New(config.New(), handler)
+
+	var workerStopped, closed atomic.Bool
+	srv.Worker(func(ctx context.Context) {
+		<-ctx.Done()
+		workerStopped.Store(true)
+	})
+	srv.Closer(closerFunc(func() error {
+		assert.True(t, workerStopped.Load(), "ресурсы закрываются после остановки фоновых задач")
+		closed.Store(true)
+		return nil
+	}))
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	ctx, stop := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- srv.Serve(ctx, ln)
+	}()
+
+	// Запрос, начатый до остановки, завершается, а новые соединения уже не принимаются
+	type result struct {
+		body string
+		err  error
+	}
+	inFlight := make(chan result, 1)
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String())
+		if err != nil {
+			inFlight <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		inFlight <- result{body: string(body), err: err}
+	}()
+
+	<-started
+	stop()
+
+	r := <-inFlight
+	require.NoError(t, r.err)
+	assert.Equal(t, "done", r.body)
+
+	select {
+	case err := <-served:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("сервер не остановился")
+	}
+	assert.True(t, workerStopped.Load())
+	assert.True(t, closed.Load())
+
+	_, err = http.Get("http://" + ln.Addr().String())
+	assert.Error(t, err)
+}
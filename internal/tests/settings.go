@@ -1,7 +1,19 @@
 package tests
 
+import "os"
+
 var Port = 7540
 var DBFile = "../../scheduler.db"
 var FullNextDate = true
 var Search = true
-var Token = `eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9.e30.0oriZhsSGdCNsQayqxyvZhVqMVRtvpwsil2ASHPD-Dk`
+
+// Токен из куки `token`, полученной при входе на `/login.html`; нужен, только если сервис запущен с TODO_PASSWORD.
+// Токен действует TODO_TOKEN_TTL и подписан ключом из TODO_SECRET, поэтому при пустом TODO_SECRET перестает
+// действовать после перезапуска сервиса. Вместо правки файла токен можно передать в переменной TODO_TOKEN
+var Token = ``
+
+func init() {
+	if token := os.Getenv("TODO_TOKEN"); len(token) > 0 {
+		Token = token
+	}
+}
@@ -0,0 +1,112 @@
+package tests
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"go_final_project/internal/authorization"
+	"go_final_project/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setSigninLimits(t *testing.T) {
+	t.Setenv("TODO_SIGNIN_FREE_ATTEMPTS", "2")
+	t.Setenv("TODO_SIGNIN_BACKOFF_BASE", "100ms")
+	t.Setenv("TODO_SIGNIN_LOCKOUT_ATTEMPTS", "5")
+	t.Setenv("TODO_SIGNIN_LOCKOUT_TIME", "1m")
+	t.Setenv("TODO_SIGNIN_GLOBAL_LIMIT", "3")
+	t.Setenv("TODO_SIGNIN_GLOBAL_WINDOW", "1m")
+}
+
+func TestSigninLimiter(t *testing.T) {
+	setSigninLimits(t)
+	cfg, _, err := config.Load(nil)
+	require.NoError(t, err)
+	limiter := authorization.NewLimiter(cfg)
+
+	// Первые попытки без задержек, затем задержка удваивается, а после SigninLockoutAttempts адрес блокируется
+	for i := 0; i < 2; i++ {
+		_, ok := limiter.Allow("10.0.0.1")
+		require.True(t, ok)
+		limiter.Failure("10.0.0.1")
+	}
+	wait, ok := limiter.Allow("10.0.0.1")
+	assert.False(t, ok)
+	assert.InDelta(t, 100*time.Millisecond, wait, float64(50*time.Millisecond))
+	limiter.Failure("10.0.0.1")
+	wait, _ = limiter.Allow("10.0.0.1")
+	assert.InDelta(t, 200*time.Millisecond, wait, float64(50*time.Millisecond))
+	limiter.Failure("10.0.0.1")
+	limiter.Failure("10.0.0.1")
+	wait, ok = limiter.Allow("10.0.0.1")
+	assert.False(t, ok)
+	assert.InDelta(t, time.Minute, wait, float64(time.Second))
+
+	// Блокировка касается только этого адреса
+	_, ok = limiter.Allow("10.0.0.2")
+	assert.True(t, ok)
+
+	// Общий лимит превышен: никто не блокируется, но попытки с других адресов замедляются,
+	// кроме адресов, с которых был успешный вход
+	limiter.Success("10.0.0.3")
+	_, ok = limiter.Allow("10.0.0.4")
+	assert.True(t, ok)
+	assert.Equal(t, 100*time.Millisecond, limiter.Delay("10.0.0.4"))
+	assert.Zero(t, limiter.Delay("10.0.0.3"))
+	for i := 0; i < 30; i++ {
+		limiter.Failure("10.0.1." + strconv.Itoa(i))
+	}
+	assert.Equal(t, 5*time.Second, limiter.Delay("10.0.0.4"), "задержка растет, но ограничена")
+	assert.Zero(t, limiter.Delay("10.0.0.3"))
+
+	// Успешный вход сбрасывает счетчик адреса
+	limiter.Success("10.0.0.1")
+	_, ok = limiter.Allow("10.0.0.1")
+	assert.True(t, ok)
+	limiter.Failure("10.0.0.1")
+	_, ok = limiter.Allow("10.0.0.1")
+	assert.True(t, ok, "после успешного входа снова доступны попытки без задержки")
+}
+
+func TestSigninLockout(t *testing.T) {
+	setSigninLimits(t)
+	t.Setenv("TODO_SIGNIN_BACKOFF_BASE", "20ms")
+	t.Setenv("TODO_PASSWORD", "right")
+	t.Setenv("TODO_OIDC_ISSUER", "")
+	srv := newLocalServer(t)
+
+	signin := func(password string) *http.Response {
+		resp, err := http.Post(srv.URL+"/api/signin", "application/json", strings.NewReader(`{"password":"`+password+`"}`))
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, signin("wrong").StatusCode)
+	assert.Equal(t, http.StatusUnauthorized, signin("wrong").StatusCode)
+	// После бесплатных попыток даже верный пароль ждет окончания задержки
+	resp := signin("right")
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, "1", resp.Header.Get("Retry-After"))
+
+	time.Sleep(30 * time.Millisecond)
+	require.Equal(t, http.StatusOK, signin("right").StatusCode)
+	// Успешный вход сбросил счетчик
+	assert.Equal(t, http.StatusUnauthorized, signin("wrong").StatusCode)
+	assert.Equal(t, http.StatusOK, signin("right").StatusCode)
+
+	for i := 0; i < 5; i++ {
+		signin("wrong")
+		time.Sleep(time.Duration(20<<i+5) * time.Millisecond)
+	}
+	resp = signin("right")
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	retry, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	require.NoError(t, err)
+	assert.InDelta(t, 60, retry, 1, "адрес заблокирован на SigninLockoutTime")
+}
@@ -0,0 +1,52 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"go_final_project/internal/app"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransferTimeout(t *testing.T) {
+	t.Setenv("TODO_PASSWORD", "")
+	t.Setenv("TODO_OIDC_ISSUER", "")
+	t.Setenv("TODO_REQUEST_TIMEOUT", "1ns")
+	t.Setenv("TODO_TRANSFER_TIMEOUT", "1m")
+	srv := newLocalServer(t)
+
+	today := time.Now().Format(`20060102`)
+	_, err := srv.db.AddTask(context.Background(), app.Task{Date: today, Title: "Задача"})
+	require.NoError(t, err)
+
+	call := func(method, path, contentType, body string) int {
+		req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		require.NoError(t, err)
+		if len(contentType) > 0 {
+			req.Header.Set("Content-Type", contentType)
+		}
+		req.Header.Set("Depth", "1")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// Обычные запросы ограничены RequestTimeout
+	assert.Equal(t, http.StatusServiceUnavailable, call(http.MethodGet, "/api/tasks", "", ""))
+
+	// Выгрузка, загрузка и CalDAV ограничены только TransferTimeout
+	assert.Equal(t, http.StatusOK, call(http.MethodGet, "/api/export?format=csv", "", ""))
+	assert.Equal(t, http.StatusOK, call(http.MethodPost, "/api/import", "text/csv", "title,date\nИз файла,"+today+"\n"))
+	assert.Equal(t, http.StatusMultiStatus, call("PROPFIND", "/dav/", "", ""))
+
+	t.Setenv("TODO_TRANSFER_TIMEOUT", "1ns")
+	require.NoError(t, srv.cfg.Reload())
+	assert.Equal(t, http.StatusServiceUnavailable, call(http.MethodGet, "/api/export?format=csv", "", ""))
+	assert.Equal(t, http.StatusServiceUnavailable, call(http.MethodPost, "/api/import", "text/csv", "title,date\nИз файла,"+today+"\n"))
+}
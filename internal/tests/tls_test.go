@@ -0,0 +1,121 @@
+package tests
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go_final_project/internal/config"
+	"go_final_project/internal/db"
+	"go_final_project/internal/rest"
+	"go_final_project/internal/server"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Запускает сервис с TLS и возвращает адрес и функцию остановки
+func startTLSServer(t *testing.T) (string, func()) {
+	cfg := config.New()
+	database := db.New(cfg)
+	if !database.Exists() {
+		require.NoError(t, database.Create())
+	}
+	require.NoError(t, database.Open())
+
+	mux := rest.NewMux(newDeps(database, cfg), cfg)
+	srv := server.New(cfg, mux.ServeMux())
+	srv.Closer(database)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	ctx, stop := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- srv.Serve(ctx, ln)
+	}()
+
+	return ln.Addr().String(), func() {
+		stop()
+		require.NoError(t, <-served)
+	}
+}
+
+func TestTLS(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("TODO_WEBDIR", "../../web")
+	t.Setenv("TODO_DBPATH", filepath.Join(dir, "scheduler.db"))
+	t.Setenv("TODO_PASSWORD", "12345")
+	t.Setenv("TODO_OIDC_ISSUER", "")
+	t.Setenv("TODO_TLS_CERT", "")
+	t.Setenv("TODO_TLS_KEY", "")
+	t.Setenv("TODO_TLS_DEV", "true")
+
+	addr, stop := startTLSServer(t)
+
+	var peerCert []byte
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: true,
+				VerifyConnection: func(state tls.ConnectionState) error {
+					peerCert = state.PeerCertificates[0].Raw
+					return nil
+				},
+			},
+			ForceAttemptHTTP2: true,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+		Timeout: 5 * time.Second,
+	}
+
+	resp, err := client.Get("https://" + addr + "/api/nextdate?now=20240126&date=20240126&repeat=d%201")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "HTTP/2.0", resp.Proto)
+	firstCert := peerCert
+
+	// Самоподписанный сертификат сохраняется рядом с базой
+	_, err = os.Stat(filepath.Join(dir, "selfsigned.crt"))
+	require.NoError(t, err)
+
+	// Обычный HTTP на том же порту перенаправляется на HTTPS
+	resp, err = client.Get("http://" + addr + "/api/tasks?search=abc")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusPermanentRedirect, resp.StatusCode)
+	assert.Equal(t, "https://"+addr+"/api/tasks?search=abc", resp.Header.Get("Location"))
+
+	// Кука с токеном недоступна скриптам и передается только по HTTPS
+	resp, err = client.Post("https://"+addr+"/api/signin", "application/json", strings.NewReader(`{"password":"12345"}`))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	cookies := resp.Cookies()
+	require.Len(t, cookies, 1)
+	assert.Equal(t, "token", cookies[0].Name)
+	assert.True(t, cookies[0].Secure)
+	assert.True(t, cookies[0].HttpOnly)
+	assert.Equal(t, http.SameSiteLaxMode, cookies[0].SameSite)
+
+	stop()
+
+	// После перезапуска используется тот же сертификат
+	addr, stop = startTLSServer(t)
+	defer stop()
+	client.CloseIdleConnections()
+
+	resp, err = client.Get("https://" + addr + "/api/nextdate?now=20240126&date=20240126&repeat=d%201")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, firstCert, peerCert)
+}
@@ -0,0 +1,97 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"go_final_project/internal/authorization"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokens(t *testing.T) {
+	t.Setenv("TODO_PASSWORD", "first")
+	t.Setenv("TODO_SECRET", "token-secret")
+	t.Setenv("TODO_TOKEN_TTL", "8h")
+	t.Setenv("TODO_OIDC_ISSUER", "")
+	srv := newLocalServer(t)
+	ctx := context.Background()
+
+	signin := func() string {
+		resp, err := http.Post(srv.URL+"/api/signin", "application/json", strings.NewReader(`{"password":"first"}`))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		var body struct {
+			Token string `json:"token"`
+		}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		return body.Token
+	}
+	tasksStatus := func(token string) int {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+"/api/tasks", nil)
+		require.NoError(t, err)
+		req.AddCookie(&http.Cookie{Name: "token", Value: token})
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	refresh := func(token string) (int, string) {
+		req, err := http.NewRequest(http.MethodPost, srv.URL+"/api/token/refresh", nil)
+		require.NoError(t, err)
+		req.AddCookie(&http.Cookie{Name: "token", Value: token})
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var body struct {
+			Token string `json:"token"`
+		}
+		json.NewDecoder(resp.Body).Decode(&body)
+		return resp.StatusCode, body.Token
+	}
+
+	// Токен содержит пользователя, идентификатор и срок действия из настроек
+	token := signin()
+	claims, err := srv.auth.ParseToken(ctx, token)
+	require.NoError(t, err)
+	assert.Equal(t, authorization.PasswordSubject, claims.Subject)
+	assert.NotEmpty(t, claims.ID)
+	assert.Equal(t, 8*time.Hour, claims.ExpiresAt.Sub(claims.IssuedAt.Time))
+	assert.Equal(t, http.StatusOK, tasksStatus(token))
+
+	// Токен без срока действия и идентификатора, как прежний Token из settings.go, не принимается
+	assert.Equal(t, http.StatusUnauthorized, tasksStatus(`eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9.e30.0oriZhsSGdCNsQayqxyvZhVqMVRtvpwsil2ASHPD-Dk`))
+
+	// Обмен выдает новый токен и отзывает старый, повторно старый токен обменять нельзя
+	status, refreshed := refresh(token)
+	require.Equal(t, http.StatusOK, status)
+	require.NotEmpty(t, refreshed)
+	assert.NotEqual(t, token, refreshed)
+	assert.Equal(t, http.StatusOK, tasksStatus(refreshed))
+	assert.Equal(t, http.StatusUnauthorized, tasksStatus(token))
+	status, _ = refresh(token)
+	assert.Equal(t, http.StatusUnauthorized, status)
+
+	// Список отозванных токенов хранится в базе и действует после перезапуска
+	restarted := authorization.Create(srv.db, srv.cfg)
+	_, err = restarted.ParseToken(ctx, token)
+	assert.ErrorContains(t, err, "revoked")
+	_, err = restarted.ParseToken(ctx, refreshed)
+	assert.NoError(t, err)
+
+	// Истекший токен не принимается и не обменивается
+	t.Setenv("TODO_TOKEN_TTL", "1s")
+	require.NoError(t, srv.cfg.Reload())
+	short := signin()
+	assert.Equal(t, http.StatusOK, tasksStatus(short))
+	time.Sleep(1500 * time.Millisecond)
+	assert.Equal(t, http.StatusUnauthorized, tasksStatus(short))
+	status, _ = refresh(short)
+	assert.Equal(t, http.StatusUnauthorized, status)
+}
@@ -0,0 +1,68 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"go_final_project/internal/app"
+	"go_final_project/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithTx(t *testing.T) {
+	t.Setenv("TODO_PASSWORD", "")
+	t.Setenv("TODO_OIDC_ISSUER", "")
+	srv := newLocalServer(t)
+	application := app.CreateApplication(srv.db, config.New())
+
+	now := time.Now()
+	today := now.Format(`20060102`)
+
+	// Ошибка отменяет все изменения транзакции
+	var id int64
+	errRollback := errors.New("rollback")
+	err := srv.db.WithTx(context.Background(), func(storage app.Storage) error {
+		var err error
+		id, err = storage.AddTask(context.Background(), app.Task{Date: today, Title: "Отмененная задача"})
+		require.NoError(t, err)
+		_, err = storage.GetTaskByID(context.Background(), fmt.Sprint(id))
+		require.NoError(t, err, "изменения видны внутри транзакции")
+		return errRollback
+	})
+	assert.ErrorIs(t, err, errRollback)
+	_, err = srv.db.GetTaskByID(context.Background(), fmt.Sprint(id))
+	assert.ErrorIs(t, err, app.ErrNotFound)
+
+	// Параллельные выполнения задачи не теряют изменений друг друга:
+	// каждое переносит задачу ровно на один день
+	taskID, err := srv.db.AddTask(context.Background(), app.Task{Date: today, Title: "Ежедневная задача", Repeat: "d 1"})
+	require.NoError(t, err)
+	id = taskID
+
+	const n = 10
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- application.FinishTask(context.Background(), fmt.Sprint(id), 0)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		assert.NoError(t, err)
+	}
+
+	task, err := srv.db.GetTaskByID(context.Background(), fmt.Sprint(id))
+	require.NoError(t, err)
+	assert.Equal(t, now.AddDate(0, 0, n).Format(`20060102`), task.Date)
+	assert.Equal(t, int64(n+1), task.Version)
+}
@@ -0,0 +1,91 @@
+package tests
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Выполняет запрос к api без авторизации и возвращает ответ с прочитанным телом
+func doRequest(t *testing.T, method, url, contentType, body string) (*http.Response, []byte) {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	require.NoError(t, err)
+	if len(contentType) > 0 {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp, data
+}
+
+func TestV1Tasks(t *testing.T) {
+	t.Setenv("TODO_PASSWORD", "")
+	t.Setenv("TODO_OIDC_ISSUER", "")
+	srv := newLocalServer(t)
+	today := time.Now().Format(`20060102`)
+
+	// Создание отвечает 201 Created с адресом задачи в Location
+	resp, data := doRequest(t, http.MethodPost, srv.URL+"/api/v1/tasks", "application/json",
+		`{"date":"`+today+`","title":"Новая задача","repeat":"d 1"}`)
+	require.Equal(t, http.StatusCreated, resp.StatusCode, string(data))
+	var created map[string]any
+	require.NoError(t, json.Unmarshal(data, &created))
+	id := created["id"].(string)
+	location := resp.Header.Get("Location")
+	assert.Equal(t, "/api/v1/tasks/"+id, location)
+	assert.Equal(t, `"1"`, resp.Header.Get("ETag"))
+	assert.Equal(t, "Новая задача", created["title"])
+
+	// По адресу из Location отдается та же задача
+	resp, data = doRequest(t, http.MethodGet, srv.URL+location, "", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var task map[string]any
+	require.NoError(t, json.Unmarshal(data, &task))
+	assert.Equal(t, created, task)
+
+	// Замена возвращает сохраненную задачу и ETag ее новой версии
+	resp, data = doRequest(t, http.MethodPut, srv.URL+location, "application/json",
+		`{"date":"`+today+`","title":"Замененная задача","repeat":"d 1"}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode, string(data))
+	assert.Equal(t, `"2"`, resp.Header.Get("ETag"))
+	var updated map[string]any
+	require.NoError(t, json.Unmarshal(data, &updated))
+	resp, data = doRequest(t, http.MethodGet, srv.URL+location, "", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, `"2"`, resp.Header.Get("ETag"))
+	require.NoError(t, json.Unmarshal(data, &task))
+	assert.Equal(t, updated, task)
+
+	// Ошибка проверки не создает задачу и не выдает Location
+	resp, _ = doRequest(t, http.MethodPost, srv.URL+"/api/v1/tasks", "application/json", `{"title":""}`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Empty(t, resp.Header.Get("Location"))
+
+	// Выполнение повторяющейся задачи переносит ее, удаление отвечает 204 No Content
+	resp, _ = doRequest(t, http.MethodPost, srv.URL+location+"/complete", "", "")
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	resp, data = doRequest(t, http.MethodGet, srv.URL+location, "", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NoError(t, json.Unmarshal(data, &task))
+	assert.Greater(t, task["date"], today)
+
+	resp, _ = doRequest(t, http.MethodDelete, srv.URL+location, "", "")
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	resp, _ = doRequest(t, http.MethodGet, srv.URL+location, "", "")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// Старые маршруты для фронтенда отвечают как раньше
+	resp, data = doRequest(t, http.MethodPost, srv.URL+"/api/task", "application/json", `{"title":"Старый маршрут"}`)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Empty(t, resp.Header.Get("Location"))
+	assert.Contains(t, string(data), `"id"`)
+}
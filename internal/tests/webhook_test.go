@@ -0,0 +1,295 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"go_final_project/internal/app"
+	"go_final_project/internal/webhook"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Получатель вебхука, который проверяет подпись и отвечает ошибкой на первые fail запросов
+type webhookReceiver struct {
+	*httptest.Server
+	t      *testing.T
+	secret string
+
+	mu     sync.Mutex
+	fail   int
+	events []app.Event
+	ids    []string
+}
+
+func newWebhookReceiver(t *testing.T, fail int) *webhookReceiver {
+	r := &webhookReceiver{t: t, fail: fail}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, err := io.ReadAll(req.Body)
+		require.NoError(t, err)
+		timestamp, err := strconv.ParseInt(req.Header.Get(webhook.HeaderTimestamp), 10, 64)
+		require.NoError(t, err)
+		assert.Equal(t, webhook.Signature(r.secret, timestamp, body), req.Header.Get(webhook.HeaderSignature))
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if r.fail > 0 {
+			r.fail--
+			http.Error(w, "try later", http.StatusInternalServerError)
+			return
+		}
+		var event app.Event
+		require.NoError(t, json.Unmarshal(body, &event))
+		assert.Equal(t, event.Type, req.Header.Get(webhook.HeaderEvent))
+		r.events = append(r.events, event)
+		r.ids = append(r.ids, req.Header.Get(webhook.HeaderDelivery))
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func (r *webhookReceiver) received() map[string]app.Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	events := make(map[string]app.Event)
+	for _, event := range r.events {
+		events[event.Type] = event
+	}
+	return events
+}
+
+func TestWebhooks(t *testing.T) {
+	t.Setenv("TODO_PASSWORD", "")
+	t.Setenv("TODO_OIDC_ISSUER", "")
+	t.Setenv("TODO_WEBHOOK_RETRY_DELAY", "10ms")
+	t.Setenv("TODO_WEBHOOK_MAX_ATTEMPTS", "3")
+	t.Setenv("TODO_WEBHOOK_ALLOWED_HOSTS", "127.0.0.1")
+	srv := newLocalServer(t)
+	ctx := context.Background()
+
+	call := func(method, path string, body any, out any) int {
+		var data []byte
+		if body != nil {
+			var err error
+			data, err = json.Marshal(body)
+			require.NoError(t, err)
+		}
+		req, err := http.NewRequest(method, srv.URL+path, bytes.NewReader(data))
+		require.NoError(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		if out != nil {
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(out))
+		}
+		return resp.StatusCode
+	}
+
+	// Первый ответ получателя - ошибка, событие доставляется повторной попыткой
+	receiver := newWebhookReceiver(t, 1)
+	var hook webhook.Webhook
+	require.Equal(t, http.StatusOK, call(http.MethodPost, "/api/webhooks", map[string]any{"url": receiver.URL}, &hook))
+	require.NotEmpty(t, hook.Secret)
+	receiver.secret = hook.Secret
+
+	broken := newWebhookReceiver(t, 100)
+	var brokenHook webhook.Webhook
+	require.Equal(t, http.StatusOK, call(http.MethodPost, "/api/webhooks",
+		map[string]any{"url": broken.URL, "events": []string{app.EventTaskDeleted}}, &brokenHook))
+	broken.secret = brokenHook.Secret
+
+	assert.Equal(t, http.StatusBadRequest, call(http.MethodPost, "/api/webhooks", map[string]any{"url": "ftp://example.com"}, nil))
+	assert.Equal(t, http.StatusBadRequest, call(http.MethodPost, "/api/webhooks",
+		map[string]any{"url": receiver.URL, "events": []string{"task.archived"}}, nil))
+
+	var list struct {
+		Webhooks []webhook.Webhook `json:"webhooks"`
+	}
+	require.Equal(t, http.StatusOK, call(http.MethodGet, "/api/webhooks", nil, &list))
+	require.Len(t, list.Webhooks, 2)
+	assert.Empty(t, list.Webhooks[0].Secret)
+	assert.Equal(t, []string{app.EventTaskDeleted}, list.Webhooks[1].Events)
+
+	// Жизненный цикл задачи через api
+	today := time.Now().Format(`20060102`)
+	date := time.Now().AddDate(0, 0, 1).Format(`20060102`)
+	var created struct {
+		ID string `json:"id"`
+	}
+	require.Equal(t, http.StatusOK, call(http.MethodPost, "/api/task", map[string]any{"date": date, "title": "Зарядка", "repeat": "d 1"}, &created))
+	require.Equal(t, http.StatusOK, call(http.MethodPut, "/api/task",
+		map[string]any{"id": created.ID, "date": date, "title": "Утренняя зарядка", "repeat": "d 1"}, nil))
+	// Неудачное изменение не порождает события
+	require.Equal(t, http.StatusBadRequest, call(http.MethodPut, "/api/task", map[string]any{"id": created.ID, "date": date, "title": ""}, nil))
+	require.Equal(t, http.StatusOK, call(http.MethodPost, "/api/task/done?id="+created.ID, nil, nil))
+	require.Equal(t, http.StatusOK, call(http.MethodDelete, "/api/task?id="+created.ID, nil, nil))
+
+	for i := 0; i < 50; i++ {
+		_, err := srv.webhooks.Deliver(ctx)
+		require.NoError(t, err)
+		var pending struct {
+			Deliveries []webhook.Delivery `json:"deliveries"`
+		}
+		require.Equal(t, http.StatusOK, call(http.MethodGet, "/api/webhooks/deliveries?status=pending", nil, &pending))
+		if len(pending.Deliveries) == 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	events := receiver.received()
+	require.Len(t, events, 4)
+	assert.Len(t, receiver.ids, 4)
+	assert.Equal(t, "Зарядка", events[app.EventTaskCreated].Task.Title)
+	assert.Equal(t, created.ID, events[app.EventTaskCreated].Task.ID)
+	assert.Equal(t, "Утренняя зарядка", events[app.EventTaskUpdated].Task.Title)
+	next := time.Now().AddDate(0, 0, 2).Format(`20060102`)
+	assert.Equal(t, date, events[app.EventTaskCompleted].Task.Date)
+	assert.Equal(t, next, events[app.EventTaskCompleted].NextDate)
+	assert.Equal(t, next, events[app.EventTaskDeleted].Task.Date)
+
+	// Журнал доставок: повторная попытка у первого события, исчерпанные попытки у неработающего получателя
+	var log struct {
+		Deliveries []webhook.Delivery `json:"deliveries"`
+	}
+	require.Equal(t, http.StatusOK, call(http.MethodGet, "/api/webhooks/deliveries?webhook_id="+hook.ID, nil, &log))
+	require.Len(t, log.Deliveries, 4)
+	for _, delivery := range log.Deliveries {
+		assert.Equal(t, webhook.StatusDelivered, delivery.Status)
+		assert.NotEmpty(t, delivery.Delivered)
+		if delivery.Event == app.EventTaskCreated {
+			assert.Equal(t, 2, delivery.Attempts)
+		} else {
+			assert.Equal(t, 1, delivery.Attempts)
+		}
+	}
+	assert.Equal(t, app.EventTaskDeleted, log.Deliveries[0].Event, "журнал идет от новых доставок к старым")
+
+	require.Equal(t, http.StatusOK, call(http.MethodGet, "/api/webhooks/deliveries?status=failed", nil, &log))
+	require.Len(t, log.Deliveries, 1)
+	assert.Equal(t, brokenHook.ID, log.Deliveries[0].WebhookID)
+	assert.Equal(t, 3, log.Deliveries[0].Attempts)
+	assert.Equal(t, http.StatusInternalServerError, log.Deliveries[0].LastStatus)
+	assert.Equal(t, "response 500 Internal Server Error", log.Deliveries[0].LastError, "тело ответа в журнал не попадает")
+
+	assert.Equal(t, http.StatusBadRequest, call(http.MethodGet, "/api/webhooks/deliveries?status=lost", nil, nil))
+
+	// Удаление получателя удаляет и его журнал, новые события для него в очередь не ставятся
+	require.Equal(t, http.StatusOK, call(http.MethodDelete, "/api/webhooks?id="+hook.ID, nil, nil))
+	assert.Equal(t, http.StatusNotFound, call(http.MethodDelete, "/api/webhooks?id="+hook.ID, nil, nil))
+	_, err := app.CreateApplication(srv.db, srv.cfg).AddTask(ctx, app.Task{Date: today, Title: "Без получателя"})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, call(http.MethodGet, "/api/webhooks/deliveries?webhook_id="+hook.ID, nil, &log))
+	assert.Empty(t, log.Deliveries)
+}
+
+func TestWebhookTargets(t *testing.T) {
+	t.Setenv("TODO_PASSWORD", "")
+	t.Setenv("TODO_OIDC_ISSUER", "")
+	t.Setenv("TODO_WEBHOOK_ALLOWED_HOSTS", "")
+	t.Setenv("TODO_WEBHOOK_MAX_ATTEMPTS", "1")
+	srv := newLocalServer(t)
+	ctx := context.Background()
+
+	// Адреса сервера и локальной сети отклоняются при создании, пока не разрешены настройкой
+	for _, url := range []string{"http://127.0.0.1:8080/hook", "http://localhost/hook", "http://api.localhost/hook",
+		"http://10.1.2.3/hook", "http://192.168.0.1/hook", "http://169.254.169.254/latest/meta-data", "http://[::1]/hook",
+		"http://[fe80::1]/hook", "http://0.0.0.0/hook"} {
+		_, err := srv.webhooks.Create(ctx, url, nil)
+		assert.ErrorIs(t, err, app.ErrValidation, url)
+	}
+	_, err := srv.webhooks.Create(ctx, "https://hooks.example.com/todo", nil)
+	assert.NoError(t, err)
+
+	t.Setenv("TODO_WEBHOOK_ALLOWED_HOSTS", "localhost, 10.0.0.0/8")
+	require.NoError(t, srv.cfg.Reload())
+	for _, url := range []string{"http://localhost/hook", "http://10.1.2.3/hook"} {
+		_, err := srv.webhooks.Create(ctx, url, nil)
+		assert.NoError(t, err, url)
+	}
+	_, err = srv.webhooks.Create(ctx, "http://192.168.0.1/hook", nil)
+	assert.ErrorIs(t, err, app.ErrValidation)
+
+	// Адрес проверяется и при отправке: получатель, разрешенный раньше, больше не получает событий
+	var received int
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) { received++ }))
+	defer receiver.Close()
+	t.Setenv("TODO_WEBHOOK_ALLOWED_HOSTS", "127.0.0.1")
+	require.NoError(t, srv.cfg.Reload())
+	hook, err := srv.webhooks.Create(ctx, receiver.URL, nil)
+	require.NoError(t, err)
+	t.Setenv("TODO_WEBHOOK_ALLOWED_HOSTS", "")
+	require.NoError(t, srv.cfg.Reload())
+
+	_, err = app.CreateApplication(srv.db, srv.cfg).AddTask(ctx, app.Task{Title: "Полить цветы"})
+	require.NoError(t, err)
+	_, err = srv.webhooks.Deliver(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, received)
+	deliveries, err := srv.webhooks.Deliveries(ctx, hook.ID, "", 10)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, webhook.StatusFailed, deliveries[0].Status)
+	assert.Contains(t, deliveries[0].LastError, "is not allowed for webhooks")
+}
+
+func TestWebhookConcurrency(t *testing.T) {
+	t.Setenv("TODO_PASSWORD", "")
+	t.Setenv("TODO_OIDC_ISSUER", "")
+	t.Setenv("TODO_WEBHOOK_ALLOWED_HOSTS", "127.0.0.1")
+	srv := newLocalServer(t)
+	ctx := context.Background()
+
+	// Медленный получатель создан первым, поэтому его доставки стоят в очереди раньше
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) { <-release }))
+	defer slow.Close()
+	var mu sync.Mutex
+	var fastIDs []string
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		fastIDs = append(fastIDs, req.Header.Get(webhook.HeaderDelivery))
+	}))
+	defer fast.Close()
+	_, err := srv.webhooks.Create(ctx, slow.URL, nil)
+	require.NoError(t, err)
+	fastHook, err := srv.webhooks.Create(ctx, fast.URL, nil)
+	require.NoError(t, err)
+
+	application := app.CreateApplication(srv.db, srv.cfg)
+	for _, title := range []string{"Первая", "Вторая", "Третья"} {
+		_, err := application.AddTask(ctx, app.Task{Title: title})
+		require.NoError(t, err)
+	}
+
+	done := make(chan int)
+	go func() {
+		attempts, err := srv.webhooks.Deliver(ctx)
+		assert.NoError(t, err)
+		done <- attempts
+	}()
+	// Быстрый получатель получает все события, пока медленный не ответил ни на одно
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(fastIDs) == 3
+	}, 5*time.Second, 10*time.Millisecond)
+	close(release)
+	assert.Equal(t, 6, <-done)
+
+	// События одному получателю отправляются в порядке создания
+	deliveries, err := srv.webhooks.Deliveries(ctx, fastHook.ID, webhook.StatusDelivered, 10)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 3)
+	assert.Equal(t, []string{deliveries[2].ID, deliveries[1].ID, deliveries[0].ID}, fastIDs)
+}
@@ -0,0 +1,77 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"go_final_project/internal/app"
+)
+
+// Адреса сервера и локальной сети. Вебхуки на них отправляются, только если получатель указан в TODO_WEBHOOK_ALLOWED_HOSTS:
+// иначе владелец через вебхук мог бы обращаться от имени сервера к его внутренним сервисам
+func internalIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast()
+}
+
+// Указан ли получатель с именем host или адресом ip (nil, если адрес неизвестен) в TODO_WEBHOOK_ALLOWED_HOSTS
+func (d *Dispatcher) allowed(host string, ip net.IP) bool {
+	for _, entry := range d.cfg.WebhookAllowedHosts() {
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			if ip != nil && network.Contains(ip) {
+				return true
+			}
+		} else if strings.EqualFold(entry, host) || ip != nil && ip.Equal(net.ParseIP(entry)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Проверяет получателя при создании. Адреса локальной сети и localhost отклоняются сразу,
+// а адреса остальных имен проверяются при каждой отправке в dial
+func (d *Dispatcher) checkHost(host string) error {
+	ip := net.ParseIP(host)
+	if d.allowed(host, ip) {
+		return nil
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if ip != nil && internalIP(ip) || host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return app.ValidationError("url", "webhooks to %s are not allowed, the host must be listed in TODO_WEBHOOK_ALLOWED_HOSTS", host)
+	}
+	return nil
+}
+
+// Соединяется с получателем, пропуская адреса локальной сети. Имя разрешается здесь же, и соединение
+// устанавливается с проверенным адресом, поэтому подменить адрес между проверкой и отправкой нельзя
+func (d *Dispatcher) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	var dialer net.Dialer
+	if d.allowed(host, net.ParseIP(host)) {
+		return dialer.DialContext(ctx, network, addr)
+	}
+
+	ips, err := net.DefaultResolver.LookupIP(ctx, "ip", host)
+	if err != nil {
+		return nil, err
+	}
+	var errs []error
+	for _, ip := range ips {
+		if internalIP(ip) && !d.allowed(host, ip) {
+			errs = append(errs, fmt.Errorf("address %s of %s is not allowed for webhooks", ip, host))
+			continue
+		}
+		conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		errs = append(errs, err)
+	}
+	return nil, errors.Join(errs...)
+}
@@ -0,0 +1,340 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"go_final_project/internal/app"
+	"go_final_project/internal/config"
+)
+
+// Состояния доставки события
+const (
+	StatusPending   = "pending"   // ждет отправки или повторной попытки
+	StatusDelivered = "delivered" // получатель ответил кодом 2xx
+	StatusFailed    = "failed"    // попытки исчерпаны
+)
+
+const (
+	pollInterval  = time.Second         // как часто проверять очередь доставок
+	batchSize     = 100                 // сколько доставок обрабатывается за один проход
+	maxRetryDelay = 6 * time.Hour       // предел удваивающейся паузы между попытками
+	logRetention  = 30 * 24 * time.Hour // сколько хранится журнал завершенных доставок
+	maxDrainBody  = 4096                // сколько байт ответа дочитывается, чтобы соединение можно было использовать снова
+	maxReceivers  = 8                   // скольким получателям события отправляются одновременно
+)
+
+// Заголовки запроса к получателю
+const (
+	HeaderEvent     = "X-Todo-Event"
+	HeaderDelivery  = "X-Todo-Delivery"
+	HeaderTimestamp = "X-Todo-Timestamp"
+	HeaderSignature = "X-Todo-Signature"
+)
+
+// Получатель событий. Events - типы событий из app.Events, пустой список - все события.
+// Secret заполняется только при создании: другие ответы его не возвращают
+type Webhook struct {
+	ID      string   `json:"id"`
+	URL     string   `json:"url"`
+	Events  []string `json:"events"`
+	Secret  string   `json:"secret,omitempty"`
+	Created string   `json:"created"`
+}
+
+// Доставка одного события одному получателю, она же запись журнала доставок. NextAttempt имеет смысл только
+// для ожидающих доставок и в журнале записывается в Retry, URL и Secret нужны только для отправки
+type Delivery struct {
+	ID          string    `json:"id"`
+	WebhookID   string    `json:"webhook_id"`
+	Event       string    `json:"event"`
+	Payload     string    `json:"payload"`
+	Status      string    `json:"status"`
+	Attempts    int       `json:"attempts"`
+	NextAttempt time.Time `json:"-"`
+	Retry       string    `json:"next_attempt,omitempty"`
+	LastStatus  int       `json:"last_status,omitempty"`
+	LastError   string    `json:"last_error,omitempty"`
+	Created     string    `json:"created"`
+	Delivered   string    `json:"delivered,omitempty"`
+
+	URL    string `json:"-"`
+	Secret string `json:"-"`
+}
+
+// Хранилище получателей и очереди доставок. События ставятся в очередь хранилищем задач (app.Storage.AddEvent)
+type Storage interface {
+	AddWebhook(ctx context.Context, hook Webhook) (int64, error)
+	GetWebhookList(ctx context.Context) ([]Webhook, error)
+	// Удаляет получателя вместе с его доставками
+	RemoveWebhook(ctx context.Context, id string) error
+	// Ожидающие доставки, время следующей попытки которых не позже now, в порядке создания
+	GetDueDeliveries(ctx context.Context, now time.Time, limit int) ([]Delivery, error)
+	// Сохраняет результат попытки: Status, Attempts, NextAttempt, LastStatus, LastError и Delivered
+	UpdateDelivery(ctx context.Context, delivery Delivery) error
+	// Журнал доставок от новых к старым, webhookID - только доставки этого получателя, если не пуст
+	GetDeliveryList(ctx context.Context, webhookID, status string, limit int) ([]Delivery, error)
+	// Удаляет завершенные доставки, созданные раньше before
+	PruneDeliveries(ctx context.Context, before time.Time) error
+}
+
+// Отправляет события задач получателям: каждое событие - POST с JSON app.Event и подписью HMAC-SHA256.
+// Неудачные доставки повторяются с удваивающейся паузой, пока не исчерпаны попытки из настроек
+type Dispatcher struct {
+	storage Storage
+	cfg     *config.Handler
+	client  *http.Client
+}
+
+func New(storage Storage, cfg *config.Handler) *Dispatcher {
+	d := &Dispatcher{storage: storage, cfg: cfg}
+	// Без прокси: адрес получателя проверяется при соединении с ним
+	d.client = &http.Client{Transport: &http.Transport{
+		DialContext:         d.dial,
+		ForceAttemptHTTP2:   true,
+		MaxIdleConns:        100,
+		IdleConnTimeout:     90 * time.Second,
+		TLSHandshakeTimeout: 10 * time.Second,
+	}}
+	return d
+}
+
+// Создает получателя и единственный раз возвращает его секрет для проверки подписи
+func (d *Dispatcher) Create(ctx context.Context, rawURL string, events []string) (Webhook, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+		return Webhook{}, fmt.Errorf("webhook.Dispatcher.Create: %w", app.ValidationError("url", "url must be an absolute http or https URL"))
+	}
+	if err := d.checkHost(u.Hostname()); err != nil {
+		return Webhook{}, fmt.Errorf("webhook.Dispatcher.Create: %w", err)
+	}
+	for _, event := range events {
+		if !slices.Contains(app.Events, event) {
+			return Webhook{}, fmt.Errorf("webhook.Dispatcher.Create: %w", app.ValidationError("events", "unknown event %q, expected one of %v", event, app.Events))
+		}
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return Webhook{}, fmt.Errorf("webhook.Dispatcher.Create: %v", err)
+	}
+	hook := Webhook{
+		URL:     u.String(),
+		Events:  append([]string{}, events...),
+		Secret:  hex.EncodeToString(secret),
+		Created: time.Now().UTC().Format(time.RFC3339),
+	}
+	id, err := d.storage.AddWebhook(ctx, hook)
+	if err != nil {
+		return Webhook{}, fmt.Errorf("webhook.Dispatcher.Create: %w", err)
+	}
+	hook.ID = strconv.FormatInt(id, 10)
+	return hook, nil
+}
+
+// Список получателей без секретов
+func (d *Dispatcher) List(ctx context.Context) ([]Webhook, error) {
+	hooks, err := d.storage.GetWebhookList(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("webhook.Dispatcher.List: %w", err)
+	}
+	if hooks == nil {
+		hooks = []Webhook{}
+	}
+	return hooks, nil
+}
+
+func (d *Dispatcher) Remove(ctx context.Context, id string) error {
+	if _, err := strconv.Atoi(id); err != nil {
+		return fmt.Errorf("webhook.Dispatcher.Remove: %w", app.ValidationError("id", "invalid id=%s", id))
+	}
+	if err := d.storage.RemoveWebhook(ctx, id); err != nil {
+		return fmt.Errorf("webhook.Dispatcher.Remove: %w", err)
+	}
+	return nil
+}
+
+// Журнал доставок от новых к старым, не больше limit записей
+func (d *Dispatcher) Deliveries(ctx context.Context, webhookID, status string, limit int) ([]Delivery, error) {
+	if len(status) > 0 && status != StatusPending && status != StatusDelivered && status != StatusFailed {
+		return nil, fmt.Errorf("webhook.Dispatcher.Deliveries: %w",
+			app.ValidationError("status", "status must be %s, %s or %s", StatusPending, StatusDelivered, StatusFailed))
+	}
+	deliveries, err := d.storage.GetDeliveryList(ctx, webhookID, status, limit)
+	if err != nil {
+		return nil, fmt.Errorf("webhook.Dispatcher.Deliveries: %w", err)
+	}
+	if deliveries == nil {
+		deliveries = []Delivery{}
+	}
+	for i, delivery := range deliveries {
+		if delivery.Status == StatusPending {
+			deliveries[i].Retry = delivery.NextAttempt.UTC().Format(time.RFC3339)
+		}
+	}
+	return deliveries, nil
+}
+
+// Отправляет события до отмены ctx. Доставки хранятся в базе, поэтому после перезапуска отправка продолжается
+func (d *Dispatcher) Run(ctx context.Context) {
+	for {
+		if _, err := d.Deliver(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("webhook: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// Выполняет по одной попытке для всех доставок, время которых пришло, и удаляет старые записи журнала.
+// Получатели обрабатываются параллельно, поэтому медленный получатель не задерживает остальных,
+// а события одному получателю отправляются по очереди в порядке создания. Возвращает число выполненных попыток
+func (d *Dispatcher) Deliver(ctx context.Context) (int, error) {
+	now := time.Now()
+	if err := d.storage.PruneDeliveries(ctx, now.Add(-logRetention)); err != nil {
+		return 0, fmt.Errorf("webhook.Dispatcher.Deliver: %w", err)
+	}
+
+	attempts := 0
+	for {
+		deliveries, err := d.storage.GetDueDeliveries(ctx, now, batchSize)
+		if err != nil {
+			return attempts, fmt.Errorf("webhook.Dispatcher.Deliver: %w", err)
+		}
+		n, err := d.deliverBatch(ctx, deliveries)
+		attempts += n
+		if err != nil {
+			return attempts, fmt.Errorf("webhook.Dispatcher.Deliver: %w", err)
+		}
+		// Доставки, отложенные в этом проходе, ждут следующего: их новое время позже now
+		if len(deliveries) < batchSize {
+			return attempts, nil
+		}
+	}
+}
+
+// Выполняет попытки для доставок deliveries, не больше maxReceivers получателей одновременно
+func (d *Dispatcher) deliverBatch(ctx context.Context, deliveries []Delivery) (int, error) {
+	var receivers []string
+	queues := make(map[string][]Delivery)
+	for _, delivery := range deliveries {
+		if _, ok := queues[delivery.WebhookID]; !ok {
+			receivers = append(receivers, delivery.WebhookID)
+		}
+		queues[delivery.WebhookID] = append(queues[delivery.WebhookID], delivery)
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		attempts int
+		errs     []error
+	)
+	slots := make(chan struct{}, maxReceivers)
+	for _, receiver := range receivers {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(queue []Delivery) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			for _, delivery := range queue {
+				d.attempt(ctx, &delivery)
+				err := d.storage.UpdateDelivery(ctx, delivery)
+				mu.Lock()
+				attempts++
+				if err != nil {
+					errs = append(errs, err)
+				}
+				mu.Unlock()
+				if err != nil {
+					return
+				}
+			}
+		}(queues[receiver])
+	}
+	wg.Wait()
+	return attempts, errors.Join(errs...)
+}
+
+// Отправляет событие и записывает результат попытки в delivery
+func (d *Dispatcher) attempt(ctx context.Context, delivery *Delivery) {
+	delivery.Attempts++
+	status, err := d.send(ctx, *delivery)
+	delivery.LastStatus = status
+	if err == nil {
+		delivery.Status = StatusDelivered
+		delivery.LastError = ""
+		delivery.Delivered = time.Now().UTC().Format(time.RFC3339)
+		return
+	}
+
+	delivery.LastError = err.Error()
+	if delivery.Attempts >= d.cfg.WebhookMaxAttempts() {
+		delivery.Status = StatusFailed
+		return
+	}
+	delay := d.cfg.WebhookRetryDelay()
+	for i := 1; i < delivery.Attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	delivery.NextAttempt = time.Now().Add(min(delay, maxRetryDelay))
+}
+
+// Отправляет событие получателю. Возвращает HTTP-статус ответа (0, если ответа нет) и ошибку, если статус не 2xx.
+// Тело ответа в ошибку не попадает: журнал доставок не должен хранить то, что вернул получатель
+func (d *Dispatcher) send(ctx context.Context, delivery Delivery) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.cfg.WebhookTimeout())
+	defer cancel()
+
+	body := []byte(delivery.Payload)
+	timestamp := time.Now().Unix()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+	req.Header.Set("User-Agent", "go_final_project-webhook")
+	req.Header.Set(HeaderEvent, delivery.Event)
+	req.Header.Set(HeaderDelivery, delivery.ID)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Signature(delivery.Secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxDrainBody))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("response %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// Подпись запроса: `sha256=` и HMAC-SHA256 строки `<timestamp>.<тело>` с секретом получателя в hex.
+// Время входит в подпись, чтобы перехваченный запрос нельзя было повторить позже
+func Signature(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
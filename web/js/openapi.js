@@ -0,0 +1,183 @@
+// Страница с описанием api: загружает openapi.json, показывает операции и позволяет выполнить запрос
+var openapi = (function () {
+    var spec;
+
+    function el(tag, attrs, children) {
+        var node = document.createElement(tag);
+        Object.keys(attrs || {}).forEach(function (k) {
+            if (k === 'text') {
+                node.textContent = attrs[k];
+            } else {
+                node.setAttribute(k, attrs[k]);
+            }
+        });
+        (children || []).forEach(function (c) { node.appendChild(c); });
+        return node;
+    }
+
+    function resolve(obj) {
+        var seen = 0;
+        while (obj && obj.$ref && seen++ < 16) {
+            obj = obj.$ref.replace(/^#\//, '').split('/').reduce(function (o, k) { return o[k]; }, spec);
+        }
+        return obj;
+    }
+
+    // Пример значения по схеме
+    function example(schema, depth) {
+        schema = resolve(schema) || {};
+        if (depth > 6) {
+            return null;
+        }
+        switch (schema.type) {
+            case 'object':
+                var obj = {};
+                Object.keys(schema.properties || {}).forEach(function (k) {
+                    obj[k] = example(schema.properties[k], depth + 1);
+                });
+                return obj;
+            case 'array':
+                return [example(schema.items, depth + 1)];
+            case 'integer':
+            case 'number':
+                return 0;
+            case 'boolean':
+                return false;
+            default:
+                return schema.enum ? schema.enum[0] : (schema.description ? '' : 'string');
+        }
+    }
+
+    function content(body) {
+        body = resolve(body);
+        if (!body || !body.content) {
+            return null;
+        }
+        var type = Object.keys(body.content)[0];
+        return { type: type, schema: body.content[type].schema };
+    }
+
+    function parameters(op) {
+        var rows = (op.parameters || []).map(function (p) {
+            p = resolve(p);
+            return el('tr', {}, [
+                el('td', { text: p.name + (p.required ? ' *' : '') }),
+                el('td', { text: p.in }),
+                el('td', { text: p.description || '' }),
+                el('td', {}, [el('input', { 'data-name': p.name, 'data-in': p.in })]),
+            ]);
+        });
+        return el('table', {}, [el('tr', {}, [
+            el('th', { text: 'Параметр' }), el('th', { text: 'Где' }), el('th', { text: 'Описание' }), el('th', { text: 'Значение' }),
+        ])].concat(rows));
+    }
+
+    function responses(op) {
+        var rows = Object.keys(op.responses).map(function (status) {
+            var r = resolve(op.responses[status]);
+            var c = content(r);
+            return el('tr', {}, [
+                el('td', { text: status }),
+                el('td', { text: r.description || '' }),
+                el('td', {}, c ? [el('pre', { text: JSON.stringify(example(c.schema, 0), null, 2) })] : []),
+            ]);
+        });
+        return el('table', {}, [el('tr', {}, [
+            el('th', { text: 'Статус' }), el('th', { text: 'Описание' }), el('th', { text: 'Пример' }),
+        ])].concat(rows));
+    }
+
+    // Выполняет запрос с параметрами из формы. Кука token отправляется браузером сама
+    function execute(method, path, node, body, output) {
+        var url = path;
+        var query = new URLSearchParams();
+        var headers = {};
+        node.querySelectorAll('input[data-name]').forEach(function (input) {
+            var name = input.getAttribute('data-name');
+            if (!input.value) {
+                return;
+            }
+            switch (input.getAttribute('data-in')) {
+                case 'path': url = url.replace('{' + name + '}', encodeURIComponent(input.value)); break;
+                case 'query': query.append(name, input.value); break;
+                case 'header': headers[name] = input.value; break;
+            }
+        });
+        if (query.toString()) {
+            url += '?' + query.toString();
+        }
+        var init = { method: method.toUpperCase(), headers: headers, credentials: 'same-origin' };
+        if (body) {
+            headers['Content-Type'] = body.type;
+            init.body = body.textarea.value;
+        }
+        output.textContent = '...';
+        fetch(url, init).then(function (resp) {
+            return resp.text().then(function (text) {
+                output.textContent = resp.status + ' ' + resp.statusText + '\n\n' + text;
+            });
+        }).catch(function (e) {
+            output.textContent = String(e);
+        });
+    }
+
+    function operation(path, method, op) {
+        var node = el('div', { class: 'op' });
+        if (op.security) {
+            node.appendChild(el('p', { class: 'lock', text: 'Требуется вход или API-ключ' }));
+        }
+        if (op.parameters) {
+            node.appendChild(el('h4', { text: 'Параметры' }));
+            node.appendChild(parameters(op));
+        }
+        var body = content(op.requestBody);
+        if (body) {
+            body.textarea = el('textarea', {});
+            body.textarea.value = JSON.stringify(example(body.schema, 0), null, 2);
+            node.appendChild(el('h4', { text: 'Тело запроса (' + body.type + ')' }));
+            node.appendChild(body.textarea);
+        }
+        node.appendChild(el('h4', { text: 'Ответы' }));
+        node.appendChild(responses(op));
+
+        var output = el('pre', {});
+        var button = el('button', { text: 'Выполнить' });
+        button.addEventListener('click', function () { execute(method, path, node, body, output); });
+        node.appendChild(button);
+        node.appendChild(output);
+
+        return el('details', {}, [
+            el('summary', {}, [
+                el('span', { class: 'method ' + method, text: method.toUpperCase() }),
+                el('span', { class: 'path', text: path }),
+                el('span', { class: 'summary', text: op.summary || '' }),
+            ]),
+            node,
+        ]);
+    }
+
+    function render(url, target) {
+        fetch(url).then(function (resp) { return resp.json(); }).then(function (data) {
+            spec = data;
+            document.getElementById('title').textContent = spec.info.title + ' ' + spec.info.version;
+            document.getElementById('description').textContent = spec.info.description || '';
+
+            var groups = {};
+            Object.keys(spec.paths).forEach(function (path) {
+                Object.keys(spec.paths[path]).forEach(function (method) {
+                    var op = spec.paths[path][method];
+                    var tag = (op.tags || ['api'])[0];
+                    (groups[tag] = groups[tag] || []).push(operation(path, method, op));
+                });
+            });
+            Object.keys(groups).forEach(function (tag) {
+                target.appendChild(el('h2', { text: tag }));
+                groups[tag].forEach(function (node) { target.appendChild(node); });
+            });
+        }).catch(function (e) {
+            target.textContent = 'Не удалось загрузить описание api: ' + e;
+        });
+    }
+
+    return { render: render };
+})();